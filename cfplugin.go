@@ -28,7 +28,7 @@ import (
 
 type CfPriam struct{ name, defaultConfigFile string }
 
-const publishUsage string = "publish [-n] [-f MANIFEST_PATH]"
+const publishUsage string = "publish [-n] [-r] [-f MANIFEST_PATH]"
 const defaultManifest string = "./manifest.yaml"
 
 func (c *CfPriam) GetMetadata() plugin.PluginMetadata {
@@ -44,6 +44,7 @@ func (c *CfPriam) GetMetadata() plugin.PluginMetadata {
 					Options: map[string]string{
 						"f": "Specify manifest file. Default is " + defaultManifest,
 						"n": "No push, only publish",
+						"r": "Remove entitlements that are not in the manifest",
 					},
 				},
 			},
@@ -61,27 +62,31 @@ func cfplugin(name, defaultConfigFile string) {
 
 func (c *CfPriam) Run(cliConnection plugin.CliConnection, args []string) {
 	if args[0] == "publish" {
-		c.Publish(cliConnection, args[1:])
+		if status := c.Publish(cliConnection, args[1:]); status != 0 {
+			os.Exit(status)
+		}
 	} else if args[0] == "unpublish" {
 		c.Unpublish(args[1:])
 	}
 }
 
-func (c *CfPriam) Publish(cliConn plugin.CliConnection, args []string) {
+// Publish pushes and publishes the apps of the manifest, and returns the exit status as priam does
+func (c *CfPriam) Publish(cliConn plugin.CliConnection, args []string) int {
 	flagSet := flag.NewFlagSet("publish", flag.ExitOnError)
 	nopush := flagSet.Bool("n", false, "don't push app, just publish")
 	trace := flagSet.Bool("t", false, "trace IDM requests")
+	revoke := flagSet.Bool("r", false, "remove entitlements that are not in the manifest")
 	manifile := flagSet.String("f", defaultManifest, "manifest file")
 	if err := flagSet.Parse(args); err != nil {
 		fmt.Printf("Error parsing arguments: %v\nUsage: %s\n", err, publishUsage)
-		return
+		return int(util.ErrUsage)
 	}
 
 	if !*nopush {
 		output, err := cliConn.CliCommand("push", "-f", *manifile)
 		if err != nil {
 			fmt.Printf("Error pushing app: %v\n%s", err, strings.Join(output, "\n"))
-			return
+			return int(util.ErrGeneral)
 		}
 		fmt.Println(strings.Join(output, "\n"))
 	}
@@ -89,11 +94,15 @@ func (c *CfPriam) Publish(cliConn plugin.CliConnection, args []string) {
 	// when cf execs a plugin it sets stdin and stdout but not stderr, so use
 	// stdout for OutW and ErrW
 	log := &util.Logr{TraceOn: *trace, ErrW: os.Stdout, OutW: os.Stdout}
-	if cfg := &(util.Config{}); cfg.Init(log, c.defaultConfigFile) {
-		if ctx := cli.InitCtx(cfg, true); ctx != nil {
-			core.PublishApps(ctx, *manifile)
-		}
+	cfg := &(util.Config{})
+	if !cfg.Init(log, c.defaultConfigFile) {
+		return int(util.ErrGeneral)
+	}
+	ctx, err := cli.InitCtx(cfg, true)
+	if err == nil {
+		err = core.PublishApps(ctx, *manifile, *revoke)
 	}
+	return int(util.KindOf(err))
 }
 
 func (c *CfPriam) Unpublish(args []string) {
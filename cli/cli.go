@@ -20,6 +20,7 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/howeyc/gopass"
 	"github.com/urfave/cli"
@@ -38,7 +39,8 @@ const (
 	accessTokenTypeOption = "accesstokentype"
 	refreshTokenOption    = "refreshtoken"
 	idTokenOption         = "idtoken"
-	cliClientSecret       = "not-a-secret"
+	clientIDOption        = "clientid"
+	passphraseEnvVar      = "PRIAM_PASSPHRASE"
 	defaultAwsCredFile    = ".aws/credentials"
 	defaultAwsProfile     = "priam"
 	defaultAwsStsEndpoint = "https://sts.amazonaws.com"
@@ -47,15 +49,17 @@ const (
 // Initially a const, but now allowed to be a user-changeable value
 var cliClientID = "github.com-vmware-priam"
 
-var cliClientRegistration = map[string]interface{}{"clientId": cliClientID, "secret": cliClientSecret,
-	"accessTokenTTL": 60 * 60, "authGrantTypes": "authorization_code refresh_token", "displayUserGrant": false,
-	"redirectUri": TokenCatcherURI, "refreshTokenTTL": 60 * 60 * 24 * 30, "scope": "openid user profile email admin"}
+// the CLI is registered as a public client without a secret, its authorization codes are protected with PKCE
+var cliClientRegistration = map[string]interface{}{"clientId": cliClientID,
+	"accessTokenTTL": 60 * 60, "authGrantTypes": "authorization_code refresh_token " + DeviceCodeGrantType,
+	"displayUserGrant": false, "redirectUri": TokenCatcherURI(DefaultTokenCatcherPort), "refreshTokenTTL": 60 * 60 * 24 * 30,
+	"scope": "openid user profile email admin"}
 
 var registerDescription = `Registers this application as an OAuth2 client in the target tenant so that
    the login option with authorization code flow can be used. You must be logged
-   in with a valid token with admin role. The following options are registered:
+   in with a valid token with admin role. The client is public: it has no secret, and
+   each authorization code is protected with PKCE. The following options are registered:
       client ID: ` + cliClientID + `
-      client secret: ` + cliClientSecret + `
       scope: ` + cliClientRegistration["scope"].(string) + `
       grant types: ` + cliClientRegistration["authGrantTypes"].(string) + `
       redirect URI: ` + cliClientRegistration["redirectUri"].(string) + `
@@ -72,6 +76,19 @@ var templateService OauthResource = AppTemplateService
 var clientService OauthResource = OauthClientService
 var tokenServiceFactory TokenServiceFactory = &TokenServiceFactoryImpl{}
 
+// port of the local listener for the authorization code login, must match the registered redirect URI
+var catcherPortFlag = cli.IntFlag{Name: "port", Value: DefaultTokenCatcherPort,
+	Usage: "local port to receive the authorization code on, 0 for any free port"}
+
+// set by the global dry-run option, applies to all authenticated requests
+var dryRun bool
+
+// times that requests are retried unless the global retries option is given
+const defaultRetries = 3
+
+// set by the global retries and timeout options, apply to all requests to the target
+var retries, timeout = defaultRetries, DefaultTimeout
+
 var getRawPassword = gopass.GetPasswd // called via variable so that tests can provide stub
 var consoleInput io.Reader = os.Stdin // will be set to other readers for tests
 
@@ -109,32 +126,101 @@ func getOptionalArg(log *Logr, prompt, arg string) string {
 	return scanner.Text()
 }
 
-func InitCtx(cfg *Config, authn bool) *HttpContext {
+// returns a function that asks the user to confirm a change, or nil if --yes was given
+func confirmUnlessYes(cfg *Config, c *cli.Context) func(prompt string) bool {
+	if c.Bool("yes") {
+		return nil
+	}
+	return func(prompt string) bool {
+		answer := strings.ToLower(strings.TrimSpace(getOptionalArg(cfg.Log, prompt+" [y/N]", "")))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+// InitCtx returns a context for requests to the current target, with the saved access token
+// if authn is set. Errors are printed, and returned with their kind.
+func InitCtx(cfg *Config, authn bool) (*HttpContext, error) {
 	if cfg.CurrentTarget == NoTarget {
 		cfg.Log.Err("Error: no target set\n")
-		return nil
+		return nil, NewError(ErrUsage, "no target set")
 	}
 	basePath := vidmBasePath
 	if cfg.IsTenantInHost() {
 		basePath = "/SAAS" + vidmBasePath
 	}
-	ctx := NewHttpContext(cfg.Log, cfg.Option(HostOption), basePath, vidmBaseMediaType)
+	ctx := NewHttpContext(cfg.Log, cfg.Option(HostOption), basePath, vidmBaseMediaType).Timeout(timeout)
+	ctx.Retries = retries
+	if err := ctx.TLS(cfg.TLSOptions()); err != nil {
+		cfg.Log.Err("Error in TLS settings of target: %v\n", err)
+		return nil, &Error{Kind: ErrUsage, Err: err}
+	}
+	if err := ctx.Proxy(cfg.ProxyOptions()); err != nil {
+		cfg.Log.Err("Error in proxy settings of target: %v\n", err)
+		return nil, &Error{Kind: ErrUsage, Err: err}
+	}
 	if authn {
 		if token := cfg.Option(accessTokenOption); token == "" {
 			cfg.Log.Err("No access token saved for current target. Please log in.\n")
-			return nil
+			return nil, NewError(ErrAuth, "no access token saved for current target")
 		} else {
+			// once the tokens could not be refreshed they are not refreshed again, so that
+			// the failure is reported once
+			canRefresh := true
+			if TokenExpired(token) {
+				if canRefresh = refreshTokens(cfg); canRefresh {
+					token = cfg.Option(accessTokenOption)
+				}
+			}
 			ctx.Authorization(cfg.Option(accessTokenTypeOption) + " " + token)
+			ctx.DryRun = dryRun
+			ctx.OnUnauthorized = func(ctx *HttpContext) bool {
+				if canRefresh = canRefresh && refreshTokens(cfg); !canRefresh {
+					return false
+				}
+				ctx.Authorization(cfg.Option(accessTokenTypeOption) + " " + cfg.Option(accessTokenOption))
+				return true
+			}
 		}
 	}
-	return ctx
+	return ctx, nil
 }
 
-func initArgs(cfg *Config, c *cli.Context, minArgs, maxArgs int, validateArgs func([]string) bool) []string {
+// gets new tokens with the saved refresh token and saves them. Returns false if there
+// is no refresh token or the tokens could not be refreshed. The refresh request is not
+// retried, a rejected refresh token is not accepted later.
+func refreshTokens(cfg *Config) bool {
+	refreshToken := cfg.Option(refreshTokenOption)
+	if refreshToken == "" {
+		return false
+	}
+	ctx, err := InitCtx(cfg, false)
+	if err != nil {
+		return false
+	}
+	ctx.Retries = 0
+	tokenService := tokenServiceFactory.GetTokenService(cfg, StringOrDefault(cfg.Option(clientIDOption), cliClientID))
+	tokenInfo, err := tokenService.RefreshTokenGrant(ctx, refreshToken)
+	if err != nil {
+		cfg.Log.Err("Error refreshing access token: %v\n", err)
+		return false
+	}
+	opts := map[string]string{accessTokenTypeOption: tokenInfo.AccessTokenType, accessTokenOption: tokenInfo.AccessToken}
+	if tokenInfo.RefreshToken != "" {
+		opts[refreshTokenOption] = tokenInfo.RefreshToken
+	}
+	if tokenInfo.IDToken != "" {
+		opts[idTokenOption] = tokenInfo.IDToken
+	}
+	cfg.Log.Debug("access token refreshed\n")
+	return cfg.WithOptions(opts).Save()
+}
+
+func initArgs(cfg *Config, c *cli.Context, minArgs, maxArgs int, validateArgs func([]string) bool) ([]string, error) {
 	args := c.Args()
 	if args == nil {
 		args = []string{}
 	}
+	err := NewError(ErrUsage, "invalid arguments")
 	if len(args) < minArgs {
 		cfg.Log.Err("\nInput Error: at least %d arguments must be given\n\n", minArgs)
 	} else if maxArgs >= 0 && len(args) > maxArgs {
@@ -144,42 +230,68 @@ func initArgs(cfg *Config, c *cli.Context, minArgs, maxArgs int, validateArgs fu
 			args = append(args, "")
 		}
 		if validateArgs == nil || validateArgs(args) {
-			return args
+			return args, nil
 		}
 	}
 	cli.ShowCommandHelp(c, c.Command.Name)
-	return nil
+	return nil, err
 }
 
-func initCmd(cfg *Config, c *cli.Context, minArgs, maxArgs int, authn bool, validateArgs func([]string) bool) (args []string, ctx *HttpContext) {
-	if args = initArgs(cfg, c, minArgs, maxArgs, validateArgs); args != nil {
-		ctx = InitCtx(cfg, authn)
+func initCmd(cfg *Config, c *cli.Context, minArgs, maxArgs int, authn bool, validateArgs func([]string) bool) (args []string, ctx *HttpContext, err error) {
+	if args, err = initArgs(cfg, c, minArgs, maxArgs, validateArgs); err == nil {
+		ctx, err = InitCtx(cfg, authn)
 	}
 	return
 }
 
-func initUserCmd(cfg *Config, c *cli.Context, getPwd bool) (*BasicUser, *HttpContext) {
+func initUserCmd(cfg *Config, c *cli.Context, getPwd bool) (*BasicUser, *HttpContext, error) {
 	maxArgs := 1
 	if getPwd {
 		maxArgs = 2
 	}
-	args := initArgs(cfg, c, 1, maxArgs, nil)
-	if args == nil {
-		return nil, nil
+	args, err := initArgs(cfg, c, 1, maxArgs, func([]string) bool {
+		for _, attr := range c.StringSlice("attribute") {
+			if i := strings.Index(attr, "="); i <= 0 {
+				cfg.Log.Err("\nInput Error: attribute must be given as name=value: %s\n\n", attr)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 	user := &BasicUser{Name: args[0], Given: c.String("given"),
-		Family: c.String("family"), Email: c.String("email")}
+		Family: c.String("family"), Email: c.String("email"), ExternalId: c.String("external-id")}
+	if phones := c.StringSlice("phone"); len(phones) > 0 {
+		user.Phones = phones
+	}
+	if c.IsSet("active") {
+		active := c.Bool("active")
+		user.Active = &active
+	}
+	for _, attr := range c.StringSlice("attribute") {
+		nv := strings.SplitN(attr, "=", 2)
+		user.SetAttribute(nv[0], nv[1])
+	}
 	if getPwd {
 		user.Pwd = getArgOrPassword(cfg.Log, "Password", args[1], true)
 	}
-	return user, InitCtx(cfg, true)
+	ctx, err := InitCtx(cfg, true)
+	return user, ctx, err
+}
+
+func makeBasicRole(c *cli.Context, name string) *BasicRole {
+	return &BasicRole{Name: name, Description: c.String("description"), Scopes: c.StringSlice("scope"),
+		Permissions: c.StringSlice("permission"), Members: c.StringSlice("member")}
 }
 
 func checkTarget(cfg *Config) bool {
-	ctx, output := InitCtx(cfg, false), ""
-	if ctx == nil {
+	ctx, err := InitCtx(cfg, false)
+	if err != nil {
 		return false
 	}
+	output := ""
 	if err := ctx.Request("GET", "health", nil, &output); err != nil {
 		ctx.Log.Err("Error checking health of %s: %v\n", ctx.HostURL, err)
 		return false
@@ -192,6 +304,56 @@ func checkTarget(cfg *Config) bool {
 	return true
 }
 
+// target flags for TLS and proxy settings, by the name of the target option they set
+var targetOptionFlags = map[string]string{CABundleOption: "ca-bundle", FingerprintOption: "fingerprint",
+	ClientCertOption: "client-cert", ClientKeyOption: "client-key", InsecureOption: "insecure",
+	ProxyOption: "proxy", ProxyUserOption: "proxy-user", ProxyPasswordOption: "proxy-password"}
+
+// returns the TLS and proxy options given to the target command, or nil if there are none. Empty
+// values and --insecure=false remove an option.
+func targetOptions(c *cli.Context) map[string]string {
+	var options map[string]string
+	for option, flag := range targetOptionFlags {
+		if c.IsSet(flag) {
+			if options == nil {
+				options = make(map[string]string)
+			}
+			if option == InsecureOption {
+				options[option] = map[bool]string{true: "true"}[c.Bool(flag)]
+			} else {
+				options[option] = c.String(flag)
+			}
+		}
+	}
+	return options
+}
+
+// sets the given options of the current target, removing options with empty values
+func setTargetOptions(cfg *Config, options map[string]string) *Config {
+	for k, v := range options {
+		if v == "" {
+			cfg.WithoutOptions(k)
+		} else {
+			cfg.WithOptions(map[string]string{k: v})
+		}
+	}
+	return cfg
+}
+
+// checks that the files of the TLS options of the current target can be read, the fingerprint
+// and the proxy URL are valid
+func checkTargetOptions(cfg *Config) error {
+	if _, err := cfg.TLSOptions().TLSConfig(); err != nil {
+		cfg.Log.Err("Error in TLS settings of target: %v\n", err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	if _, err := cfg.ProxyOptions().ProxyFunc(); err != nil {
+		cfg.Log.Err("Error in proxy settings of target: %v\n", err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	return nil
+}
+
 func makeOptionMap(c *cli.Context, flags []cli.Flag, name, value string) map[string]interface{} {
 	omap := map[string]interface{}{name: value}
 	for _, flag := range flags {
@@ -209,22 +371,90 @@ func makeOptionMap(c *cli.Context, flags []cli.Flag, name, value string) map[str
 	return omap
 }
 
-func cmdWithAuth1Arg(cfg *Config, cmd func(*HttpContext, string)) func(c *cli.Context) error {
+func cmdWithAuth1Arg(cfg *Config, cmd func(*HttpContext, string) error) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
-		if args, ctx := initCmd(cfg, c, 1, 1, true, nil); ctx != nil {
-			cmd(ctx, args[0])
+		args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+		if err != nil {
+			return err
 		}
-		return nil
+		return cmd(ctx, args[0])
+	}
+}
+
+// returns an action that changes the status of the user given as argument, or of all users
+// that match the filter given with --filter
+func cmdUserStatus(cfg *Config, change UserStatusChange) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		args, ctx, err := initCmd(cfg, c, 0, 1, true, func(args []string) bool {
+			return validUserOrFilter(cfg, c, args[0])
+		})
+		if err != nil {
+			return err
+		}
+		return SetUserStatus(ctx, change, args[0], c.String("filter"))
 	}
 }
 
-func cmdWithAuth0Arg(cfg *Config, cmd func(*HttpContext)) func(c *cli.Context) error {
+// checks that either a user name or a filter is given, but not both
+func validUserOrFilter(cfg *Config, c *cli.Context, name string) bool {
+	if (name == "") == (c.String("filter") == "") {
+		cfg.Log.Err("\nInput Error: either a user name or --filter must be given\n\n")
+		return false
+	}
+	return true
+}
+
+// returns an action that adds or deletes the entitlement of a user or group to an app
+func cmdEntitlement(cfg *Config, remove bool) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
-		if _, ctx := initCmd(cfg, c, 0, 0, true, nil); ctx != nil {
-			cmd(ctx)
+		args, ctx, err := initCmd(cfg, c, 3, 3, true, func(args []string) bool {
+			if !HasString(args[0], []string{"user", "group"}) {
+				cfg.Log.Err("\nInput Error: first parameter must be user or group\n\n")
+				return false
+			}
+			if _, ok := ActivationPolicies[c.String("activation")]; !remove && !ok {
+				cfg.Log.Err("\nInput Error: activation must be automatic or user\n\n")
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return err
 		}
+		ent := Entitlement{App: args[2], Activation: c.String("activation")}
+		if args[0] == "user" {
+			ent.User = args[1]
+		} else {
+			ent.Group = args[1]
+		}
+		return UpdateEntitlements(ctx, []Entitlement{ent}, remove)
+	}
+}
+
+func cmdWithAuth0Arg(cfg *Config, cmd func(*HttpContext) error) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+		if err != nil {
+			return err
+		}
+		return cmd(ctx)
+	}
+}
+
+// errors getting tokens are authentication errors, unless the server could not be reached
+func loginError(err error) error {
+	if KindOf(err) == ErrNetwork {
+		return err
+	}
+	return &Error{Kind: ErrAuth, Err: err}
+}
+
+// returns an error of the given kind if a step that has already printed its errors failed
+func checkOK(ok bool, kind ErrorKind, format string, args ...interface{}) error {
+	if ok {
 		return nil
 	}
+	return NewError(kind, format, args...)
 }
 
 // User has requested a custom identity provider client id (login or token commands).  So
@@ -235,7 +465,34 @@ func updateClientID(clientID string) {
 	cliClientID = clientID
 }
 
-func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
+// errors returned by command actions have already been printed, only their kind is needed
+type reportedError struct{ error }
+
+func (e reportedError) Unwrap() error {
+	return e.error
+}
+
+// wraps the actions of the commands and their subcommands so that their errors are marked as reported
+func markErrorsReported(cmds []cli.Command) {
+	for i := range cmds {
+		if action, ok := cmds[i].Action.(func(*cli.Context) error); ok {
+			cmds[i].Action = func(c *cli.Context) error {
+				if err := action(c); err != nil {
+					return reportedError{err}
+				}
+				return nil
+			}
+		}
+		markErrorsReported(cmds[i].Subcommands)
+	}
+}
+
+/* Priam runs the command given by args and returns the exit status: 0 on success, or the
+   ErrorKind of the error otherwise -- 1 for general errors, 2 for usage errors such as
+   invalid arguments or input files, 3 for authentication errors, 4 if a resource was not
+   found, 5 for conflicts such as an existing resource, and 6 if the server could not be reached.
+*/
+func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) int {
 	var err error
 	cfg := &Config{}
 
@@ -250,7 +507,11 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 	app.Flags = []cli.Flag{
 		cli.StringFlag{Name: "config", Usage: "specify config file. Def: " + defaultCfgFile},
 		cli.BoolFlag{Name: "debug, d", Usage: "print debug output"},
+		cli.BoolFlag{Name: "dry-run", Usage: "print requests that would change the tenant instead of sending them"},
 		cli.BoolFlag{Name: "json, j", Usage: "prefer output in json rather than yaml"},
+		cli.StringFlag{Name: "output, o", Usage: "output format: table, csv, json, yaml, jsonpath=<expression> or template=<Go template>"},
+		cli.IntFlag{Name: "retries", Value: defaultRetries, Usage: "times to retry requests that failed with a temporary error"},
+		cli.DurationFlag{Name: "timeout", Value: DefaultTimeout, Usage: "time allowed for each request, like 30s or 2m, 0 for no limit"},
 		cli.BoolFlag{Name: "trace, t", Usage: "print all requests and responses"},
 		cli.BoolFlag{Name: "verbose, V", Usage: "print verbose output"},
 	}
@@ -260,8 +521,25 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 		if c.Bool("json") {
 			log.Style = LJson
 		}
+		if format := c.String("output"); format != "" {
+			if log.Style, log.Projection, err = ParseOutputFormat(format); err != nil {
+				return err
+			}
+			log.NoTitles = log.Style != LTable
+		}
+		dryRun, retries, timeout = c.Bool("dry-run"), c.Int("retries"), c.Duration("timeout")
+		if retries < 0 {
+			return NewError(ErrUsage, "retries must not be negative")
+		}
 		if !cfg.Init(log, StringOrDefault(c.String("config"), defaultCfgFile)) {
-			return fmt.Errorf("app initialization failed\n")
+			return NewError(ErrGeneral, "app initialization failed\n")
+		}
+		cfg.SecretOptions = []string{accessTokenOption, refreshTokenOption, idTokenOption, ProxyPasswordOption}
+		cfg.Passphrase = func(confirm bool) (string, error) {
+			if pass := os.Getenv(passphraseEnvVar); pass != "" {
+				return pass, nil
+			}
+			return getArgOrPassword(cfg.Log, "Passphrase for secrets file", "", confirm), nil
 		}
 		return nil
 	}
@@ -271,6 +549,13 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 		cli.StringFlag{Name: "filter", Usage: "filter such as 'username eq \"joe\"' for SCIM resources"},
 	}
 
+	scimPageFlags := append([]cli.Flag{
+		cli.IntFlag{Name: "page-size", Usage: "entries to get per request, all entries are fetched page by page"},
+		cli.IntFlag{Name: "start-index", Usage: "1-based index of the first entry to get"},
+	}, pageFlags...)
+
+	userFilterFlag := cli.StringFlag{Name: "filter", Usage: "filter such as 'groups eq \"contractors\"' to change all matching users"}
+
 	memberFlags := []cli.Flag{
 		cli.BoolFlag{Name: "delete, d", Usage: "delete member"},
 	}
@@ -278,6 +563,20 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 	userAttrFlags := []cli.Flag{cli.StringFlag{Name: "email", Usage: "email of the user account"},
 		cli.StringFlag{Name: "family", Usage: "family name of the user account"},
 		cli.StringFlag{Name: "given", Usage: "given name of the user account"},
+		cli.BoolFlag{Name: "active", Usage: "whether the user account is active, --active=false to deactivate it"},
+		cli.StringFlag{Name: "external-id", Usage: "id of the user account in an external system"},
+		cli.StringSliceFlag{Name: "phone", Usage: "phone number of the user account, can be repeated"},
+		cli.StringSliceFlag{Name: "attribute, a", Usage: "name=value of another attribute, named <schemaURN>:<name> in an extension schema, can be repeated"},
+	}
+
+	groupAttrFlags := []cli.Flag{cli.StringFlag{Name: "description", Usage: "description of the group"},
+		cli.StringSliceFlag{Name: "member, m", Usage: "name of a user to add to the group, can be repeated"},
+	}
+
+	roleAttrFlags := []cli.Flag{cli.StringFlag{Name: "description", Usage: "description of the role"},
+		cli.StringSliceFlag{Name: "member, m", Usage: "name of a user to add to the role, can be repeated"},
+		cli.StringSliceFlag{Name: "permission, p", Usage: "permission granted by the role, can be repeated"},
+		cli.StringSliceFlag{Name: "scope, s", Usage: "scope granted by the role, can be repeated"},
 	}
 
 	templateFlags := []cli.Flag{
@@ -314,12 +613,47 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 			Subcommands: []cli.Command{
 				{
 					Name: "add", Usage: "add applications to the catalog", ArgsUsage: "<manifestYAMLFile>",
-					Action: cmdWithAuth1Arg(cfg, appsService.Publish),
+					Description: "Adds the applications of the manifest, or updates them if they exist, and entitles the\n" +
+						"   users and groups of the manifest to them. Example entitlements in the workspace section:\n" +
+						"entitleGroups: [ALL USERS, {name: dancers, activation: user}]\nentitleUsers: [joe]\n",
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "revoke", Usage: "remove entitlements to the applications that are not in the manifest"},
+					},
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
+						}
+						return appsService.Publish(ctx, args[0], c.Bool("revoke"))
+					},
 				},
 				{
 					Name: "delete", Usage: "delete an app from the catalog", ArgsUsage: "<appName>",
 					Action: cmdWithAuth1Arg(cfg, appsService.Delete),
 				},
+				{
+					Name: "export", Usage: "write apps of the catalog as a manifest", ArgsUsage: "<appName|--all>",
+					Description: "Writes the app, or all apps with --all, as a manifest that can be added again, to\n" +
+						"   another tenant as well. Icons are written to files in the directory of the manifest.\n" +
+						"   The -o option given after the command is the manifest file, not the output format.",
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "all", Usage: "export all apps of the catalog"},
+						cli.StringFlag{Name: "output, o, file", Usage: "file to write the manifest to, instead of printing it"},
+					},
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 0, 1, true, func(args []string) bool {
+							if (args[0] == "") == !c.Bool("all") {
+								cfg.Log.Err("\nInput Error: either an app name or --all must be given\n\n")
+								return false
+							}
+							return true
+						})
+						if err != nil {
+							return err
+						}
+						return appsService.Export(ctx, args[0], c.String("output"))
+					},
+				},
 				{
 					Name: "get", Usage: "get information about an app", ArgsUsage: "<appName>",
 					Action: cmdWithAuth1Arg(cfg, appsService.Display),
@@ -328,14 +662,94 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 					Name: "list", Usage: "list all applications in the catalog", ArgsUsage: " ",
 					Flags: pageFlags,
 					Action: func(c *cli.Context) error {
-						if _, ctx := initCmd(cfg, c, 0, 0, true, nil); ctx != nil {
-							appsService.List(ctx, c.Int("count"), c.String("filter"))
+						_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return appsService.List(ctx, c.Int("count"), c.String("filter"))
 					},
 				},
 			},
 		},
+		{
+			Name: "apply", Usage: "make users, groups and roles match a state file", ArgsUsage: "<stateYAMLFile>",
+			Description: "Creates or updates users, groups and roles so that the tenant matches the file.\n" +
+				"   Example yaml file content:\n---\nusers:\n- {name: joe, given: joseph, email: joe@what.com}\n" +
+				"groups:\n- {name: dancers, description: all the dancers, members: [joe]}\n" +
+				"roles:\n- {name: Administrator, members: [joe]}\n",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "prune", Usage: "delete users and groups, and remove members, not in the file"},
+				cli.BoolFlag{Name: "yes, y", Usage: "delete without asking for confirmation"},
+			},
+			Action: func(c *cli.Context) error {
+				args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+				if err != nil {
+					return err
+				}
+				return ApplyState(ctx, args[0], c.Bool("prune"), confirmUnlessYes(cfg, c))
+			},
+		},
+		{
+			Name: "diff", Usage: "show differences between the resources of two targets", ArgsUsage: "<targetA> <targetB>",
+			Description: "Resources are matched by name. Resources only in targetA are shown with '-', only in\n" +
+				"   targetB with '+', and resources in both with fields that differ with '~' and the\n" +
+				"   fields. Fields generated by the server, such as id, meta and _links, and references\n" +
+				"   by uuid are ignored, and secrets are redacted.",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{Name: "kind, k", Usage: "kind of resources to compare, all if not given: " + strings.Join(DiffKinds, ", ")},
+			},
+			Action: func(c *cli.Context) error {
+				args, err := initArgs(cfg, c, 2, 2, func(args []string) bool {
+					for _, name := range args {
+						if _, ok := cfg.Targets[name]; !ok {
+							cfg.Log.Err("\nInput Error: no target named \"%s\"\n\n", name)
+							return false
+						}
+					}
+					return true
+				})
+				if err != nil {
+					return err
+				}
+				ctxA, err := InitCtx(cfg.ForTarget(args[0]), true)
+				if err != nil {
+					return err
+				}
+				ctxB, err := InitCtx(cfg.ForTarget(args[1]), true)
+				if err != nil {
+					return err
+				}
+				return DiffTargets(ctxA, ctxB, args[0], args[1], c.StringSlice("kind"))
+			},
+		},
+		{
+			Name: "export", Usage: "export users, groups or roles to files that can be loaded",
+			ArgsUsage: strings.Join(ExportKinds, "|"),
+			Description: "Writes users, groups or roles in the format read by the load commands, to standard\n" +
+				"   output or to the file given with --file. Members of groups and roles are exported\n" +
+				"   with them, not with the users, so users should be loaded first, and memberships are\n" +
+				"   lost if only users are exported. Passwords, built-in groups and groups synced from\n" +
+				"   a directory are not exported. With 'all', users, groups and roles are written to\n" +
+				"   files in the directory given with --file, and groups and roles are written as yaml\n" +
+				"   if the format is csv.",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "format, f", Value: YamlFormat, Usage: "format of the output: " + strings.Join(ExportFormats, ", ")},
+				cli.StringFlag{Name: "file", Usage: "file to write to, or directory for 'all'"},
+			},
+			Action: func(c *cli.Context) error {
+				args, ctx, err := initCmd(cfg, c, 1, 1, true, func(args []string) bool {
+					if !HasString(strings.ToLower(args[0]), ExportKinds) {
+						cfg.Log.Err("\nInput Error: what to export must be one of %s\n\n", strings.Join(ExportKinds, ", "))
+						return false
+					}
+					return true
+				})
+				if err != nil {
+					return err
+				}
+				return ExportEntities(ctx, args[0], c.String("format"), c.String("file"))
+			},
+		},
 		{
 			Name: "client", Usage: "oauth2 client application commands",
 			Subcommands: []cli.Command{
@@ -343,11 +757,12 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 					Name: "add", Usage: "create an oauth2 client app", ArgsUsage: "<clientId>",
 					Flags: clientFlags,
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 1, 1, true, nil); ctx != nil {
-							clientService.Add(ctx, args[0],
-								makeOptionMap(c, clientFlags, "clientId", args[0]))
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return clientService.Add(ctx, args[0],
+							makeOptionMap(c, clientFlags, "clientId", args[0]))
 					},
 				},
 				{
@@ -365,29 +780,100 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 				{
 					Name: "register", Usage: "register priam as an oauth2 client", ArgsUsage: " ",
 					Description: registerDescription,
-					Action: cmdWithAuth0Arg(cfg, func(ctx *HttpContext) {
-						clientService.Add(ctx, cliClientID, cliClientRegistration)
-					}),
+					Flags:       []cli.Flag{catcherPortFlag},
+					Action: func(c *cli.Context) error {
+						_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+						if err != nil {
+							return err
+						}
+						registration := map[string]interface{}{"redirectUri": TokenCatcherURI(c.Int("port"))}
+						for k, v := range cliClientRegistration {
+							if k != "redirectUri" {
+								registration[k] = v
+							}
+						}
+						return clientService.Add(ctx, cliClientID, registration)
+					},
 				},
 			},
 		},
 		{
 			Name: "entitlement", Usage: "commands for entitlements",
 			Subcommands: []cli.Command{
+				{
+					Name: "add", ArgsUsage: "(user|group) <name> <appName>",
+					Usage: "entitles a user or group to an app",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "activation", Value: "automatic", Usage: "activation policy of the entitlement: automatic or user"},
+					},
+					Action: cmdEntitlement(cfg, false),
+				},
+				{
+					Name: "delete", ArgsUsage: "(user|group) <name> <appName>",
+					Usage:  "deletes the entitlement of a user or group to an app",
+					Action: cmdEntitlement(cfg, true),
+				},
 				{
 					Name: "get", ArgsUsage: "(group|user|app) <name>",
 					Usage: "gets entitlements for a specific user, app, or group",
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 2, 2, true, func(args []string) bool {
+						args, ctx, err := initCmd(cfg, c, 2, 2, true, func(args []string) bool {
 							res := HasString(args[0], []string{"group", "user", "app"})
 							if !res {
 								cfg.Log.Err("First parameter of 'get' must be user, group or app\n")
 							}
 							return res
-						}); ctx != nil {
-							GetEntitlement(ctx, args[0], args[1])
+						})
+						if err != nil {
+							return err
+						}
+						return GetEntitlement(ctx, args[0], args[1])
+					},
+				},
+				{
+					Name: "report", ArgsUsage: " ", Usage: "shows which users can access which apps",
+					Description: "Shows a row for each user and app the user can access, with the group the user\n" +
+						"   is entitled through, empty if entitled directly, and the activation policy.",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "app", Usage: "only report the access to this app"},
+						cli.StringFlag{Name: "user", Usage: "only report the access of this user"},
+						cli.StringFlag{Name: "group", Usage: "only report the access given by this group"},
+						cli.StringFlag{Name: "format, f", Value: YamlFormat, Usage: "format of the report: " + strings.Join(ReportFormats, ", ")},
+					},
+					Action: func(c *cli.Context) error {
+						_, ctx, err := initCmd(cfg, c, 0, 0, true, func([]string) bool {
+							filters := 0
+							for _, name := range []string{"app", "user", "group"} {
+								if c.String(name) != "" {
+									filters++
+								}
+							}
+							if filters > 1 {
+								cfg.Log.Err("\nInput Error: only one of --app, --user and --group can be given\n\n")
+								return false
+							}
+							return true
+						})
+						if err != nil {
+							return err
 						}
-						return nil
+						return ReportEntitlements(ctx, c.String("app"), c.String("user"), c.String("group"), c.String("format"))
+					},
+				},
+				{
+					Name: "load", ArgsUsage: "<fileName>",
+					Usage: "adds or deletes the entitlements of a yaml file in one request",
+					Description: "Example yaml file content:\n---\n- {user: joe, app: crm}\n" +
+						"- {group: dancers, app: crm, activation: user}\n\n" +
+						"The activation policy is automatic or user, automatic if not given. With --delete,\n" +
+						"the entitlements are deleted.",
+					Flags: []cli.Flag{cli.BoolFlag{Name: "delete, d", Usage: "delete the entitlements of the file"}},
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
+						}
+						return LoadEntitlements(ctx, args[0], c.Bool("delete"))
 					},
 				},
 			},
@@ -395,27 +881,70 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 		{
 			Name: "group", Usage: "commands for groups",
 			Subcommands: []cli.Command{
+				{
+					Name: "add", Usage: "create a group", ArgsUsage: "<groupName>",
+					Flags: groupAttrFlags,
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
+						}
+						return groupsService.AddEntity(ctx, &BasicGroup{Name: args[0],
+							Description: c.String("description"), Members: c.StringSlice("member")})
+					},
+				},
+				{
+					Name: "delete", Usage: "delete a group", ArgsUsage: "<groupName>",
+					Action: cmdWithAuth1Arg(cfg, groupsService.DeleteEntity),
+				},
 				{
 					Name: "get", Usage: "get a specific group", ArgsUsage: "get <groupName>",
 					Action: cmdWithAuth1Arg(cfg, groupsService.DisplayEntity),
 				},
 				{
-					Name: "list", Usage: "list all groups", ArgsUsage: " ", Flags: pageFlags,
+					Name: "list", Usage: "list all groups", ArgsUsage: " ", Flags: scimPageFlags,
 					Action: func(c *cli.Context) error {
-						if _, ctx := initCmd(cfg, c, 0, 0, true, nil); ctx != nil {
-							groupsService.ListEntities(ctx, c.Int("count"), c.String("filter"))
+						_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return groupsService.ListEntities(ctx, c.Int("count"), c.Int("start-index"), c.Int("page-size"), c.String("filter"))
 					},
 				},
 				{
 					Name: "member", Usage: "add or remove users from a group",
 					ArgsUsage: "<groupname> <username>", Flags: memberFlags,
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 2, 2, true, nil); ctx != nil {
-							groupsService.UpdateMember(ctx, args[0], args[1], c.Bool("delete"))
+						args, ctx, err := initCmd(cfg, c, 2, 2, true, nil)
+						if err != nil {
+							return err
+						}
+						return groupsService.UpdateMember(ctx, args[0], args[1], c.Bool("delete"))
+					},
+				},
+				{
+					Name: "load", ArgsUsage: "<fileName>", Usage: "loads yaml file of an array of groups.",
+					Description: "Example yaml file content:\n---\n- {name: dancers, description: all dancers}\n" +
+						"- {name: singers, members: [joe, sue]}\n\n" +
+						"Groups that already exist are updated.",
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return groupsService.LoadEntities(ctx, args[0], LoadOptions{})
+					},
+				},
+				{
+					Name: "update", Usage: "update a group", ArgsUsage: "<groupName>",
+					Flags: append([]cli.Flag{cli.StringFlag{Name: "name", Usage: "new name of the group"}}, groupAttrFlags...),
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
+						}
+						return groupsService.UpdateEntity(ctx, args[0], &BasicGroup{Name: c.String("name"),
+							Description: c.String("description"), Members: c.StringSlice("member")})
 					},
 				},
 			},
@@ -423,20 +952,22 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 		{
 			Name: "health", Usage: "check workspace service health", ArgsUsage: " ",
 			Action: func(c *cli.Context) error {
-				if _, ctx := initCmd(cfg, c, 0, 0, false, nil); ctx != nil {
-					HealthCheck(ctx)
+				_, ctx, err := initCmd(cfg, c, 0, 0, false, nil)
+				if err != nil {
+					return err
 				}
-				return nil
+				return HealthCheck(ctx)
 			},
 		},
 		{
 			Name: "localuserstore", Usage: "gets/sets local user store configuration",
 			ArgsUsage: "[key=value]...",
 			Action: func(c *cli.Context) error {
-				if args, ctx := initCmd(cfg, c, 0, -1, true, nil); ctx != nil {
-					CmdLocalUserStore(ctx, args)
+				args, ctx, err := initCmd(cfg, c, 0, -1, true, nil)
+				if err != nil {
+					return err
 				}
-				return nil
+				return CmdLocalUserStore(ctx, args)
 			},
 		},
 		{
@@ -446,85 +977,141 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 			Flags: []cli.Flag{
 				cli.BoolFlag{Name: "authcode, a", Usage: "use browser to authenticate via oauth2 authorization code grant"},
 				cli.BoolFlag{Name: "client, c", Usage: "authenticate with oauth2 client ID and secret"},
+				cli.BoolFlag{Name: "device, d", Usage: "authenticate in a browser on any device via oauth2 device authorization grant"},
+				catcherPortFlag,
 				cli.StringFlag{Name: "id, i", Usage: "Override client id, default is " + cliClientID},
 			},
-			Action: func(c *cli.Context) (err error) {
-				if a, ctx := initCmd(cfg, c, 0, 2, false, nil); ctx != nil {
-					if c.String("id") != "" {
-						updateClientID(c.String("id"))
+			Action: func(c *cli.Context) error {
+				a, ctx, err := initCmd(cfg, c, 0, 2, false, nil)
+				if err != nil {
+					return err
+				}
+				if c.String("id") != "" {
+					updateClientID(c.String("id"))
+				}
+				tokenInfo := TokenInfo{}
+				tokenService := tokenServiceFactory.GetTokenService(cfg, cliClientID)
+				if c.Bool("authcode") {
+					if tokenInfo, err = tokenService.AuthCodeGrant(ctx, a[0], c.Int("port")); err != nil {
+						cfg.Log.Err("Error getting tokens via browser: %v\n", err)
+						return loginError(err)
 					}
-					tokenInfo := TokenInfo{}
-					tokenService := tokenServiceFactory.GetTokenService(cfg, cliClientID, cliClientSecret)
-					if c.Bool("authcode") {
-						if tokenInfo, err = tokenService.AuthCodeGrant(ctx, a[0]); err != nil {
-							cfg.Log.Err("Error getting tokens via browser: %v\n", err)
-							return nil
-						}
-					} else {
-						promptN, promptP, loginFunc := "Username", "Password", tokenService.LoginSystemUser
-						if c.Bool("client") {
-							promptN, promptP, loginFunc = "Client ID", "Secret", tokenService.ClientCredentialsGrant
-						}
-						name := getOptionalArg(cfg.Log, promptN, a[0])
-						pwd := getArgOrPassword(cfg.Log, promptP, a[1], false)
-						if tokenInfo, err = loginFunc(ctx, name, pwd); err != nil {
-							cfg.Log.Err("Error getting access token: %v\n", err)
-							return nil
-						}
+				} else if c.Bool("device") {
+					if tokenInfo, err = tokenService.DeviceAuthorizationGrant(ctx); err != nil {
+						cfg.Log.Err("Error getting tokens via device authorization: %v\n", err)
+						return loginError(err)
 					}
-					opts := map[string]string{accessTokenTypeOption: tokenInfo.AccessTokenType,
-						accessTokenOption: tokenInfo.AccessToken, refreshTokenOption: tokenInfo.RefreshToken,
-						idTokenOption: tokenInfo.IDToken}
-					if cfg.WithOptions(opts).Save() {
-						cfg.Log.Info("Access token saved\n")
+				} else {
+					promptN, promptP, loginFunc := "Username", "Password", tokenService.LoginSystemUser
+					if c.Bool("client") {
+						promptN, promptP, loginFunc = "Client ID", "Secret", tokenService.ClientCredentialsGrant
 					}
+					name := getOptionalArg(cfg.Log, promptN, a[0])
+					pwd := getArgOrPassword(cfg.Log, promptP, a[1], false)
+					if tokenInfo, err = loginFunc(ctx, name, pwd); err != nil {
+						cfg.Log.Err("Error getting access token: %v\n", err)
+						return loginError(err)
+					}
+				}
+				opts := map[string]string{accessTokenTypeOption: tokenInfo.AccessTokenType,
+					accessTokenOption: tokenInfo.AccessToken, refreshTokenOption: tokenInfo.RefreshToken,
+					idTokenOption: tokenInfo.IDToken, clientIDOption: cliClientID}
+				if !cfg.WithOptions(opts).Save() {
+					return NewError(ErrGeneral, "could not save access token")
 				}
+				cfg.Log.Info("Access token saved\n")
 				return nil
 			},
 		},
 		{
 			Name: "logout", Usage: "deletes access token from configuration store for current target",
 			Action: func(c *cli.Context) error {
-				if args := initArgs(cfg, c, 0, 0, nil); args != nil &&
-					cfg.WithoutOptions(accessTokenTypeOption, accessTokenOption, refreshTokenOption, idTokenOption).Save() {
-					cfg.Log.Info("Access token removed\n")
+				if _, err := initArgs(cfg, c, 0, 0, nil); err != nil {
+					return err
 				}
+				if !cfg.WithoutOptions(accessTokenTypeOption, accessTokenOption, refreshTokenOption, idTokenOption,
+					clientIDOption).Save() {
+					return NewError(ErrGeneral, "could not remove access token")
+				}
+				cfg.Log.Info("Access token removed\n")
 				return nil
 			},
 		},
 		{
 			Name: "policies", Usage: "get access policies", ArgsUsage: " ",
 			Action: func(c *cli.Context) error {
-				if _, ctx := initCmd(cfg, c, 0, 0, true, nil); ctx != nil {
-					ctx.GetPrintJson("Access Policies", "accessPolicies", "accesspolicyset.list")
+				_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+				if err != nil {
+					return err
 				}
-				return nil
+				return ctx.GetPrintJson("Access Policies", "accessPolicies", "accesspolicyset.list")
 			},
 		},
 		{
 			Name: "role", Usage: "commands for roles",
 			Subcommands: []cli.Command{
+				{
+					Name: "add", Usage: "create a role", ArgsUsage: "<roleName>",
+					Flags: roleAttrFlags,
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
+						}
+						return rolesService.AddEntity(ctx, makeBasicRole(c, args[0]))
+					},
+				},
+				{
+					Name: "delete", Usage: "delete a role", ArgsUsage: "<roleName>",
+					Action: cmdWithAuth1Arg(cfg, rolesService.DeleteEntity),
+				},
 				{
 					Name: "get", Usage: "get specific SCIM role", ArgsUsage: "<roleName>",
 					Action: cmdWithAuth1Arg(cfg, rolesService.DisplayEntity),
 				},
 				{
-					Name: "list", ArgsUsage: " ", Usage: "list all roles", Flags: pageFlags,
+					Name: "list", ArgsUsage: " ", Usage: "list all roles", Flags: scimPageFlags,
 					Action: func(c *cli.Context) error {
-						if _, ctx := initCmd(cfg, c, 0, 0, true, nil); ctx != nil {
-							rolesService.ListEntities(ctx, c.Int("count"), c.String("filter"))
+						_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return rolesService.ListEntities(ctx, c.Int("count"), c.Int("start-index"), c.Int("page-size"), c.String("filter"))
 					},
 				},
 				{
 					Name: "member", Usage: "add or remove users from a role",
 					ArgsUsage: "<rolename> <username>", Flags: memberFlags,
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 2, 2, true, nil); ctx != nil {
-							rolesService.UpdateMember(ctx, args[0], args[1], c.Bool("delete"))
+						args, ctx, err := initCmd(cfg, c, 2, 2, true, nil)
+						if err != nil {
+							return err
+						}
+						return rolesService.UpdateMember(ctx, args[0], args[1], c.Bool("delete"))
+					},
+				},
+				{
+					Name: "load", ArgsUsage: "<fileName>", Usage: "loads yaml file of an array of roles.",
+					Description: "Example yaml file content:\n---\n- {name: auditor, description: read only access}\n" +
+						"- {name: helpdesk, scopes: [user], permissions: [password.reset], members: [joe]}\n\n" +
+						"Roles that already exist are updated.",
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return rolesService.LoadEntities(ctx, args[0], LoadOptions{})
+					},
+				},
+				{
+					Name: "update", Usage: "update a role", ArgsUsage: "<roleName>",
+					Flags: append([]cli.Flag{cli.StringFlag{Name: "name", Usage: "new name of the role"}}, roleAttrFlags...),
+					Action: func(c *cli.Context) error {
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
+						}
+						return rolesService.UpdateEntity(ctx, args[0], makeBasicRole(c, c.String("name")))
 					},
 				},
 			},
@@ -541,20 +1128,65 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 				cli.BoolFlag{Name: "force, f", Usage: "force target -- don't validate URL with health check"},
 				cli.BoolFlag{Name: "delete, d", Usage: "delete specified or current target"},
 				cli.BoolFlag{Name: "delete-all", Usage: "delete all targets"},
+				cli.StringFlag{Name: "secret-store, s", Usage: "keep tokens of the target in the given store: " +
+					strings.Join(SecretStores, ", ")},
+				cli.StringFlag{Name: "ca-bundle", Usage: "file of PEM encoded CA certificates to trust for the target"},
+				cli.StringFlag{Name: "fingerprint", Usage: "SHA-256 fingerprint of the target certificate to trust, even if self-signed"},
+				cli.StringFlag{Name: "client-cert", Usage: "file of PEM encoded client certificate for mutual TLS"},
+				cli.StringFlag{Name: "client-key", Usage: "file of PEM encoded private key of the client certificate"},
+				cli.BoolFlag{Name: "insecure, k", Usage: "do not verify the certificate of the target, use --insecure=false to verify again"},
+				cli.StringFlag{Name: "proxy", Usage: "URL of the proxy to the target, http://host:port or socks5://host:port"},
+				cli.StringFlag{Name: "proxy-user", Usage: "user to authenticate to the proxy, the password is prompted for if not given"},
+				cli.StringFlag{Name: "proxy-password", Usage: "password of the proxy user"},
 			},
 			Action: func(c *cli.Context) error {
-				if args := initArgs(cfg, c, 0, 2, nil); args != nil {
-					if c.Bool("delete-all") {
-						cfg.Clear()
-					} else if c.Bool("delete") {
-						cfg.DeleteTarget(args[0], args[1])
-					} else if args[0] == "" {
+				args, err := initArgs(cfg, c, 0, 2, nil)
+				if err != nil {
+					return err
+				}
+				store, options, targetSet := c.String("secret-store"), targetOptions(c), true
+				if options != nil && (c.Bool("delete-all") || c.Bool("delete")) {
+					cfg.Log.Err("TLS and proxy options can not be given when deleting targets\n")
+					return NewError(ErrUsage, "TLS and proxy options can not be given when deleting targets")
+				}
+				if options[ProxyUserOption] != "" && !c.IsSet("proxy-password") {
+					options[ProxyPasswordOption] = getArgOrPassword(cfg.Log, "Proxy password", "", false)
+				}
+				// new targets need their TLS options for the health check
+				check := func(cfg *Config) bool {
+					if setTargetOptions(cfg, options); c.Bool("force") {
+						return checkTargetOptions(cfg) == nil
+					}
+					return checkTarget(cfg)
+				}
+				if c.Bool("delete-all") {
+					cfg.Clear()
+				} else if c.Bool("delete") {
+					cfg.DeleteTarget(args[0], args[1])
+				} else if args[0] == "" {
+					if store == "" && options == nil {
 						cfg.PrintTarget("current")
-					} else if c.Bool("force") {
-						cfg.SetTarget(args[0], args[1], nil)
-					} else {
-						cfg.SetTarget(args[0], args[1], checkTarget)
 					}
+				} else {
+					targetSet = cfg.SetTarget(args[0], args[1], check)
+				}
+				if err = checkOK(targetSet, ErrGeneral, "could not set target %s", args[0]); err != nil {
+					return err
+				}
+				if options != nil && !c.Bool("delete-all") && !c.Bool("delete") {
+					if err = checkOK(cfg.CurrentTarget != NoTarget, ErrUsage, "no target set"); err != nil {
+						cfg.Log.Err("Error: no target set\n")
+						return err
+					}
+					if err = checkTargetOptions(setTargetOptions(cfg, options)); err != nil {
+						return err
+					}
+					if err = checkOK(cfg.Save(), ErrGeneral, "could not save target options"); err != nil {
+						return err
+					}
+				}
+				if store != "" && !c.Bool("delete-all") && !c.Bool("delete") {
+					return checkOK(cfg.SetSecretStore(store), ErrGeneral, "could not set secret store %s", store)
 				}
 				return nil
 			},
@@ -562,9 +1194,10 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 		{
 			Name: "targets", Usage: "display all targets", ArgsUsage: " ",
 			Action: func(c *cli.Context) error {
-				if initArgs(cfg, c, 0, 0, nil) != nil {
-					cfg.ListTargets()
+				if _, err := initArgs(cfg, c, 0, 0, nil); err != nil {
+					return err
 				}
+				cfg.ListTargets()
 				return nil
 			},
 		},
@@ -575,11 +1208,12 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 					Name: "add", Usage: "create an app template", ArgsUsage: "<appProductId>",
 					Flags: templateFlags,
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 1, 1, true, nil); ctx != nil {
-							templateService.Add(ctx, args[0],
-								makeOptionMap(c, templateFlags, "appProductId", args[0]))
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return templateService.Add(ctx, args[0],
+							makeOptionMap(c, templateFlags, "appProductId", args[0]))
 					},
 				},
 				{
@@ -599,10 +1233,11 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 		{
 			Name: "tenant", Usage: "gets/sets tenant configuration", ArgsUsage: "<tenantName> [key=value]...",
 			Action: func(c *cli.Context) error {
-				if args, ctx := initCmd(cfg, c, 1, -1, true, nil); ctx != nil {
-					CmdTenantConfig(ctx, args[0], args[1:])
+				args, ctx, err := initCmd(cfg, c, 1, -1, true, nil)
+				if err != nil {
+					return err
 				}
-				return nil
+				return CmdTenantConfig(ctx, args[0], args[1:])
 			},
 		},
 		{
@@ -611,11 +1246,12 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 				{
 					Name: "validate", Usage: "validate the current ID token (if logged in)", ArgsUsage: " ",
 					Action: func(c *cli.Context) error {
-						if _, ctx := initCmd(cfg, c, 0, 0, true, nil); ctx != nil {
-							tokenService := tokenServiceFactory.GetTokenService(cfg, cliClientID, cliClientSecret)
-							tokenService.ValidateIDToken(ctx, cfg.Option(idTokenOption))
+						_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						tokenService := tokenServiceFactory.GetTokenService(cfg, cliClientID)
+						return tokenService.ValidateIDToken(ctx, cfg.Option(idTokenOption))
 					},
 				},
 				{
@@ -626,17 +1262,18 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 						cli.StringFlag{Name: "id, i", Usage: "Override client id, default is " + cliClientID},
 					},
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 1, 1, false, nil); ctx != nil {
-							if c.String("id") != "" {
-								updateClientID(c.String("id"))
-							}
-							tokenService := tokenServiceFactory.GetTokenService(cfg, cliClientID, cliClientSecret)
-							tokenService.UpdateAWSCredentials(ctx.Log, cfg.Option(idTokenOption),
-								args[0], defaultAwsStsEndpoint,
-								StringOrDefault(c.String("credfile"), filepath.Join(os.Getenv("HOME"), defaultAwsCredFile)),
-								StringOrDefault(c.String("profile"), defaultAwsProfile))
+						args, ctx, err := initCmd(cfg, c, 1, 1, false, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						if c.String("id") != "" {
+							updateClientID(c.String("id"))
+						}
+						tokenService := tokenServiceFactory.GetTokenService(cfg, cliClientID)
+						return tokenService.UpdateAWSCredentials(ctx.Log, cfg.Option(idTokenOption),
+							args[0], defaultAwsStsEndpoint,
+							StringOrDefault(c.String("credfile"), filepath.Join(os.Getenv("HOME"), defaultAwsCredFile)),
+							StringOrDefault(c.String("profile"), defaultAwsProfile))
 					},
 				},
 			},
@@ -648,12 +1285,21 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 					Name: "add", Usage: "create a user account", ArgsUsage: "<userName> [password]",
 					Flags: userAttrFlags,
 					Action: func(c *cli.Context) error {
-						if user, ctx := initUserCmd(cfg, c, true); ctx != nil {
-							usersService.AddEntity(ctx, user)
+						user, ctx, err := initUserCmd(cfg, c, true)
+						if err != nil {
+							return err
 						}
-						return nil
+						return usersService.AddEntity(ctx, user)
 					},
 				},
+				{
+					Name: "disable", Usage: "deactivate user accounts without deleting them", ArgsUsage: "[userName]",
+					Flags: []cli.Flag{userFilterFlag}, Action: cmdUserStatus(cfg, DisableUser),
+				},
+				{
+					Name: "enable", Usage: "activate user accounts", ArgsUsage: "[userName]",
+					Flags: []cli.Flag{userFilterFlag}, Action: cmdUserStatus(cfg, EnableUser),
+				},
 				{
 					Name: "get", Usage: "display user account", ArgsUsage: "<userName>",
 					Action: cmdWithAuth1Arg(cfg, usersService.DisplayEntity),
@@ -664,50 +1310,107 @@ func Priam(args []string, defaultCfgFile string, infoW, errorW io.Writer) {
 				},
 				{
 					Name: "list", Usage: "list user accounts", ArgsUsage: " ",
-					Flags: pageFlags,
+					Flags: scimPageFlags,
 					Action: func(c *cli.Context) error {
-						if _, ctx := initCmd(cfg, c, 0, 0, true, nil); ctx != nil {
-							usersService.ListEntities(ctx, c.Int("count"), c.String("filter"))
+						_, ctx, err := initCmd(cfg, c, 0, 0, true, nil)
+						if err != nil {
+							return err
 						}
-						return nil
+						return usersService.ListEntities(ctx, c.Int("count"), c.Int("start-index"), c.Int("page-size"), c.String("filter"))
 					},
 				},
 				{
-					Name: "load", ArgsUsage: "<fileName>", Usage: "loads yaml file of an array of users.",
+					Name: "load", ArgsUsage: "<fileName>", Usage: "loads a yaml, json, csv or ldif file of users.",
 					Description: "Example yaml file content:\n---\n- {name: joe, given: joseph, pwd: changeme}\n" +
-						"- {name: sue, given: susan, family: jones, email: sue@what.com}\n",
+						"- {name: sue, given: susan, family: jones, email: sue@what.com, groups: [admins]}\n\n" +
+						"The format is found from the extension of the file unless --format is given. A csv file\n" +
+						"has a header line with the field names, and several groups are separated by ';'. In an\n" +
+						"ldif file, users are read from the uid, givenName, sn, mail, telephoneNumber and memberOf\n" +
+						"attributes, and passwords only if mapped with 'pwd: userPassword'. A yaml mapping file\n" +
+						"can map other fields to the attributes of the users, e.g.\n" +
+						"---\nname: login\nemail: mail\ngroups: teams\nextensions:\n" +
+						"  urn:ietf:params:scim:schemas:extension:enterprise:2.0:User: {department: dept}\n\n" +
+						"The results file lists each user as created, failed or skipped. With --resume, users\n" +
+						"that did not fail in the given results file are skipped, and the results are written\n" +
+						"to that file unless --results is given.",
+					Flags: []cli.Flag{
+						cli.IntFlag{Name: "parallel, p", Value: 1, Usage: "number of users to add at the same time"},
+						cli.StringFlag{Name: "results, r", Usage: "write the result for each user to this yaml file"},
+						cli.StringFlag{Name: "resume", Usage: "results file of an earlier load, only add users that were not created"},
+						cli.StringFlag{Name: "format, f", Usage: "format of the file: " + strings.Join(UserFileFormats, ", ")},
+						cli.StringFlag{Name: "mapping, m", Usage: "yaml file mapping the fields of the file to the attributes of users"},
+					},
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 1, 1, true, nil); ctx != nil {
-							usersService.LoadEntities(ctx, args[0])
+						args, ctx, err := initCmd(cfg, c, 1, 1, true, func([]string) bool {
+							if c.Int("parallel") < 1 {
+								cfg.Log.Err("\nInput Error: parallel must be at least 1\n\n")
+								return false
+							}
+							return true
+						})
+						if err != nil {
+							return err
 						}
-						return nil
+						return usersService.LoadEntities(ctx, args[0], LoadOptions{Parallel: c.Int("parallel"),
+							ResultsFile: StringOrDefault(c.String("results"), c.String("resume")), ResumeFile: c.String("resume"),
+							Format: c.String("format"), MappingFile: c.String("mapping")})
 					},
 				},
 				{
 					Name: "password", Usage: "set a user's password", ArgsUsage: "<username> [password]",
-					Description: "If password is not given as an argument, user will be prompted to enter it",
+					Description: "If password is not given as an argument, user will be prompted to enter it.\n" +
+						"   With --expire, the password of the user, or of all users matching --filter, is expired\n" +
+						"   so that it must be changed at the next login.",
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "expire", Usage: "expire the password instead of setting it"},
+						userFilterFlag,
+					},
 					Action: func(c *cli.Context) error {
-						if args, ctx := initCmd(cfg, c, 1, 2, true, nil); ctx != nil {
-							usersService.UpdateEntity(ctx, args[0], &BasicUser{Pwd: getArgOrPassword(cfg.Log, "Password", args[1], true)})
+						if c.Bool("expire") {
+							return cmdUserStatus(cfg, ExpirePassword)(c)
+						}
+						args, ctx, err := initCmd(cfg, c, 1, 2, true, func([]string) bool {
+							if c.String("filter") != "" {
+								cfg.Log.Err("\nInput Error: --filter can only be given with --expire\n\n")
+								return false
+							}
+							return true
+						})
+						if err != nil {
+							return err
 						}
-						return nil
+						return usersService.UpdateEntity(ctx, args[0], &BasicUser{Pwd: getArgOrPassword(cfg.Log, "Password", args[1], true)})
 					},
 				},
+				{
+					Name: "unlock", Usage: "unlock user accounts locked after failed logins", ArgsUsage: "[userName]",
+					Flags: []cli.Flag{userFilterFlag}, Action: cmdUserStatus(cfg, UnlockUser),
+				},
 				{
 					Name: "update", Usage: "update user account", ArgsUsage: "<userName>",
 					Flags: userAttrFlags,
 					Action: func(c *cli.Context) error {
-						if user, ctx := initUserCmd(cfg, c, false); ctx != nil {
-							usersService.UpdateEntity(ctx, user.Name, user)
+						user, ctx, err := initUserCmd(cfg, c, false)
+						if err != nil {
+							return err
 						}
-						return nil
+						return usersService.UpdateEntity(ctx, user.Name, user)
 					},
 				},
 			},
 		},
 	}
 
-	if err = app.Run(args); err != nil {
+	markErrorsReported(app.Commands)
+	if err = app.Run(args); err == nil {
+		return 0
+	}
+	if !errors.As(err, &reportedError{}) {
 		fmt.Fprintln(errorW, "failed to run app: ", err)
+		if !errors.As(err, new(*Error)) {
+			// untyped errors come from parsing flags and options
+			return int(ErrUsage)
+		}
 	}
+	return int(KindOf(err))
 }
@@ -0,0 +1,212 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/vmware/priam/util"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// an application of an exported manifest, without the fields only used by Cloud Foundry
+type exportedApp struct {
+	Name      string   `yaml:"name"`
+	Workspace priamApp `yaml:"workspace"`
+}
+
+// file extensions of the icons of apps by their content type, and of icons of other types
+var iconExtensions = map[string]string{"image/png": ".png", "image/jpeg": ".jpg", "image/gif": ".gif",
+	"image/x-icon": ".ico", "image/bmp": ".bmp", "image/webp": ".webp"}
+
+const defaultIconExtension = ".bin"
+
+// matches the characters of an app name that are not kept in the name of its icon file
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// MarshalYAML writes a subject with the default activation policy only by its name
+func (s appSubject) MarshalYAML() (interface{}, error) {
+	if s.Activation == "" {
+		return s.Name, nil
+	}
+	type plain appSubject
+	return plain(s), nil
+}
+
+// returns the names of the access policies by their uuid
+func accessPolicyNames(ctx *HttpContext) (map[string]string, error) {
+	outp, names := &itemResponse{}, make(map[string]string)
+	if err := ctx.Accept("accesspolicyset.list").Request("GET", "accessPolicies", nil, &outp); err != nil {
+		return nil, err
+	}
+	for _, item := range outp.Items {
+		names[InterfaceToString(item["uuid"])] = InterfaceToString(item["name"])
+	}
+	return names, nil
+}
+
+// returns the users and groups entitled to an app, by name and with their activation policy if not automatic
+func appSubjects(ctx *HttpContext, name, uuid string) (groups, users []appSubject, err error) {
+	outp := &itemResponse{}
+	path := fmt.Sprintf("entitlements/definitions/catalogitems/%s", uuid)
+	if err = ctx.Accept("").Request("GET", path, nil, outp); err != nil {
+		return
+	}
+	for _, def := range outp.Items {
+		ent, s := definedEntitlement(ctx, name, def), appSubject{}
+		for activation, policy := range ActivationPolicies {
+			if activation != "automatic" && CaselessEqual(policy, def["activationPolicy"]) {
+				s.Activation = activation
+			}
+		}
+		if s.Name = ent.Group; s.Name != "" {
+			groups = append(groups, s)
+		} else {
+			s.Name = ent.User
+			users = append(users, s)
+		}
+	}
+	for _, subjects := range [][]appSubject{groups, users} {
+		sort.Slice(subjects, func(i, j int) bool { return strings.ToLower(subjects[i].Name) < strings.ToLower(subjects[j].Name) })
+	}
+	return
+}
+
+/* downloads the icon of an app to the directory of the manifest, and returns the name of the
+   icon file relative to that directory, or "" if the app has none.
+*/
+func downloadIcon(ctx *HttpContext, app map[string]interface{}, name, dir string) (string, error) {
+	links, _ := app["_links"].(map[string]interface{})
+	icon, _ := links["icon"].(map[string]interface{})
+	href := InterfaceToString(icon["href"])
+	if href == "" {
+		return "", nil
+	}
+	var content string
+	if err := ctx.Accept("").Request("GET", href, nil, &content); err != nil {
+		return "", err
+	}
+	ext, ok := iconExtensions[http.DetectContentType([]byte(content))]
+	if !ok {
+		ext = defaultIconExtension
+	}
+	fileName := unsafeFileChars.ReplaceAllString(name, "-") + ext
+	return fileName, ioutil.WriteFile(filepath.Join(dir, fileName), []byte(content), 0644)
+}
+
+// returns an app of the catalog in the form of the manifest, without the fields set by the server
+func exportApp(ctx *HttpContext, name, uuid, mtype string, policies map[string]string, dir string) (*exportedApp, error) {
+	app, err := getAppByUuid(ctx, uuid, mtype)
+	if err != nil {
+		ctx.Log.Err("Error getting app \"%s\": %v\n", name, err)
+		return nil, err
+	}
+	content, err := json.Marshal(app)
+	if err != nil {
+		return nil, err
+	}
+	w := priamApp{}
+	if err = json.Unmarshal(content, &w); err != nil {
+		ctx.Log.Err("Error reading app \"%s\": %v\n", name, err)
+		return nil, err
+	}
+	name, w.Name, w.Uuid = StringOrDefault(w.Name, name), "", ""
+	if policy := policies[w.AccessPolicySetUuid]; policy != "" {
+		w.AccessPolicy, w.AccessPolicySetUuid = policy, ""
+	} else if w.AccessPolicySetUuid != "" {
+		ctx.Log.Err("Could not find access policy %s of app \"%s\", keeping its uuid\n", w.AccessPolicySetUuid, name)
+	}
+	if w.IconFile, err = downloadIcon(ctx, app, name, dir); err != nil {
+		ctx.Log.Err("Error getting icon of app \"%s\": %v\n", name, err)
+		return nil, err
+	}
+	if w.EntitleGroups, w.EntitleUsers, err = appSubjects(ctx, name, uuid); err != nil {
+		ctx.Log.Err("Error getting entitlements of app \"%s\": %v\n", name, err)
+		return nil, err
+	}
+	return &exportedApp{name, w}, nil
+}
+
+/* ExportApps writes the named app of the catalog, or all apps if the name is empty, as a
+   manifest that can be published again, to another tenant as well. The access policy of an
+   app is given by name, its entitlements are recorded, and its icon is written to a file in
+   the directory of the manifest. The manifest is written to the given file, or printed if
+   no file is given. Apps that cannot be exported are skipped, and the first error is returned.
+*/
+func ExportApps(ctx *HttpContext, name, manifestFile string) (err error) {
+	type appRef struct{ name, uuid, mtype string }
+	var refs []appRef
+	if name != "" {
+		uuid, mtype, err := getAppUuid(ctx, name)
+		if err != nil {
+			ctx.Log.Err("Error getting app info by name: %v\n", err)
+			return err
+		}
+		refs = append(refs, appRef{name, uuid, mtype})
+	} else {
+		apps, err := fetchItems("POST", "catalogitems/search?pageSize=10000", "catalog.summary.list", "catalog.search", "name")(ctx)
+		if err != nil {
+			ctx.Log.Err("Error getting apps: %v\n", err)
+			return err
+		}
+		for name, item := range apps {
+			refs = append(refs, appRef{name, InterfaceToString(item["uuid"]),
+				"catalog." + strings.ToLower(InterfaceToString(item["catalogItemType"]))})
+		}
+		sort.Slice(refs, func(i, j int) bool { return strings.ToLower(refs[i].name) < strings.ToLower(refs[j].name) })
+	}
+	policies, err := accessPolicyNames(ctx)
+	if err != nil {
+		ctx.Log.Err("Error getting access policies: %v\n", err)
+		return err
+	}
+	dir := "."
+	if manifestFile != "" {
+		dir = filepath.Dir(manifestFile)
+	}
+	manifest := struct {
+		Applications []*exportedApp `yaml:"applications"`
+	}{}
+	for _, ref := range refs {
+		app, e := exportApp(ctx, ref.name, ref.uuid, ref.mtype, policies, dir)
+		if e != nil {
+			keepFirst(&err, e)
+			continue
+		}
+		manifest.Applications = append(manifest.Applications, app)
+	}
+	content, e := yaml.Marshal(manifest)
+	if e != nil {
+		ctx.Log.Err("Error writing manifest: %v\n", e)
+		return e
+	}
+	content = append([]byte("---\n"), content...)
+	if manifestFile == "" {
+		ctx.Log.Info("%s", content)
+	} else if e = ioutil.WriteFile(manifestFile, content, 0644); e != nil {
+		ctx.Log.Err("Error writing manifest: %v\n", e)
+		return e
+	} else {
+		ctx.Log.Info("Exported %d of %d apps to %s\n", len(manifest.Applications), len(refs), manifestFile)
+	}
+	return
+}
@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const pngIcon = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+// returns the handlers of a catalog with a Saml20 app with an icon and entitlements, and a web link
+func appExportPaths() map[string]TstHandler {
+	return map[string]TstHandler{
+		appSearchPath: GoodPathHandler(`{"items": [{"name": "olaf", "uuid": "u1", "catalogItemType": "Saml20"},
+			{"name": "sven", "uuid": "u2", "catalogItemType": "WebAppLink"}]}`),
+		"GET/catalogitems/u1": GoodPathHandler(`{"name": "olaf", "uuid": "u1", "catalogItemType": "Saml20",
+			"packageVersion": "1.0", "accessPolicySetUuid": "p1", "visible": true,
+			"authInfo": {"type": "Saml20", "validityTimeSeconds": 200, "configureAs": "manual"},
+			"_links": {"icon": {"href": "/catalogitems/u1/icon"}, "self": {"href": "/catalogitems/u1"}}}`),
+		"GET/catalogitems/u1/icon": func(t *testing.T, req *TstReq) *TstReply {
+			return &TstReply{Output: pngIcon, ContentType: "image/png"}
+		},
+		"GET/catalogitems/u2": GoodPathHandler(`{"name": "sven", "uuid": "u2", "catalogItemType": "WebAppLink",
+			"accessPolicySetUuid": "p2", "authInfo": {"type": "WebAppLink", "targetUrl": "https://sven.example.com"}}`),
+		"GET/accessPolicies": GoodPathHandler(`{"items": [{"uuid": "p1", "name": "default_access_policy_set"},
+			{"uuid": "p2", "name": "strict"}]}`),
+		"GET/entitlements/definitions/catalogitems/u1": GoodPathHandler(`{"items": [
+			{"subjectType": "USERS", "subjectId": "j1", "activationPolicy": "USER_ACTIVATED"},
+			{"subjectType": "GROUPS", "subjectId": "g1", "activationPolicy": "AUTOMATIC"}]}`),
+		"GET/entitlements/definitions/catalogitems/u2": GoodPathHandler(`{"items": []}`),
+		"GET/scim/Groups/g1":                           GoodPathHandler(`{"displayName": "ALL USERS"}`),
+		"GET/scim/Users/j1":                            GoodPathHandler(`{"userName": "joe"}`),
+	}
+}
+
+func TestExportAllAppsToManifestThatCanBePublished(t *testing.T) {
+	dir, err := ioutil.TempDir("", "priam-export")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	srv, ctx := NewTestContext(t, appExportPaths())
+	defer srv.Close()
+	manifestFile := filepath.Join(dir, "manifest.yaml")
+	assert.Nil(t, ExportApps(ctx, "", manifestFile))
+	AssertOnlyInfoContains(t, ctx, "Exported 2 of 2 apps to "+manifestFile)
+
+	icon, err := ioutil.ReadFile(filepath.Join(dir, "olaf.png"))
+	require.Nil(t, err)
+	assert.Equal(t, pngIcon, string(icon))
+	assert.Contains(t, GetTempFile(t, manifestFile), "    iconFile: olaf.png\n")
+	apps, err := readManifest(ctx, manifestFile)
+	require.Nil(t, err)
+	require.Len(t, apps, 2)
+	assert.Equal(t, &priamApp{Name: "olaf", PackageVersion: "1.0", IconFile: filepath.Join(dir, "olaf.png"),
+		AccessPolicy: "default_access_policy_set", CatalogItemType: "Saml20",
+		EntitleGroups: []appSubject{{Name: "ALL USERS"}}, EntitleUsers: []appSubject{{Name: "joe", Activation: "user"}},
+		AuthInfo: map[string]interface{}{"type": "Saml20", "validityTimeSeconds": 200, "configureAs": "manual"}}, apps[0])
+	assert.Equal(t, "sven", apps[1].Name)
+	assert.Equal(t, "strict", apps[1].AccessPolicy)
+	assert.Empty(t, apps[1].AccessPolicySetUuid)
+	assert.Empty(t, apps[1].IconFile)
+}
+
+func TestExportIconOfUnknownTypeHasDefaultExtension(t *testing.T) {
+	dir, err := ioutil.TempDir("", "priam-export")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	paths := appExportPaths()
+	paths["GET/catalogitems/u1/icon"] = func(t *testing.T, req *TstReq) *TstReply {
+		return &TstReply{Output: "<svg/>", ContentType: "image/svg+xml"}
+	}
+	srv, ctx := NewTestContext(t, paths)
+	defer srv.Close()
+	assert.Nil(t, ExportApps(ctx, "olaf", filepath.Join(dir, "olaf.yaml")))
+	assert.Contains(t, GetTempFile(t, filepath.Join(dir, "olaf.yaml")), "    iconFile: olaf.bin\n")
+	_, err = os.Stat(filepath.Join(dir, "olaf.bin"))
+	assert.Nil(t, err)
+}
+
+func TestExportAppPrintsManifest(t *testing.T) {
+	paths := appExportPaths()
+	paths["GET/accessPolicies"] = GoodPathHandler(`{"items": []}`)
+	srv, ctx := NewTestContext(t, paths)
+	defer srv.Close()
+	assert.Nil(t, ExportApps(ctx, "sven", ""))
+	assert.Equal(t, `---
+applications:
+- name: sven
+  workspace:
+    accessPolicySetUuid: p2
+    catalogItemType: WebAppLink
+    authInfo:
+      targetUrl: https://sven.example.com
+      type: WebAppLink
+`, ctx.Log.InfoString())
+	assert.Contains(t, ctx.Log.ErrString(), `Could not find access policy p2 of app "sven", keeping its uuid`)
+}
+
+func TestExportUnknownAppFails(t *testing.T) {
+	srv, ctx := NewTestContext(t, appExportPaths())
+	defer srv.Close()
+	err := ExportApps(ctx, "anna", "")
+	assert.Equal(t, ErrNotFound, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `No app found with name "anna"`)
+}
+
+func TestExportSkipsAppsThatCannotBeRead(t *testing.T) {
+	paths := appExportPaths()
+	paths["GET/catalogitems/u1"] = ErrorHandler(403, "not allowed")
+	srv, ctx := NewTestContext(t, paths)
+	defer srv.Close()
+	err := ExportApps(ctx, "", "")
+	assert.Equal(t, ErrAuth, KindOf(err))
+	assert.Contains(t, ctx.Log.ErrString(), `Error getting app "olaf": 403 Forbidden`)
+	assert.Contains(t, ctx.Log.InfoString(), "- name: sven\n")
+	assert.NotContains(t, ctx.Log.InfoString(), "olaf")
+}
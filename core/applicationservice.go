@@ -20,18 +20,25 @@ import (
 )
 
 // The application service interface.
+// As for the directory service, errors are printed to the log of the context and returned.
 type ApplicationService interface {
 	// Display display the given application defined by its name
-	Display(ctx *util.HttpContext, name string)
+	Display(ctx *util.HttpContext, name string) error
 
 	// Delete deletes the given application defined by its name
-	Delete(ctx *util.HttpContext, name string)
+	Delete(ctx *util.HttpContext, name string) error
 
 	// List lists all applications in the catalog
 	// @param count the number of applications to display
 	// @param filter the filter
-	List(ctx *util.HttpContext, count int, filter string)
+	List(ctx *util.HttpContext, count int, filter string) error
 
 	// Publish publishes the application defined by the manifestFile into VMware IDM catalog
-	Publish(ctx *util.HttpContext, manifestFile string)
+	// @param revoke remove the entitlements to the application that are not in the manifest
+	Publish(ctx *util.HttpContext, manifestFile string, revoke bool) error
+
+	// Export writes the application defined by its name, or all applications if the name is empty,
+	// as a manifest that can be published again
+	// @param manifestFile the file to write, or "" to print the manifest
+	Export(ctx *util.HttpContext, name, manifestFile string) error
 }
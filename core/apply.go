@@ -0,0 +1,453 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	. "github.com/vmware/priam/util"
+	"sort"
+	"strings"
+)
+
+// Desired contents of a tenant as read from a state file by the apply command.
+// Users are matched by user name, groups and roles by display name.
+type TenantState struct {
+	Users  []BasicUser  `yaml:",omitempty"`
+	Groups []BasicGroup `yaml:",omitempty"`
+	Roles  []BasicRole  `yaml:",omitempty"`
+}
+
+// name of the built-in group of all users of the tenant
+const allUsersGroup = "ALL USERS"
+
+// SCIM resources of one type, keyed by lower case name
+type scimIndex map[string]map[string]interface{}
+
+func scimIndexByName(ctx *HttpContext, resType, nameAttr string) (scimIndex, error) {
+	index := make(scimIndex)
+	err := scimEach(ctx, resType, "", 0, 0, scimPageSize, func(resources []interface{}) error {
+		for _, r := range resources {
+			if item, ok := r.(map[string]interface{}); ok {
+				if name := InterfaceToString(item[nameAttr]); name != "" {
+					index[strings.ToLower(name)] = item
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (index scimIndex) id(name string) string {
+	return InterfaceToString(index[strings.ToLower(name)]["id"])
+}
+
+// returns the SCIM ids of the groups or roles a user belongs to, from the user's
+// "groups" or "roles" attribute
+func memberOf(user map[string]interface{}, attr string) (ids []string) {
+	values, _ := user[attr].([]interface{})
+	for _, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			if id := InterfaceToString(m["value"]); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return
+}
+
+// maps group or role ids to the set of their member user ids
+func membershipsByID(users scimIndex, attr string) map[string]map[string]bool {
+	members := make(map[string]map[string]bool)
+	for _, user := range users {
+		uid := InterfaceToString(user["id"])
+		for _, id := range memberOf(user, attr) {
+			if members[id] == nil {
+				members[id] = make(map[string]bool)
+			}
+			members[id][uid] = true
+		}
+	}
+	return members
+}
+
+// returns the string form of a SCIM attribute value, or "" if it is not set
+func attrString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func phonesDiffer(phones []string, item map[string]interface{}) bool {
+	current, _ := item["phoneNumbers"].([]interface{})
+	if len(phones) != len(current) {
+		return true
+	}
+	for i, p := range current {
+		m, _ := p.(map[string]interface{})
+		if !CaseEqual(phones[i], m["value"]) {
+			return true
+		}
+	}
+	return false
+}
+
+func userNeedsUpdate(u *BasicUser, item map[string]interface{}) bool {
+	name, _ := item["name"].(map[string]interface{})
+	if u.Given != "" && !CaseEqual(u.Given, name["givenName"]) ||
+		u.Family != "" && !CaseEqual(u.Family, name["familyName"]) ||
+		u.Email != "" && !strings.EqualFold(u.Email, primaryEmail(item)) ||
+		u.Active != nil && item["active"] != *u.Active ||
+		u.ExternalId != "" && !CaseEqual(u.ExternalId, item["externalId"]) ||
+		u.Phones != nil && phonesDiffer(u.Phones, item) {
+		return true
+	}
+	for attr, value := range u.Attributes {
+		if attrString(item[attr]) != value {
+			return true
+		}
+	}
+	for urn, attrs := range u.Extensions {
+		ext, _ := item[urn].(map[string]interface{})
+		for attr, value := range attrs {
+			if attrString(ext[attr]) != value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// members of a group or role that are not in the state file, which are only removed when pruning is confirmed
+type memberRemoval struct {
+	resType, label, name, id string
+	uids                     []string
+}
+
+/* adds members of a group or role so that it has the desired members. If removals is not nil,
+   the current members that are not desired are added to it, except the user with the keep id.
+*/
+func reconcileMembers(ctx *HttpContext, resType, label, name, id string, desired []string,
+	current map[string]bool, users scimIndex, removals *[]memberRemoval, keep string) error {
+	patch, wanted := memberPatch{Schemas: []string{coreSchemaURN}}, make(map[string]bool)
+	for _, uname := range desired {
+		uid := users.id(uname)
+		if uid == "" {
+			err := NewError(ErrNotFound, "no user found named \"%s\"", uname)
+			ctx.Log.Err("Error updating members of %s \"%s\": %v\n", label, name, err)
+			return err
+		}
+		if wanted[uid] = true; !current[uid] {
+			patch.Members = append(patch.Members, memberValue{Value: uid, Type: "User"})
+		}
+	}
+	if removals != nil {
+		removal := memberRemoval{resType, label, name, id, nil}
+		for uid := range current {
+			if wanted[uid] {
+				continue
+			} else if keep != "" && uid == keep {
+				ctx.Log.Info("Not removing the logged in user from %s \"%s\"\n", label, name)
+			} else {
+				removal.uids = append(removal.uids, uid)
+			}
+		}
+		if len(removal.uids) > 0 {
+			sort.Strings(removal.uids)
+			*removals = append(*removals, removal)
+		}
+	}
+	if len(patch.Members) == 0 {
+		return nil
+	}
+	return patchMembers(ctx, resType, label, name, id, &patch)
+}
+
+func patchMembers(ctx *HttpContext, resType, label, name, id string, patch *memberPatch) error {
+	err := scimPatch(ctx, resType, id, patch)
+	if err != nil {
+		ctx.Log.Err("Error updating members of %s \"%s\": %v\n", label, name, err)
+	} else {
+		ctx.Log.Info("Members of %s \"%s\" updated\n", label, name)
+	}
+	return err
+}
+
+func removeMembers(ctx *HttpContext, removals []memberRemoval) (err error) {
+	for _, r := range removals {
+		patch := memberPatch{Schemas: []string{coreSchemaURN}}
+		for _, uid := range r.uids {
+			patch.Members = append(patch.Members, memberValue{Value: uid, Type: "User", Operation: "delete"})
+		}
+		keepFirst(&err, patchMembers(ctx, r.resType, r.label, r.name, r.id, &patch))
+	}
+	return
+}
+
+func stringsEqual(a []string, i interface{}) bool {
+	b, _ := i.([]interface{})
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !CaseEqual(a[k], b[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+func roleNeedsUpdate(r *BasicRole, item map[string]interface{}) bool {
+	ext, _ := item[wksExtSchemaURN].(map[string]interface{})
+	return r.Description != "" && !CaseEqual(r.Description, item["description"]) ||
+		r.Scopes != nil && !stringsEqual(r.Scopes, ext["scopes"]) ||
+		r.Permissions != nil && !stringsEqual(r.Permissions, ext["permissions"])
+}
+
+func applyUsers(ctx *HttpContext, desired []BasicUser, users scimIndex) (err error) {
+	for i := range desired {
+		u := &desired[i]
+		if item := users[strings.ToLower(u.Name)]; item == nil {
+			keepFirst(&err, scimAddUser(ctx, u, nil))
+		} else if userNeedsUpdate(u, item) {
+			keepFirst(&err, scimPatchUser(ctx, InterfaceToString(item["id"]), u.Name,
+				&BasicUser{Name: u.Name, Given: u.Given, Family: u.Family, Email: u.Email, Active: u.Active,
+					ExternalId: u.ExternalId, Phones: u.Phones, Attributes: u.Attributes, Extensions: u.Extensions}))
+		}
+	}
+	return
+}
+
+func applyGroups(ctx *HttpContext, desired []BasicGroup, groups, users scimIndex, removals *[]memberRemoval) (err error) {
+	members := membershipsByID(users, "groups")
+	for i := range desired {
+		g := &desired[i]
+		item := groups[strings.ToLower(g.Name)]
+		if item == nil {
+			keepFirst(&err, scimAddGroup(ctx, g))
+			continue
+		}
+		id := InterfaceToString(item["id"])
+		if g.Description != "" && !CaseEqual(g.Description, item["description"]) {
+			keepFirst(&err, scimUpdate(ctx, "Groups", id, "group", g.Name, &groupAccount{Schemas: []string{coreSchemaURN},
+				Description: g.Description}))
+		}
+		if g.Members != nil {
+			keepFirst(&err, reconcileMembers(ctx, "Groups", "group", g.Name, id, g.Members, members[id], users, removals, ""))
+		}
+	}
+	return
+}
+
+// updates roles, the logged in user with the self id is never removed from a role so that they keep their access
+func applyRoles(ctx *HttpContext, desired []BasicRole, roles, users scimIndex, removals *[]memberRemoval, self string) (err error) {
+	members := membershipsByID(users, "roles")
+	for i := range desired {
+		r := &desired[i]
+		item := roles[strings.ToLower(r.Name)]
+		if item == nil {
+			keepFirst(&err, scimAddRole(ctx, r))
+			continue
+		}
+		id := InterfaceToString(item["id"])
+		if roleNeedsUpdate(r, item) {
+			role, rerr := makeRoleAccount(ctx, &BasicRole{Description: r.Description,
+				Scopes: r.Scopes, Permissions: r.Permissions})
+			if rerr == nil {
+				rerr = scimUpdate(ctx, "Roles", id, "role", r.Name, role)
+			}
+			keepFirst(&err, rerr)
+		}
+		if r.Members != nil {
+			keepFirst(&err, reconcileMembers(ctx, "Roles", "role", r.Name, id, r.Members, members[id], users, removals, self))
+		}
+	}
+	return
+}
+
+// returns the resources in the index that are not named in the desired list, in name order
+func unwantedResources(existing scimIndex, desired map[string]bool) (items []map[string]interface{}) {
+	var names []string
+	for name := range existing {
+		if !desired[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		items = append(items, existing[name])
+	}
+	return
+}
+
+func deleteResources(ctx *HttpContext, resType, nameAttr string, items []map[string]interface{}) (err error) {
+	for _, item := range items {
+		keepFirst(&err, scimDeleteByID(ctx, resType, InterfaceToString(item["id"]), InterfaceToString(item[nameAttr])))
+	}
+	return
+}
+
+// returns the SCIM id of the user the access token of the context was issued to, found by
+// user name if the token has no id, or "" if the token is not a JWT of a user, such as the
+// token of a client
+func loggedInUser(ctx *HttpContext, users scimIndex) string {
+	token := ctx.Headers("Authorization")
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token[strings.Index(token, " ")+1:], claims); err != nil {
+		return ""
+	}
+	if id := InterfaceToString(claims["user_id"]); id != "" {
+		return id
+	}
+	name := InterfaceToString(claims["prn"])
+	if at := strings.LastIndex(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	return users.id(name)
+}
+
+// returns the users to delete, without the logged in user who would lose access while pruning
+func usersToPrune(ctx *HttpContext, users scimIndex, desired map[string]bool, self string) (items []map[string]interface{}) {
+	for _, item := range unwantedResources(users, desired) {
+		if self != "" && CaseEqual(self, item["id"]) {
+			ctx.Log.Info("Not deleting user \"%s\" who is logged in\n", InterfaceToString(item["userName"]))
+		} else {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+/* returns true if a group is not created in the tenant, such as the built-in ALL USERS group
+   or a group synced from a directory, so that it is never deleted when pruning
+*/
+func managedGroup(item map[string]interface{}) bool {
+	ext, _ := item[wksExtSchemaURN].(map[string]interface{})
+	groupType := InterfaceToString(ext["internalGroupType"])
+	return CaselessEqual(allUsersGroup, item["displayName"]) || groupType != "" && !strings.EqualFold(groupType, "INTERNAL")
+}
+
+// returns the groups to delete, without the groups that are not created in the tenant
+func groupsToPrune(ctx *HttpContext, groups scimIndex, desired map[string]bool) (items []map[string]interface{}) {
+	for _, item := range unwantedResources(groups, desired) {
+		if managedGroup(item) {
+			ctx.Log.Info("Not deleting group \"%s\" which is built in or synced from a directory\n",
+				InterfaceToString(item["displayName"]))
+		} else {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// ApplyState reconciles the users, groups and roles of the tenant with the given state file.
+// Missing resources are created and fields or members given in the file are updated. If prune
+// is set, users and groups missing from the file are deleted, but only if the file has a users
+// or groups section, and members that are not listed for a group or role are removed. The
+// logged in user is never deleted nor removed from a role, and roles, built-in groups and
+// groups synced from a directory are never deleted. Before anything is deleted or removed,
+// confirm is called with the number of users, groups and members, unless it is nil. Changes
+// that fail are skipped and the first error is returned.
+func ApplyState(ctx *HttpContext, fileName string, prune bool, confirm func(prompt string) bool) error {
+	var state TenantState
+	if err := GetYamlFile(fileName, &state); err != nil {
+		ctx.Log.Err("could not read state file: %v\n", err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	users, err := scimIndexByName(ctx, "Users", "userName")
+	if err != nil {
+		ctx.Log.Err("Error getting users: %v\n", err)
+		return err
+	}
+	firstErr := applyUsers(ctx, state.Users, users)
+
+	// get users again so that ids of new users and current memberships are known
+	if users, err = scimIndexByName(ctx, "Users", "userName"); err != nil {
+		ctx.Log.Err("Error getting users: %v\n", err)
+		return err
+	}
+	groups, err := scimIndexByName(ctx, "Groups", "displayName")
+	if err != nil {
+		ctx.Log.Err("Error getting groups: %v\n", err)
+		return err
+	}
+	var removals *[]memberRemoval
+	if prune {
+		removals = &[]memberRemoval{}
+	}
+	self := loggedInUser(ctx, users)
+	keepFirst(&firstErr, applyGroups(ctx, state.Groups, groups, users, removals))
+
+	roles, err := scimIndexByName(ctx, "Roles", "displayName")
+	if err != nil {
+		ctx.Log.Err("Error getting roles: %v\n", err)
+		return err
+	}
+	keepFirst(&firstErr, applyRoles(ctx, state.Roles, roles, users, removals, self))
+
+	if prune {
+		keepFirst(&firstErr, pruneState(ctx, &state, users, groups, *removals, self, confirm))
+	}
+	if firstErr != nil {
+		ctx.Log.Err("State from \"%s\" applied with errors\n", fileName)
+	} else {
+		ctx.Log.Info("State from \"%s\" applied\n", fileName)
+	}
+	return firstErr
+}
+
+// removes the members and deletes the users and groups that are not in the state, for the sections the state has
+func pruneState(ctx *HttpContext, state *TenantState, users, groups scimIndex, removals []memberRemoval, self string,
+	confirm func(prompt string) bool) error {
+	var deleteUsers, deleteGroups []map[string]interface{}
+	if state.Groups != nil {
+		desired := make(map[string]bool)
+		for _, g := range state.Groups {
+			desired[strings.ToLower(g.Name)] = true
+		}
+		deleteGroups = groupsToPrune(ctx, groups, desired)
+	}
+	if state.Users != nil {
+		desired := make(map[string]bool)
+		for _, u := range state.Users {
+			desired[strings.ToLower(u.Name)] = true
+		}
+		deleteUsers = usersToPrune(ctx, users, desired, self)
+	}
+	members := 0
+	for _, r := range removals {
+		members += len(r.uids)
+	}
+	if len(deleteUsers)+len(deleteGroups)+members == 0 {
+		return nil
+	}
+	prompt := fmt.Sprintf("Delete %d users and %d groups, and remove %d members of groups and roles, that are not in the state file?",
+		len(deleteUsers), len(deleteGroups), members)
+	if confirm != nil && !ctx.DryRun && !confirm(prompt) {
+		ctx.Log.Err("Users, groups and members not in the state file were not deleted\n")
+		return NewError(ErrUsage, "deletion of %d users, %d groups and %d members was not confirmed",
+			len(deleteUsers), len(deleteGroups), members)
+	}
+	err := removeMembers(ctx, removals)
+	keepFirst(&err, deleteResources(ctx, "Groups", "displayName", deleteGroups))
+	keepFirst(&err, deleteResources(ctx, "Users", "userName", deleteUsers))
+	return err
+}
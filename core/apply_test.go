@@ -0,0 +1,252 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"testing"
+)
+
+const (
+	applyUsersURL   = "GET/scim/Users?count=10000"
+	applyGroupsURL  = "GET/scim/Groups?count=10000"
+	applyRolesURL   = "GET/scim/Roles?count=10000"
+	applyUsersReply = `{"Resources": [
+		{"userName": "john", "id": "12345", "name": {"givenName": "john", "familyName": "travolta"},
+		 "emails": [{"value": "john@example.com"}], "groups": [{"value": "6789"}], "roles": [{"value": "123"}]},
+		{"userName": "olivia", "id": "54321", "groups": [{"value": "6789"}]}]}`
+	applyGroupsReply = `{"Resources": [{"displayName": "saturday-night-fever", "id": "6789", "description": "disco"},
+		{"displayName": "grease", "id": "9876"}]}`
+	applyRolesReply = `{"Resources": [{"displayName": "dancer", "id": "123"}]}`
+)
+
+func applyStateFile(t *testing.T, state string) string {
+	f := WriteTempFile(t, state)
+	f.Close()
+	return f.Name()
+}
+
+func TestApplyReportsMissingStateFile(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{})
+	defer srv.Close()
+	ApplyState(ctx, "no-such-state.yaml", false, nil)
+	AssertErrorContains(t, ctx, "could not read state file")
+}
+
+func TestApplyFailsIfUsersCannotBeListed(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{applyUsersURL: ErrorHandler(500, "list failed")})
+	defer srv.Close()
+	ApplyState(ctx, applyStateFile(t, "users:\n- {name: john}\n"), false, nil)
+	AssertErrorContains(t, ctx, "Error getting users: 500 Internal Server Error\nlist failed")
+}
+
+func TestApplyMakesNoChangesWhenTenantMatches(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:  GoodPathHandler(applyUsersReply),
+		applyGroupsURL: GoodPathHandler(applyGroupsReply),
+		applyRolesURL:  GoodPathHandler(applyRolesReply)})
+	defer srv.Close()
+	state := "users:\n- {name: john, given: john, email: JOHN@example.com}\n- {name: olivia}\n" +
+		"groups:\n- {name: saturday-night-fever, description: disco, members: [john, olivia]}\n- {name: grease}\n" +
+		"roles:\n- {name: dancer, members: [john]}\n"
+	ApplyState(ctx, applyStateFile(t, state), true, nil)
+	AssertOnlyInfoContains(t, ctx, "applied")
+	assert.NotContains(t, ctx.Log.InfoString(), "updated")
+	assert.NotContains(t, ctx.Log.InfoString(), "deleted")
+}
+
+func TestApplyCreatesAndUpdates(t *testing.T) {
+	userPatchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"FamilyName":"wayne"`)
+		return &TstReply{Status: 204}
+	}
+	groupPatchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Description":"soul"`)
+		return &TstReply{Status: 204}
+	}
+	rolePatchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `{"Value":"54321","Type":"User"}`)
+		assert.NotContains(t, req.Input, "delete")
+		return &TstReply{Status: 204}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:           GoodPathHandler(applyUsersReply),
+		applyGroupsURL:          GoodPathHandler(applyGroupsReply),
+		applyRolesURL:           GoodPathHandler(applyRolesReply),
+		"POST/scim/Users":       scimDefaultUserHandler(),
+		"POST/scim/Users/12345": userPatchH,
+		"POST/scim/Groups/9876": groupPatchH,
+		"POST/scim/Roles/123":   rolePatchH,
+		"POST/scim/Roles":       scimDefaultRoleHandler()})
+	defer srv.Close()
+	state := "users:\n- {name: john, family: wayne}\n- {name: sandy}\n" +
+		"groups:\n- {name: grease, description: soul}\n" +
+		"roles:\n- {name: dancer, members: [john, olivia]}\n- {name: singer}\n"
+	ApplyState(ctx, applyStateFile(t, state), false, nil)
+	AssertOnlyInfoContains(t, ctx, "User 'sandy' successfully added")
+	AssertOnlyInfoContains(t, ctx, `User "john" updated`)
+	AssertOnlyInfoContains(t, ctx, `Group "grease" updated`)
+	AssertOnlyInfoContains(t, ctx, `Members of role "dancer" updated`)
+	AssertOnlyInfoContains(t, ctx, "Role 'singer' successfully added")
+}
+
+func TestApplyWithPruneRemovesMembersAndDeletes(t *testing.T) {
+	groupPatchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `{"Value":"54321","Type":"User","Operation":"delete"}`)
+		return &TstReply{Status: 204}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:             GoodPathHandler(applyUsersReply),
+		applyGroupsURL:            GoodPathHandler(applyGroupsReply),
+		applyRolesURL:             GoodPathHandler(applyRolesReply),
+		"POST/scim/Groups/6789":   groupPatchH,
+		"DELETE/scim/Groups/9876": GoodPathHandler(""),
+		"DELETE/scim/Users/54321": GoodPathHandler("")})
+	defer srv.Close()
+	state := "users:\n- {name: john}\ngroups:\n- {name: saturday-night-fever, members: [john]}\n"
+	ApplyState(ctx, applyStateFile(t, state), true, nil)
+	AssertOnlyInfoContains(t, ctx, `Members of group "saturday-night-fever" updated`)
+	AssertOnlyInfoContains(t, ctx, `Groups "grease" deleted`)
+	AssertOnlyInfoContains(t, ctx, `Users "olivia" deleted`)
+}
+
+func TestApplyReportsUnknownMember(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:  GoodPathHandler(applyUsersReply),
+		applyGroupsURL: GoodPathHandler(applyGroupsReply),
+		applyRolesURL:  GoodPathHandler(applyRolesReply)})
+	defer srv.Close()
+	ApplyState(ctx, applyStateFile(t, "groups:\n- {name: grease, members: [danny]}\n"), false, nil)
+	AssertErrorContains(t, ctx, `Error updating members of group "grease": no user found named "danny"`)
+}
+
+func TestApplyWithPruneOnlyDeletesKindsInStateFile(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:             GoodPathHandler(applyUsersReply),
+		applyGroupsURL:            GoodPathHandler(applyGroupsReply),
+		applyRolesURL:             GoodPathHandler(applyRolesReply),
+		"DELETE/scim/Groups/9876": GoodPathHandler("")})
+	defer srv.Close()
+	state := "groups:\n- {name: saturday-night-fever}\n"
+	assert.Nil(t, ApplyState(ctx, applyStateFile(t, state), true, nil))
+	AssertOnlyInfoContains(t, ctx, `Groups "grease" deleted`)
+	assert.NotContains(t, ctx.Log.InfoString(), "Users")
+}
+
+func TestApplyWithPruneDoesNotDeleteLoggedInUser(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "54321", "prn": "olivia@tenant"}).
+		SignedString([]byte("secret"))
+	assert.Nil(t, err)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:  GoodPathHandler(applyUsersReply),
+		applyGroupsURL: GoodPathHandler(applyGroupsReply),
+		applyRolesURL:  GoodPathHandler(applyRolesReply)})
+	defer srv.Close()
+	ctx.Authorization("Bearer " + token)
+	assert.Nil(t, ApplyState(ctx, applyStateFile(t, "users:\n- {name: john}\n"), true, nil))
+	AssertOnlyInfoContains(t, ctx, `Not deleting user "olivia" who is logged in`)
+	assert.NotContains(t, ctx.Log.InfoString(), "deleted")
+}
+
+func TestApplyWithPruneDeletesNothingIfNotConfirmed(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:  GoodPathHandler(applyUsersReply),
+		applyGroupsURL: GoodPathHandler(applyGroupsReply),
+		applyRolesURL:  GoodPathHandler(applyRolesReply)})
+	defer srv.Close()
+	var prompts []string
+	err := ApplyState(ctx, applyStateFile(t, "users: []\ngroups: []\n"), true, func(prompt string) bool {
+		prompts = append(prompts, prompt)
+		return false
+	})
+	assert.Equal(t, ErrUsage, KindOf(err))
+	assert.Equal(t, []string{"Delete 2 users and 2 groups, and remove 0 members of groups and roles, that are not in the state file?"}, prompts)
+	AssertErrorContains(t, ctx, "Users, groups and members not in the state file were not deleted")
+	assert.NotContains(t, ctx.Log.InfoString(), "deleted")
+}
+
+func TestApplyWithPruneRemovesNoMembersIfNotConfirmed(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:  GoodPathHandler(applyUsersReply),
+		applyGroupsURL: GoodPathHandler(applyGroupsReply),
+		applyRolesURL:  GoodPathHandler(applyRolesReply)})
+	defer srv.Close()
+	var prompts []string
+	err := ApplyState(ctx, applyStateFile(t, "roles:\n- {name: dancer, members: []}\n"), true, func(prompt string) bool {
+		prompts = append(prompts, prompt)
+		return false
+	})
+	assert.Equal(t, ErrUsage, KindOf(err))
+	assert.Equal(t, []string{"Delete 0 users and 0 groups, and remove 1 members of groups and roles, that are not in the state file?"}, prompts)
+	assert.NotContains(t, ctx.Log.InfoString(), "updated")
+}
+
+func TestApplyWithPruneKeepsLoggedInUserInRoles(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"prn": "john@tenant"}).SignedString([]byte("secret"))
+	assert.Nil(t, err)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:  GoodPathHandler(applyUsersReply),
+		applyGroupsURL: GoodPathHandler(applyGroupsReply),
+		applyRolesURL:  GoodPathHandler(applyRolesReply)})
+	defer srv.Close()
+	ctx.Authorization("Bearer " + token)
+	assert.Nil(t, ApplyState(ctx, applyStateFile(t, "roles:\n- {name: dancer, members: []}\n"), true, func(string) bool {
+		t.Error("nothing should need to be confirmed")
+		return false
+	}))
+	AssertOnlyInfoContains(t, ctx, `Not removing the logged in user from role "dancer"`)
+	assert.NotContains(t, ctx.Log.InfoString(), "updated")
+}
+
+func TestApplyWithPruneDoesNotDeleteBuiltInOrDirectoryGroups(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL: GoodPathHandler(applyUsersReply),
+		applyGroupsURL: GoodPathHandler(`{"Resources": [{"displayName": "ALL USERS", "id": "1"},
+			{"displayName": "ldap-dancers", "id": "2", "` + wksExtSchemaURN + `": {"internalGroupType": "EXTERNAL"}},
+			{"displayName": "grease", "id": "9876", "` + wksExtSchemaURN + `": {"internalGroupType": "INTERNAL"}}]}`),
+		applyRolesURL:             GoodPathHandler(applyRolesReply),
+		"DELETE/scim/Groups/9876": GoodPathHandler("")})
+	defer srv.Close()
+	assert.Nil(t, ApplyState(ctx, applyStateFile(t, "groups: []\n"), true, nil))
+	AssertOnlyInfoContains(t, ctx, `Groups "grease" deleted`)
+	AssertOnlyInfoContains(t, ctx, `Not deleting group "ALL USERS" which is built in or synced from a directory`)
+	AssertOnlyInfoContains(t, ctx, `Not deleting group "ldap-dancers" which is built in or synced from a directory`)
+}
+
+func TestApplyUpdatesOtherUserAttributes(t *testing.T) {
+	var schemaRequests int32
+	userPatchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Active":false`)
+		assert.Contains(t, req.Input, `"ExternalId":"hr-7"`)
+		assert.Contains(t, req.Input, `"PhoneNumbers":[{"Value":"555-1234"}]`)
+		assert.Contains(t, req.Input, `"`+customURN+`":{"badge":7}`)
+		return &TstReply{Status: 204}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		applyUsersURL:           GoodPathHandler(applyUsersReply),
+		applyGroupsURL:          GoodPathHandler(applyGroupsReply),
+		applyRolesURL:           GoodPathHandler(applyRolesReply),
+		userSchemaURL:           userSchemaHandler(&schemaRequests),
+		"POST/scim/Users/12345": userPatchH})
+	defer srv.Close()
+	state := "users:\n- {name: john, active: false, externalId: hr-7, phones: [555-1234], extensions: {'" +
+		customURN + "': {badge: '7'}}}\n- {name: olivia}\n"
+	assert.Nil(t, ApplyState(ctx, applyStateFile(t, state), false, nil))
+	AssertOnlyInfoContains(t, ctx, `User "john" updated`)
+}
@@ -38,6 +38,8 @@ type priamApp struct {
 	IconFile              string                   `json:"iconFile,omitempty" yaml:"iconFile,omitempty"`
 	EntitleGroup          string                   `json:"entitleGroup,omitempty" yaml:"entitleGroup,omitempty"`
 	EntitleUser           string                   `json:"entitleUser,omitempty" yaml:"entitleUser,omitempty"`
+	EntitleGroups         []appSubject             `json:"-" yaml:"entitleGroups,omitempty"`
+	EntitleUsers          []appSubject             `json:"-" yaml:"entitleUsers,omitempty"`
 	ResourceConfiguration map[string]interface{}   `json:"resourceConfiguration" yaml:"resourceConfiguration,omitempty"`
 	AccessPolicy          string                   `json:"accessPolicy,omitempty" yaml:"accessPolicy,omitempty"`
 	AccessPolicySetUuid   string                   `json:"accessPolicySetUuid,omitempty" yaml:"accessPolicySetUuid,omitempty"`
@@ -60,41 +62,46 @@ type itemResponse struct {
 }
 
 // Display application info
-func (service IDMApplicationService) Display(ctx *HttpContext, appName string) {
-	appGet(ctx, appName)
+func (service IDMApplicationService) Display(ctx *HttpContext, appName string) error {
+	return appGet(ctx, appName)
 }
 
 // Delete given application from the catalog
-func (service IDMApplicationService) Delete(ctx *HttpContext, appName string) {
-	appDelete(ctx, appName)
+func (service IDMApplicationService) Delete(ctx *HttpContext, appName string) error {
+	return appDelete(ctx, appName)
 }
 
 // List all applications in the catalog
-func (service IDMApplicationService) List(ctx *HttpContext, count int, filter string) {
-	appList(ctx, count, filter)
+func (service IDMApplicationService) List(ctx *HttpContext, count int, filter string) error {
+	return appList(ctx, count, filter)
 }
 
 // Publish an application
-func (service IDMApplicationService) Publish(ctx *HttpContext, manifestFile string) {
-	PublishApps(ctx, manifestFile)
+func (service IDMApplicationService) Publish(ctx *HttpContext, manifestFile string, revoke bool) error {
+	return PublishApps(ctx, manifestFile, revoke)
 }
 
-func accessPolicyId(ctx *HttpContext, name string) string {
+// Export applications to a manifest
+func (service IDMApplicationService) Export(ctx *HttpContext, name, manifestFile string) error {
+	return ExportApps(ctx, name, manifestFile)
+}
+
+func accessPolicyId(ctx *HttpContext, name string) (string, error) {
 	outp := &itemResponse{}
 	ctx.Accept("accesspolicyset.list")
 	if err := ctx.Request("GET", "accessPolicies", nil, &outp); err != nil {
 		ctx.Log.Err("Error getting access policies: %v\n", err)
-		return ""
+		return "", err
 	}
 	for _, item := range outp.Items {
 		if name == "" && item["base"] == true || CaselessEqual(name, item["name"]) {
 			if s, ok := item["uuid"].(string); ok {
-				return s
+				return s, nil
 			}
 		}
 	}
 	ctx.Log.Err("Could not find access policy uuid\n")
-	return ""
+	return "", NewError(ErrNotFound, "no access policy found named \"%s\"", name)
 }
 
 // input name, uuid
@@ -102,7 +109,7 @@ func accessPolicyId(ctx *HttpContext, name string) string {
 func checkAppExists(ctx *HttpContext, name, uuid string) (outid string, err error) {
 	outp := &itemResponse{}
 	ctx.Accept("catalog.summary.list").ContentType("catalog.search")
-	if err = ctx.Request("POST", "catalogitems/search?pageSize=10000", "{}", &outp); err == nil {
+	if err = ctx.ReadRequest("POST", "catalogitems/search?pageSize=10000", "{}", &outp); err == nil {
 		for _, item := range outp.Items {
 			if CaseEqual(uuid, item["uuid"]) {
 				outid = uuid
@@ -119,11 +126,11 @@ func checkAppExists(ctx *HttpContext, name, uuid string) (outid string, err erro
 func getAppUuid(ctx *HttpContext, name string) (uuid, mtype string, err error) {
 	inp, outp := fmt.Sprintf(`{"nameFilter":"%s"}`, EscapeQuotes(name)), new(itemResponse)
 	ctx.Accept("catalog.summary.list").ContentType("catalog.search")
-	if err = ctx.Request("POST", "catalogitems/search?pageSize=10000", &inp, &outp); err == nil {
+	if err = ctx.ReadRequest("POST", "catalogitems/search?pageSize=10000", &inp, &outp); err == nil {
 		for _, item := range outp.Items {
 			if u, ok := item["uuid"].(string); ok && CaselessEqual(name, item["name"]) {
 				if uuid != "" {
-					err = fmt.Errorf("Multiple apps with name \"%s\"", name)
+					err = NewError(ErrConflict, "Multiple apps with name \"%s\"", name)
 					return
 				}
 				uuid = u
@@ -133,8 +140,8 @@ func getAppUuid(ctx *HttpContext, name string) (uuid, mtype string, err error) {
 			}
 		}
 	}
-	if uuid == "" {
-		err = fmt.Errorf("No app found with name \"%s\"", name)
+	if uuid == "" && err == nil {
+		err = NewError(ErrNotFound, "No app found with name \"%s\"", name)
 	}
 	return
 }
@@ -145,36 +152,52 @@ func getAppByUuid(ctx *HttpContext, uuid, mtype string) (app map[string]interfac
 	return
 }
 
-func PublishApps(ctx *HttpContext, manifile string) {
+// returns the entitlements to the app of the users and groups of the manifest
+func (w *priamApp) entitlements() (ents []Entitlement) {
+	groups, users := w.EntitleGroups, w.EntitleUsers
+	if w.EntitleGroup != "" {
+		groups = append([]appSubject{{Name: w.EntitleGroup}}, groups...)
+	}
+	if w.EntitleUser != "" {
+		users = append([]appSubject{{Name: w.EntitleUser}}, users...)
+	}
+	for _, g := range groups {
+		ents = append(ents, Entitlement{Group: g.Name, App: w.Name, Activation: g.Activation})
+	}
+	for _, u := range users {
+		ents = append(ents, Entitlement{User: u.Name, App: w.Name, Activation: u.Activation})
+	}
+	return
+}
+
+// PublishApps adds or updates the applications of the manifest in the catalog, and adds the
+// entitlements of the manifest that the applications do not have. With revoke, entitlements
+// that are not in the manifest are removed. Nothing is published if the manifest is not valid.
+// Applications that cannot be published are skipped, and the first error is returned.
+func PublishApps(ctx *HttpContext, manifile string, revoke bool) (firstErr error) {
 	if manifile == "" {
 		manifile = "manifest.yaml"
 	}
-	var manifest struct{ Applications []manifestApp }
-	if err := GetYamlFile(manifile, &manifest); err != nil {
-		ctx.Log.Err("Error getting manifest: %v\n", err)
-		return
+	apps, err := readManifest(ctx, manifile)
+	if err != nil {
+		return err
 	}
-	manifest.Applications[0].Workspace.AuthInfo = ChangeKeysToString(manifest.Applications[0].Workspace.AuthInfo).(map[string]interface{})
-	for _, v := range manifest.Applications {
-		var w = &v.Workspace
-		if w.Name == "" {
-			w.Name = v.Name
-		}
+	for _, w := range apps {
+		ents := w.entitlements()
 		if w.AccessPolicySetUuid == "" {
-			if w.AccessPolicySetUuid = accessPolicyId(ctx, w.AccessPolicy); w.AccessPolicySetUuid == "" {
+			var err error
+			if w.AccessPolicySetUuid, err = accessPolicyId(ctx, w.AccessPolicy); err != nil {
 				ctx.Log.Err("Skipping app %s\n", w.Name) // accessPolicyID logs any errors so user knows reason for skip
+				keepFirst(&firstErr, err)
 				continue
 			}
 			w.AccessPolicy = ""
-		} else if w.AccessPolicy != "" {
-			ctx.Log.Err("Invalid manifest for %s: both accessPolicy \"%s\" and AccessPolicySetUuid \"%s\" cannot be specified\n",
-				w.Name, w.AccessPolicy, w.AccessPolicySetUuid)
-			continue
 		}
 		method, path, errVerb, successVerb := "POST", "catalogitems", "adding", "added"
 		id, err := checkAppExists(ctx, w.Name, w.Uuid)
 		if err != nil {
 			ctx.Log.Err("Error checking if app %s exists: %v\n", w.Name, err)
+			keepFirst(&firstErr, err)
 			continue
 		}
 		if id != "" {
@@ -185,11 +208,12 @@ func PublishApps(ctx *HttpContext, manifile string) {
 			w.Uuid = uuid.New()
 		}
 		mtype := "catalog." + strings.ToLower(w.CatalogItemType)
-		iconFile, entitleGrp, entitleUser := w.IconFile, w.EntitleGroup, w.EntitleUser
+		iconFile := w.IconFile
 		w.IconFile, w.EntitleGroup, w.EntitleUser = "", "", ""
 		content, err := ToJson(w)
 		if err != nil {
 			ctx.Log.Err("Error converting app %s to JSON: %v (%v)\n", w.Name, err, w)
+			keepFirst(&firstErr, err)
 			continue
 		}
 		if iconFile == "" {
@@ -199,35 +223,43 @@ func PublishApps(ctx *HttpContext, manifile string) {
 		}
 		if err != nil {
 			ctx.Log.Err("Error %s %s to the catalog: %v\n", errVerb, w.Name, err)
+			keepFirst(&firstErr, err)
 			continue
 		}
 		ctx.Log.Info("App \"%s\" %s to the catalog\n", w.Name, successVerb)
-		maybeEntitle(ctx, w.Uuid, entitleGrp, "group", "displayName", w.Name)
-		maybeEntitle(ctx, w.Uuid, entitleUser, "user", "userName", w.Name)
+		keepFirst(&firstErr, reconcileEntitlements(ctx, w.Name, w.Uuid, ents, method == "POST", revoke))
 	}
+	return
 }
 
-func appDelete(ctx *HttpContext, name string) {
-	if uuid, _, err := getAppUuid(ctx, name); err != nil {
+func appDelete(ctx *HttpContext, name string) error {
+	uuid, _, err := getAppUuid(ctx, name)
+	if err != nil {
 		ctx.Log.Err("Error getting app info by name: %v\n", err)
-	} else if err := ctx.Request("DELETE", fmt.Sprintf("catalogitems/%s", uuid), nil, nil); err != nil {
+	} else if err = ctx.Request("DELETE", fmt.Sprintf("catalogitems/%s", uuid), nil, nil); err != nil {
 		ctx.Log.Err("Error deleting app %s from catalog: %v\n", name, err)
 	} else {
 		ctx.Log.Info("app %s deleted\n", name)
 	}
+	return err
 }
 
-func appGet(ctx *HttpContext, name string) {
-	if uuid, mtype, err := getAppUuid(ctx, name); err != nil {
+func appGet(ctx *HttpContext, name string) error {
+	uuid, mtype, err := getAppUuid(ctx, name)
+	if err != nil {
 		ctx.Log.Err("Error getting app info by name: %v\n", err)
-	} else if app, err := getAppByUuid(ctx, uuid, mtype); err != nil {
+		return err
+	}
+	app, err := getAppByUuid(ctx, uuid, mtype)
+	if err != nil {
 		ctx.Log.Err("Error getting app info by uuid: %v\n", err)
 	} else {
 		ctx.Log.PP("App "+name, app)
 	}
+	return err
 }
 
-func appList(ctx *HttpContext, count int, filter string) {
+func appList(ctx *HttpContext, count int, filter string) error {
 	if count == 0 {
 		count = 10000
 	}
@@ -237,9 +269,11 @@ func appList(ctx *HttpContext, count int, filter string) {
 	}
 	body := make(map[string]interface{})
 	ctx.Accept("catalog.summary.list").ContentType("catalog.search")
-	if err := ctx.Request("POST", path, input, &body); err != nil {
+	err := ctx.ReadRequest("POST", path, input, &body)
+	if err != nil {
 		ctx.Log.Err("Error: %v\n", err)
 	} else {
 		ctx.Log.PP("Apps", body["items"], "name", "description", "catalogItemType", "uuid")
 	}
+	return err
 }
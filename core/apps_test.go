@@ -16,6 +16,7 @@ limitations under the License.
 package core
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -58,6 +59,7 @@ const appSearchPath = "POST/catalogitems/search?pageSize=10000"
 const appGetResults = `{"catalogItemType" : "snowman", "name": "olaf"}`
 const appDeletePath = "DELETE/catalogitems/6c48beb6-afb1-44bc-ad7f-980214ee346c"
 const appPutPath = "PUT/catalogitems/6c48beb6-afb1-44bc-ad7f-980214ee346c"
+const appEntitlementsPath = "GET/entitlements/definitions/catalogitems/6c48beb6-afb1-44bc-ad7f-980214ee346c"
 
 var appSearchGetHandlers = map[string]TstHandler{
 	appGetPath:    appGetH(appGetResults, 0),
@@ -257,6 +259,17 @@ type appPubEnv struct {
 
 const noIconFile = "<none>"
 
+// Handler for bulk entitlement requests that returns a created status for each operation
+func bulkCreatedH(t *testing.T, req *TstReq) *TstReply {
+	var input struct{ Operations []interface{} }
+	require.Nil(t, json.Unmarshal([]byte(req.Input), &input))
+	results := make([]string, len(input.Operations))
+	for i := range results {
+		results[i] = `{"status": "201"}`
+	}
+	return &TstReply{Output: `{"operations": [` + strings.Join(results, ", ") + `]}`, ContentType: "application/json"}
+}
+
 func PublishAppTester(t *testing.T, env appPubEnv) *HttpContext {
 	return PublishAppTesterForManifest(t, env, testManifest)
 }
@@ -286,12 +299,13 @@ func PublishAppTesterForManifest(t *testing.T, env appPubEnv, manifestContent st
 			return &TstReply{Output: accessPolicyResult}
 		},
 		groupPath:                       GoodPathHandler(groupGetResult),
-		"POST/entitlements/definitions": GoodPathHandler(""),
+		"POST/entitlements/definitions": bulkCreatedH,
+		appEntitlementsPath:             GoodPathHandler(`{"items": []}`),
 		appPutPath:                      env.appPutH,
 	}
 	srv, ctx := NewTestContext(t, paths)
 	defer srv.Close()
-	new(IDMApplicationService).Publish(ctx, tmpFile.Name())
+	new(IDMApplicationService).Publish(ctx, tmpFile.Name(), false)
 	return ctx
 }
 
@@ -348,14 +362,18 @@ func TestPublishAppNoIconFileError(t *testing.T) {
 func TestGetAccessPolicyError(t *testing.T) {
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"GET/accessPolicies": ErrorHandler(403, "not found")})
 	defer srv.Close()
-	assert.Empty(t, accessPolicyId(ctx, "hans"))
+	id, err := accessPolicyId(ctx, "hans")
+	assert.Empty(t, id)
+	assert.Equal(t, ErrAuth, KindOf(err))
 	AssertErrorContains(t, ctx, `Error getting access policies: 403 Forbidden`)
 }
 
 func TestGetAccessPolicyNotFound(t *testing.T) {
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"GET/accessPolicies": GoodPathHandler(accessPolicyResult)})
 	defer srv.Close()
-	assert.Empty(t, accessPolicyId(ctx, "hans"))
+	id, err := accessPolicyId(ctx, "hans")
+	assert.Empty(t, id)
+	assert.Equal(t, ErrNotFound, KindOf(err))
 	AssertErrorContains(t, ctx, `Could not find access policy uuid`)
 }
 
@@ -382,7 +400,7 @@ func TestPublishAppBadManifest(t *testing.T) {
 	require.True(t, os.IsNotExist(err), "manifest file must not exist")
 	srv, ctx := NewTestContext(t, appSearchGetHandlers)
 	defer srv.Close()
-	PublishApps(ctx, "")
+	PublishApps(ctx, "", false)
 	AssertErrorContains(t, ctx, `Error getting manifest: open manifest.yaml: no such file or directory`)
 }
 
@@ -425,3 +443,8 @@ func TestPublishAppValidYAMLAuthInfoArrayOfArray(t *testing.T) {
 	AssertOnlyInfoContains(t, ctx, `App "olaf" added to the catalog`)
 	AssertOnlyInfoContains(t, ctx, `Entitled group "ALL USERS" to app "olaf"`)
 }
+
+func TestPublishAppWithInvalidEntitlementIsSkipped(t *testing.T) {
+	ctx := PublishAppTesterForManifest(t, appPubEnv{}, testManifestPrefix+"\n    entitleUsers: [{name: joe, activation: never}]\n")
+	AssertOnlyErrorContains(t, ctx, `Invalid manifest for olaf: user "joe": activation must be automatic or user, not "never"`)
+}
@@ -0,0 +1,243 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	. "github.com/vmware/priam/util"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffKinds are the kinds of resources that can be compared between targets
+var DiffKinds = []string{"users", "groups", "apps", "clients", "templates", "policies"}
+
+// fields generated by the server, which differ between tenants for the same resource
+var generatedFields = map[string]bool{"id": true, "meta": true, "_links": true, "uuid": true}
+
+// returns true if the field is generated by the server, or refers to another resource by its
+// uuid, such as accessPolicySetUuid, which differs between tenants
+func generatedField(name string) bool {
+	return generatedFields[name] || strings.HasSuffix(name, "Uuid")
+}
+
+// returns true if the value of the field at the path is a secret that is not shown, such as the
+// secret of a client
+func secretField(path string) bool {
+	name := path[strings.LastIndex(path, ".")+1:]
+	return name == "secret" || name == "password" || strings.HasSuffix(name, "Secret") || strings.HasSuffix(name, "Password")
+}
+
+// gets the resources of a kind, by name
+type diffSource struct {
+	label string // singular name of the kind, used in the output
+	fetch func(ctx *HttpContext) (map[string]map[string]interface{}, error)
+}
+
+// gets the resources in the items of a list, by the value of the name attribute. A search
+// with a content type is sent an empty query.
+func fetchItems(method, path, accept, contentType, nameAttr string) func(ctx *HttpContext) (map[string]map[string]interface{}, error) {
+	return func(ctx *HttpContext) (map[string]map[string]interface{}, error) {
+		outp, input := &itemResponse{}, interface{}(nil)
+		ctx.Accept(accept)
+		if contentType != "" {
+			ctx.ContentType(contentType)
+			input = "{}"
+		}
+		if err := ctx.ReadRequest(method, path, input, &outp); err != nil {
+			return nil, err
+		}
+		items := make(map[string]map[string]interface{})
+		for _, item := range outp.Items {
+			if name := InterfaceToString(item[nameAttr]); name != "" {
+				items[name] = item
+			}
+		}
+		return items, nil
+	}
+}
+
+// gets SCIM resources, by name
+func fetchSCIM(resType, nameAttr string) func(ctx *HttpContext) (map[string]map[string]interface{}, error) {
+	return func(ctx *HttpContext) (map[string]map[string]interface{}, error) {
+		index, err := scimIndexByName(ctx, resType, nameAttr)
+		if err != nil {
+			return nil, err
+		}
+		items := make(map[string]map[string]interface{})
+		for _, item := range index {
+			items[InterfaceToString(item[nameAttr])] = item
+		}
+		return items, nil
+	}
+}
+
+var diffSources = map[string]diffSource{
+	"users":     {"user", fetchSCIM("Users", "userName")},
+	"groups":    {"group", fetchSCIM("Groups", "displayName")},
+	"apps":      {"app", fetchItems("POST", "catalogitems/search?pageSize=10000", "catalog.summary.list", "catalog.search", "name")},
+	"clients":   {"client", fetchItems("GET", OauthClientService.path, OauthClientService.listMT, "", "clientId")},
+	"templates": {"template", fetchItems("GET", AppTemplateService.path, AppTemplateService.listMT, "", "appProductId")},
+	"policies":  {"policy", fetchItems("GET", "accessPolicies", "accesspolicyset.list", "", "name")},
+}
+
+/* withoutGeneratedFields returns a value without the fields generated by the server.
+   References to other resources, which are objects with a value and a display name, are
+   replaced by the display name since the value is an id that differs between tenants, and
+   references by uuid are left out.
+*/
+func withoutGeneratedFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if display, ok := v["display"].(string); ok && v["value"] != nil {
+			return display
+		}
+		out := make(map[string]interface{})
+		for k, e := range v {
+			if !generatedField(k) {
+				out[k] = withoutGeneratedFields(e)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = withoutGeneratedFields(e)
+		}
+		return out
+	}
+	return value
+}
+
+// adds the values of the nested fields of a value to the map, by their path joined with dots
+func flatten(prefix string, value interface{}, fields map[string]interface{}) {
+	if m, ok := value.(map[string]interface{}); ok {
+		for k, v := range m {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flatten(path, v, fields)
+		}
+	} else {
+		fields[prefix] = value
+	}
+}
+
+func jsonString(value interface{}) string {
+	if value == nil {
+		return "(none)"
+	}
+	s, _ := json.Marshal(value)
+	return string(s)
+}
+
+// returns a value of a field as shown in a change, secrets are only shown as set or not
+func changeValue(path string, value interface{}) string {
+	if value != nil && secretField(path) {
+		return "<redacted>"
+	}
+	return jsonString(value)
+}
+
+// returns the fields that differ between two resources, in order, as "field: a -> b"
+func fieldChanges(a, b map[string]interface{}) (changes []string) {
+	fieldsA, fieldsB := make(map[string]interface{}), make(map[string]interface{})
+	flatten("", withoutGeneratedFields(a), fieldsA)
+	flatten("", withoutGeneratedFields(b), fieldsB)
+	paths := make(map[string]bool)
+	for path := range fieldsA {
+		paths[path] = true
+	}
+	for path := range fieldsB {
+		paths[path] = true
+	}
+	for path := range paths {
+		if !reflect.DeepEqual(fieldsA[path], fieldsB[path]) {
+			changes = append(changes, path+": "+changeValue(path, fieldsA[path])+" -> "+changeValue(path, fieldsB[path]))
+		}
+	}
+	sort.Strings(changes)
+	return
+}
+
+func sortedKeys(items ...map[string]map[string]interface{}) []string {
+	keys := make(map[string]bool)
+	for _, m := range items {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+/* DiffTargets shows the differences between the resources of the given kinds in two targets,
+   all kinds if none are given. Resources are matched by name. Resources only in the first
+   target are shown with "-", only in the second with "+", and resources in both with fields
+   that differ are shown with "~" and each field that differs. Fields generated by the server,
+   such as ids, and references by uuid are ignored. Secrets are shown as redacted.
+*/
+func DiffTargets(ctxA, ctxB *HttpContext, nameA, nameB string, kinds []string) error {
+	if len(kinds) == 0 {
+		kinds = DiffKinds
+	}
+	for _, kind := range kinds {
+		if _, ok := diffSources[strings.ToLower(kind)]; !ok {
+			ctxA.Log.Err("Unknown kind \"%s\", must be one of %s\n", kind, strings.Join(DiffKinds, ", "))
+			return NewError(ErrUsage, "unknown kind \"%s\"", kind)
+		}
+	}
+	ctxA.Log.Info("--- %s\n+++ %s\n", nameA, nameB)
+	for _, kind := range kinds {
+		kind = strings.ToLower(kind)
+		source := diffSources[kind]
+		itemsA, err := source.fetch(ctxA)
+		if err != nil {
+			ctxA.Log.Err("Error getting %s of %s: %v\n", kind, nameA, err)
+			return err
+		}
+		itemsB, err := source.fetch(ctxB)
+		if err != nil {
+			ctxA.Log.Err("Error getting %s of %s: %v\n", kind, nameB, err)
+			return err
+		}
+		added, removed, changed := 0, 0, 0
+		for _, name := range sortedKeys(itemsA, itemsB) {
+			a, b := itemsA[name], itemsB[name]
+			switch {
+			case b == nil:
+				ctxA.Log.Info("- %s \"%s\"\n", source.label, name)
+				removed++
+			case a == nil:
+				ctxA.Log.Info("+ %s \"%s\"\n", source.label, name)
+				added++
+			default:
+				if changes := fieldChanges(a, b); len(changes) > 0 {
+					ctxA.Log.Info("~ %s \"%s\"\n    %s\n", source.label, name, strings.Join(changes, "\n    "))
+					changed++
+				}
+			}
+		}
+		ctxA.Log.Info("%s: %d only in %s, %d only in %s, %d changed\n", kind, removed, nameA, added, nameB, changed)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"testing"
+)
+
+func TestDiffIgnoresGeneratedFieldsAndIdsOfReferences(t *testing.T) {
+	srvA, ctxA := NewTestContext(t, map[string]TstHandler{"GET/scim/Groups?count=10000": GoodPathHandler(`{"Resources": [
+		{"displayName": "dancers", "id": "1", "meta": {"version": "3"}, "members": [{"value": "11", "display": "joe"}]},
+		{"displayName": "singers", "id": "2", "description": "all singers", "members": [{"value": "12", "display": "sue"}]}]}`)})
+	defer srvA.Close()
+	srvB, ctxB := NewTestContext(t, map[string]TstHandler{"GET/scim/Groups?count=10000": GoodPathHandler(`{"Resources": [
+		{"displayName": "dancers", "id": "5", "meta": {"version": "1"}, "members": [{"value": "21", "display": "joe"}]},
+		{"displayName": "singers", "id": "6", "members": [{"value": "22", "display": "sue"}, {"value": "23", "display": "zoe"}]}]}`)})
+	defer srvB.Close()
+
+	assert.Nil(t, DiffTargets(ctxA, ctxB, "staging", "prod", []string{"Groups"}))
+	AssertOnlyInfoContains(t, ctxA, "--- staging\n+++ prod\n"+
+		"~ group \"singers\"\n    description: \"all singers\" -> (none)\n    members: [\"sue\"] -> [\"sue\",\"zoe\"]\n"+
+		"groups: 0 only in staging, 0 only in prod, 1 changed\n")
+}
+
+func TestDiffAppsAndPolicies(t *testing.T) {
+	srvA, ctxA := NewTestContext(t, map[string]TstHandler{
+		"POST/catalogitems/search?pageSize=10000": GoodPathHandler(`{"items": [{"name": "old", "uuid": "1"}, {"name": "crm", "uuid": "2"}]}`),
+		"GET/accessPolicies":                      GoodPathHandler(`{"items": [{"name": "default", "uuid": "3", "_links": {}}]}`)})
+	defer srvA.Close()
+	srvB, ctxB := NewTestContext(t, map[string]TstHandler{
+		"POST/catalogitems/search?pageSize=10000": GoodPathHandler(`{"items": [{"name": "crm", "uuid": "4"}, {"name": "new", "uuid": "5"}]}`),
+		"GET/accessPolicies":                      GoodPathHandler(`{"items": [{"name": "default", "uuid": "6", "_links": {"self": "x"}}]}`)})
+	defer srvB.Close()
+
+	assert.Nil(t, DiffTargets(ctxA, ctxB, "a", "b", []string{"apps", "policies"}))
+	AssertOnlyInfoContains(t, ctxA, "+ app \"new\"\n- app \"old\"\napps: 1 only in a, 1 only in b, 0 changed\n"+
+		"policies: 0 only in a, 0 only in b, 0 changed\n")
+}
+
+func TestDiffIgnoresUuidReferencesAndRedactsSecrets(t *testing.T) {
+	srvA, ctxA := NewTestContext(t, map[string]TstHandler{"GET/oauth2clients": GoodPathHandler(`{"items": [
+		{"clientId": "cli", "secret": "mumble", "accessPolicySetUuid": "1", "scope": "user"}]}`)})
+	defer srvA.Close()
+	srvB, ctxB := NewTestContext(t, map[string]TstHandler{"GET/oauth2clients": GoodPathHandler(`{"items": [
+		{"clientId": "cli", "secret": "grumble", "accessPolicySetUuid": "2", "scope": "admin"}]}`)})
+	defer srvB.Close()
+
+	assert.Nil(t, DiffTargets(ctxA, ctxB, "a", "b", []string{"clients"}))
+	AssertOnlyInfoContains(t, ctxA, "~ client \"cli\"\n    scope: \"user\" -> \"admin\"\n    secret: <redacted> -> <redacted>\n"+
+		"clients: 0 only in a, 0 only in b, 1 changed\n")
+	assert.NotContains(t, ctxA.Log.InfoString(), "mumble")
+}
+
+func TestDiffWithUnknownKindFails(t *testing.T) {
+	ctx := NewHttpContext(NewBufferedLogr(), "http://localhost", "/", "")
+	err := DiffTargets(ctx, ctx, "a", "b", []string{"widgets"})
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `Unknown kind "widgets", must be one of users, groups, apps`)
+}
+
+func TestDiffFailsIfResourcesCannotBeRead(t *testing.T) {
+	srvA, ctxA := NewTestContext(t, map[string]TstHandler{"GET/accessPolicies": GoodPathHandler(`{"items": []}`)})
+	defer srvA.Close()
+	srvB, ctxB := NewTestContext(t, map[string]TstHandler{"GET/accessPolicies": ErrorHandler(403, "not allowed")})
+	defer srvB.Close()
+	err := DiffTargets(ctxA, ctxB, "a", "b", []string{"policies"})
+	assert.Equal(t, ErrAuth, KindOf(err))
+	assert.Contains(t, ctxA.Log.ErrString(), "Error getting policies of b: 403 Forbidden")
+}
@@ -21,28 +21,32 @@ import (
 
 // The directory service interface.
 // The directory contains different entities (User, Group, Role, ...)
+// Errors are printed to the log of the context, and also returned so that callers can
+// tell how the operation failed.
 type DirectoryService interface {
 	// Add an entity
-	AddEntity(ctx *util.HttpContext, entity interface{})
+	AddEntity(ctx *util.HttpContext, entity interface{}) error
 
 	// Display an entity
-	DisplayEntity(ctx *util.HttpContext, name string)
+	DisplayEntity(ctx *util.HttpContext, name string) error
 
 	// Update the given entity referenced by the name parameter.
 	// Only the fields existing in the given entity will be updated.
-	UpdateEntity(ctx *util.HttpContext, name string, entity interface{})
+	UpdateEntity(ctx *util.HttpContext, name string, entity interface{}) error
 
 	// Delete the given entity
-	DeleteEntity(ctx *util.HttpContext, name string)
+	DeleteEntity(ctx *util.HttpContext, name string) error
 
-	// List existing entities
-	// @param count the number of entities to display
+	// List existing entities, fetching them a page at a time
+	// @param count the maximum number of entities to display, 0 for all
+	// @param startIndex the 1-based index of the first entity to display
+	// @param pageSize the number of entities to get per request, 0 for the server default
 	// @param filter the filter such as 'username eq \"joe\"' for SCIM resources
-	ListEntities(ctx *util.HttpContext, count int, filter string)
+	ListEntities(ctx *util.HttpContext, count, startIndex, pageSize int, filter string) error
 
-	// Create entities from a file
-	LoadEntities(ctx *util.HttpContext, fileName string)
+	// Create entities from a file, as many at the same time as set in the options
+	LoadEntities(ctx *util.HttpContext, fileName string, opts LoadOptions) error
 
 	// Adds or removes a user for entities that have members, like Group or Role
-	UpdateMember(ctx *util.HttpContext, name, member string, remove bool)
+	UpdateMember(ctx *util.HttpContext, name, member string, remove bool) error
 }
@@ -0,0 +1,219 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	. "github.com/vmware/priam/util"
+	"gopkg.in/yaml.v2"
+	"sort"
+	"strings"
+)
+
+// ReportFormats are the formats of the entitlement report
+var ReportFormats = []string{YamlFormat, CsvFormat}
+
+// access of a user to an app, through a group or directly if group is empty
+type accessRow struct {
+	App, User, Group, Activation string `yaml:",omitempty"`
+}
+
+/* groupUsers returns the names of the users of each group by its id, in order. Users are members
+   of the groups listed in their groups and of the groups that list them as members. Members of a
+   nested group are members of the groups that contain it, and every user is a member of ALL USERS.
+*/
+func groupUsers(users, groups scimIndex) map[string][]string {
+	userNames, isGroup := make(map[string]string), make(map[string]bool)
+	for _, u := range users {
+		userNames[InterfaceToString(u["id"])] = InterfaceToString(u["userName"])
+	}
+	for _, g := range groups {
+		isGroup[InterfaceToString(g["id"])] = true
+	}
+	direct, nested := membershipsByID(users, "groups"), make(map[string][]string)
+	addUser := func(gid, uid string) {
+		if direct[gid] == nil {
+			direct[gid] = make(map[string]bool)
+		}
+		direct[gid][uid] = true
+	}
+	for _, g := range groups {
+		gid := InterfaceToString(g["id"])
+		if CaselessEqual(allUsersGroup, g["displayName"]) {
+			for uid := range userNames {
+				addUser(gid, uid)
+			}
+		}
+		members, _ := g["members"].([]interface{})
+		for _, m := range members {
+			member, _ := m.(map[string]interface{})
+			if id := InterfaceToString(member["value"]); isGroup[id] {
+				nested[gid] = append(nested[gid], id)
+			} else if userNames[id] != "" {
+				addUser(gid, id)
+			}
+		}
+	}
+	var expand func(gid string, seen, uids map[string]bool)
+	expand = func(gid string, seen, uids map[string]bool) {
+		if seen[gid] {
+			return
+		}
+		seen[gid] = true
+		for uid := range direct[gid] {
+			uids[uid] = true
+		}
+		for _, id := range nested[gid] {
+			expand(id, seen, uids)
+		}
+	}
+	members := make(map[string][]string)
+	for gid := range isGroup {
+		uids := make(map[string]bool)
+		expand(gid, make(map[string]bool), uids)
+		for uid := range uids {
+			members[gid] = append(members[gid], userNames[uid])
+		}
+		sort.Strings(members[gid])
+	}
+	return members
+}
+
+// returns the rows of the access of users to an app from its entitlements. Group entitlements
+// give access to each member of the group, a group without members is given a row without a user.
+func appAccess(app string, ents []map[string]interface{}, users, groups scimIndex, members map[string][]string) (rows []accessRow) {
+	userNames, groupNames := make(map[string]string), make(map[string]string)
+	for _, u := range users {
+		userNames[InterfaceToString(u["id"])] = InterfaceToString(u["userName"])
+	}
+	for _, g := range groups {
+		groupNames[InterfaceToString(g["id"])] = InterfaceToString(g["displayName"])
+	}
+	for _, ent := range ents {
+		id, activation := InterfaceToString(ent["subjectId"]), InterfaceToString(ent["activationPolicy"])
+		switch strings.ToUpper(InterfaceToString(ent["subjectType"])) {
+		case "USERS":
+			rows = append(rows, accessRow{app, StringOrDefault(userNames[id], id), "", activation})
+		case "GROUPS":
+			group := StringOrDefault(groupNames[id], id)
+			if len(members[id]) == 0 {
+				rows = append(rows, accessRow{app, "", group, activation})
+			}
+			for _, user := range members[id] {
+				rows = append(rows, accessRow{app, user, group, activation})
+			}
+		}
+	}
+	return
+}
+
+// returns the rows as CSV with a header line
+func accessCsv(rows []accessRow) ([]byte, error) {
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Write([]string{"app", "user", "group", "activation"})
+	for _, r := range rows {
+		w.Write([]string{r.App, r.User, r.Group, r.Activation})
+	}
+	w.Flush()
+	return out.Bytes(), w.Error()
+}
+
+/* ReportEntitlements shows which users can access which apps, as one row for each user and
+   app with the group that gives access, if it is not given to the user directly, and the
+   activation policy. A user entitled through several groups has a row for each, and members
+   of nested groups are entitled through the groups that contain them. A group entitlement
+   without any member is reported as a row without a user so that it is not missed. The report
+   is of all apps, or only of the given app, user or group.
+*/
+func ReportEntitlements(ctx *HttpContext, app, user, group, format string) error {
+	format = strings.ToLower(StringOrDefault(format, YamlFormat))
+	if !HasString(format, ReportFormats) {
+		ctx.Log.Err("Unknown format \"%s\", must be one of %s\n", format, strings.Join(ReportFormats, ", "))
+		return NewError(ErrUsage, "unknown format \"%s\"", format)
+	}
+	users, err := scimIndexByName(ctx, "Users", "userName")
+	if err != nil {
+		ctx.Log.Err("Error getting users: %v\n", err)
+		return err
+	}
+	groups, err := scimIndexByName(ctx, "Groups", "displayName")
+	if err != nil {
+		ctx.Log.Err("Error getting groups: %v\n", err)
+		return err
+	}
+	apps, err := fetchItems("POST", "catalogitems/search?pageSize=10000", "catalog.summary.list", "catalog.search", "name")(ctx)
+	if err != nil {
+		ctx.Log.Err("Error getting apps: %v\n", err)
+		return err
+	}
+	appFound := false
+	for name := range apps {
+		appFound = appFound || strings.EqualFold(name, app)
+	}
+	for _, check := range []struct {
+		label, name string
+		found       bool
+	}{{"user", user, users[strings.ToLower(user)] != nil}, {"group", group, groups[strings.ToLower(group)] != nil},
+		{"app", app, appFound}} {
+		if check.name != "" && !check.found {
+			ctx.Log.Err("No %s found named \"%s\"\n", check.label, check.name)
+			return NewError(ErrNotFound, "no %s found named \"%s\"", check.label, check.name)
+		}
+	}
+	members := groupUsers(users, groups)
+	rows := []accessRow{}
+	for name, item := range apps {
+		if app != "" && !strings.EqualFold(name, app) {
+			continue
+		}
+		outp := &itemResponse{}
+		path := fmt.Sprintf("entitlements/definitions/catalogitems/%s", InterfaceToString(item["uuid"]))
+		if err = ctx.Accept("").Request("GET", path, nil, outp); err != nil {
+			ctx.Log.Err("Error getting entitlements of app \"%s\": %v\n", name, err)
+			return err
+		}
+		for _, row := range appAccess(name, outp.Items, users, groups, members) {
+			if (user == "" || strings.EqualFold(row.User, user)) && (group == "" || strings.EqualFold(row.Group, group)) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if !strings.EqualFold(a.App, b.App) {
+			return strings.ToLower(a.App) < strings.ToLower(b.App)
+		}
+		if !strings.EqualFold(a.User, b.User) {
+			return strings.ToLower(a.User) < strings.ToLower(b.User)
+		}
+		return strings.ToLower(a.Group) < strings.ToLower(b.Group)
+	})
+	var content []byte
+	if format == CsvFormat {
+		content, err = accessCsv(rows)
+	} else if content, err = yaml.Marshal(rows); err == nil {
+		content = append([]byte("---\n"), content...)
+	}
+	if err != nil {
+		ctx.Log.Err("Error writing entitlement report: %v\n", err)
+		return err
+	}
+	ctx.Log.Info("%s", content)
+	return nil
+}
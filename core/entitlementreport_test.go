@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"testing"
+)
+
+// returns the handlers of a tenant where joe is entitled to crm directly and through the
+// dancers group, and sue is entitled to wiki through the dancers group
+func entitlementReportHandlers() map[string]TstHandler {
+	return map[string]TstHandler{
+		"GET/scim/Users?count=10000": GoodPathHandler(`{"totalResults": 2, "Resources": [
+			{"userName": "joe", "id": "u1", "groups": [{"value": "g1"}]},
+			{"userName": "sue", "id": "u2", "groups": [{"value": "g1"}]}]}`),
+		"GET/scim/Groups?count=10000":             GoodPathHandler(`{"totalResults": 1, "Resources": [{"displayName": "dancers", "id": "g1"}]}`),
+		"POST/catalogitems/search?pageSize=10000": GoodPathHandler(`{"items": [{"name": "crm", "uuid": "a1"}, {"name": "wiki", "uuid": "a2"}]}`),
+		"GET/entitlements/definitions/catalogitems/a1": GoodPathHandler(`{"items": [
+			{"catalogItemId": "a1", "subjectType": "USERS", "subjectId": "u1", "activationPolicy": "AUTOMATIC"},
+			{"catalogItemId": "a1", "subjectType": "GROUPS", "subjectId": "g1", "activationPolicy": "USER_ACTIVATED"}]}`),
+		"GET/entitlements/definitions/catalogitems/a2": GoodPathHandler(`{"items": [
+			{"catalogItemId": "a2", "subjectType": "GROUPS", "subjectId": "g1", "activationPolicy": "AUTOMATIC"}]}`)}
+}
+
+func TestEntitlementReportExpandsGroupsToUsers(t *testing.T) {
+	srv, ctx := NewTestContext(t, entitlementReportHandlers())
+	defer srv.Close()
+	assert.Nil(t, ReportEntitlements(ctx, "", "", "", "csv"))
+	assert.Equal(t, "app,user,group,activation\ncrm,joe,,AUTOMATIC\ncrm,joe,dancers,USER_ACTIVATED\n"+
+		"crm,sue,dancers,USER_ACTIVATED\nwiki,joe,dancers,AUTOMATIC\nwiki,sue,dancers,AUTOMATIC\n", ctx.Log.InfoString())
+}
+
+func TestEntitlementReportOfUser(t *testing.T) {
+	srv, ctx := NewTestContext(t, entitlementReportHandlers())
+	defer srv.Close()
+	assert.Nil(t, ReportEntitlements(ctx, "", "Sue", "", ""))
+	assert.Equal(t, "---\n- app: crm\n  user: sue\n  group: dancers\n  activation: USER_ACTIVATED\n"+
+		"- app: wiki\n  user: sue\n  group: dancers\n  activation: AUTOMATIC\n", ctx.Log.InfoString())
+}
+
+func TestEntitlementReportOfApp(t *testing.T) {
+	srv, ctx := NewTestContext(t, entitlementReportHandlers())
+	defer srv.Close()
+	assert.Nil(t, ReportEntitlements(ctx, "WIKI", "", "dancers", "csv"))
+	assert.Equal(t, "app,user,group,activation\nwiki,joe,dancers,AUTOMATIC\nwiki,sue,dancers,AUTOMATIC\n", ctx.Log.InfoString())
+}
+
+func TestEntitlementReportExpandsNestedAndAllUsersGroups(t *testing.T) {
+	handlers := entitlementReportHandlers()
+	handlers["GET/scim/Users?count=10000"] = GoodPathHandler(`{"totalResults": 3, "Resources": [
+		{"userName": "joe", "id": "u1"}, {"userName": "sue", "id": "u2"}, {"userName": "ann", "id": "u3"}]}`)
+	handlers["GET/scim/Groups?count=10000"] = GoodPathHandler(`{"totalResults": 4, "Resources": [
+		{"displayName": "dancers", "id": "g1", "members": [{"value": "u1", "type": "User"}, {"value": "g2", "type": "Group"}]},
+		{"displayName": "tango", "id": "g2", "members": [{"value": "u2", "type": "User"}, {"value": "g1", "type": "Group"}]},
+		{"displayName": "ALL USERS", "id": "g3"},
+		{"displayName": "singers", "id": "g4"}]}`)
+	handlers["GET/entitlements/definitions/catalogitems/a2"] = GoodPathHandler(`{"items": [
+		{"catalogItemId": "a2", "subjectType": "GROUPS", "subjectId": "g3", "activationPolicy": "AUTOMATIC"},
+		{"catalogItemId": "a2", "subjectType": "GROUPS", "subjectId": "g4", "activationPolicy": "AUTOMATIC"}]}`)
+	srv, ctx := NewTestContext(t, handlers)
+	defer srv.Close()
+	assert.Nil(t, ReportEntitlements(ctx, "", "", "", "csv"))
+	assert.Equal(t, "app,user,group,activation\ncrm,joe,,AUTOMATIC\ncrm,joe,dancers,USER_ACTIVATED\n"+
+		"crm,sue,dancers,USER_ACTIVATED\nwiki,,singers,AUTOMATIC\nwiki,ann,ALL USERS,AUTOMATIC\n"+
+		"wiki,joe,ALL USERS,AUTOMATIC\nwiki,sue,ALL USERS,AUTOMATIC\n", ctx.Log.InfoString())
+}
+
+func TestEntitlementReportOfUnknownGroupFails(t *testing.T) {
+	srv, ctx := NewTestContext(t, entitlementReportHandlers())
+	defer srv.Close()
+	err := ReportEntitlements(ctx, "", "", "singers", "csv")
+	assert.Equal(t, ErrNotFound, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `No group found named "singers"`)
+}
+
+func TestEntitlementReportWithUnknownFormatFails(t *testing.T) {
+	ctx := NewHttpContext(NewBufferedLogr(), "http://localhost", "/", "")
+	err := ReportEntitlements(ctx, "", "", "", "json")
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `Unknown format "json", must be one of yaml, csv`)
+}
@@ -16,67 +16,335 @@ limitations under the License.
 package core
 
 import (
+	"errors"
 	"fmt"
 	. "github.com/vmware/priam/util"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-const fmtEntitlement = `
-{
-  "returnPayloadOnError" : true,
-  "operations" : [ {
-    "method" : "POST",
-    "data" : {
-      "catalogItemId" : "%s",
-      "subjectType" : "%s",
-      "subjectId" : "%s",
-      "activationPolicy" : "AUTOMATIC"
-    }
-  } ]
-}`
-
-// Create entitlement for the given user or group
-func maybeEntitle(ctx *HttpContext, itemID, subjName, subjType, nameAttr, appName string) {
-	if subjName != "" {
-		subjID, err := scimGetID(ctx, strings.Title(subjType+"s"), nameAttr, subjName)
-		if err == nil {
-			err = entitleSubject(ctx, subjID, strings.ToUpper(subjType+"s"), itemID)
+// ActivationPolicies are the activation policies of entitlements, by the names used in
+// commands and files. Apps are added to the launcher of users automatically, or by the users.
+var ActivationPolicies = map[string]string{"automatic": "AUTOMATIC", "user": "USER_ACTIVATED"}
+
+// Entitlement of a user or group to an app, as read from a file of entitlements. The
+// activation is one of ActivationPolicies, automatic if not given.
+type Entitlement struct {
+	User, Group, App, Activation string `yaml:",omitempty"`
+}
+
+type entitlementData struct {
+	CatalogItemId    string `json:"catalogItemId"`
+	SubjectType      string `json:"subjectType"`
+	SubjectId        string `json:"subjectId"`
+	ActivationPolicy string `json:"activationPolicy,omitempty"`
+}
+
+type bulkOperation struct {
+	Method string          `json:"method"`
+	Data   entitlementData `json:"data"`
+}
+
+type bulkRequest struct {
+	ReturnPayloadOnError bool            `json:"returnPayloadOnError"`
+	Operations           []bulkOperation `json:"operations"`
+}
+
+// the result of each operation of a bulk request, in the order of the operations
+type bulkResponse struct {
+	Operations []struct {
+		Status interface{} // a number or a string, depending on the server version
+		Reason string
+	}
+}
+
+// an operation of a bulk request, with the entitlement it is for to report its result
+type entitlementOp struct {
+	bulkOperation
+	ent *Entitlement
+}
+
+// a user or group entitled to an app in a manifest, given by name or with an activation policy
+type appSubject struct {
+	Name       string
+	Activation string `yaml:",omitempty"`
+}
+
+// UnmarshalYAML reads a subject given only by its name as well as one with an activation policy
+func (s *appSubject) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&s.Name); err == nil {
+		return nil
+	}
+	type plain appSubject
+	return unmarshal((*plain)(s))
+}
+
+func bulkEntitlements(ctx *HttpContext, ops []bulkOperation, outp *bulkResponse) error {
+	ctx.Accept("bulk.sync.response").ContentType("entitlements.definition.bulk")
+	return ctx.Request("POST", "entitlements/definitions", &bulkRequest{true, ops}, outp)
+}
+
+// returns the error of a bulk operation, or nil if it succeeded
+func bulkOperationError(status interface{}, reason string) error {
+	code, err := strconv.Atoi(fmt.Sprint(status))
+	if err != nil {
+		return fmt.Errorf("no valid status in the result: %v", status)
+	}
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return &HttpError{StatusCode: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code)), Body: reason}
+}
+
+// returns the verbs used in messages about an operation with the method, before and after it is done
+func entitlementVerbs(method string) (string, string) {
+	if method == "DELETE" {
+		return "remove entitlement of", "Removed entitlement of"
+	}
+	return "entitle", "Entitled"
+}
+
+/* sendEntitlements sends the operations in one bulk request and reports the result of each.
+   Returns the number of operations that succeeded and the first error.
+*/
+func sendEntitlements(ctx *HttpContext, ops []entitlementOp) (done int, err error) {
+	if len(ops) == 0 {
+		return
+	}
+	bulk := make([]bulkOperation, len(ops))
+	for i := range ops {
+		bulk[i] = ops[i].bulkOperation
+	}
+	outp := &bulkResponse{}
+	if err = bulkEntitlements(ctx, bulk, outp); err != nil {
+		ctx.Log.Err("Error sending entitlements: %v\n", err)
+		return
+	}
+	if ctx.DryRun {
+		return
+	}
+	for i, op := range ops {
+		e := errors.New("no result returned for the operation")
+		if i < len(outp.Operations) {
+			e = bulkOperationError(outp.Operations[i].Status, outp.Operations[i].Reason)
 		}
-		if err != nil {
-			ctx.Log.Err("Could not entitle %s \"%s\" to app \"%s\", error: %v\n", subjType, subjName, appName, err)
+		verb, doneVerb := entitlementVerbs(op.Method)
+		if e != nil {
+			ctx.Log.Err("Could not %s %s to app \"%s\": %v\n", verb, op.ent.subject(), op.ent.App, e)
+			keepFirst(&err, e)
 		} else {
-			ctx.Log.Info("Entitled %s \"%s\" to app \"%s\".\n", subjType, subjName, appName)
+			ctx.Log.Info("%s %s to app \"%s\"\n", doneVerb, op.ent.subject(), op.ent.App)
+			done++
 		}
 	}
+	return
 }
 
-func entitleSubject(ctx *HttpContext, subjectId, subjectType, itemID string) error {
-	inp := fmt.Sprintf(fmtEntitlement, itemID, subjectType, subjectId)
-	ctx.Accept("bulk.sync.response").ContentType("entitlements.definition.bulk")
-	return ctx.Request("POST", "entitlements/definitions", inp, nil)
+// returns the subject of an entitlement for messages, as in 'user "joe"'
+func (e *Entitlement) subject() string {
+	if e.User != "" {
+		return fmt.Sprintf("user \"%s\"", e.User)
+	}
+	return fmt.Sprintf("group \"%s\"", e.Group)
+}
+
+// returns the SCIM resource type and name attribute of the subject of the entitlement, and its name
+func (e *Entitlement) scimSubject() (resType, nameAttr, name string) {
+	if e.Group != "" {
+		return "Groups", "displayName", e.Group
+	}
+	return "Users", "userName", e.User
+}
+
+// returns the activation policy of the entitlement as it is sent to the server
+func (e *Entitlement) policy() string {
+	return ActivationPolicies[strings.ToLower(StringOrDefault(e.Activation, "automatic"))]
+}
+
+// returns an error if the entitlement does not have exactly one subject, an app and a
+// known activation policy
+func (e *Entitlement) validate() error {
+	switch {
+	case (e.User == "") == (e.Group == ""):
+		return errors.New("either a user or a group must be given")
+	case e.App == "":
+		return errors.New("an app must be given")
+	case e.Activation != "" && ActivationPolicies[strings.ToLower(e.Activation)] == "":
+		return fmt.Errorf("activation must be automatic or user, not \"%s\"", e.Activation)
+	}
+	return nil
+}
+
+/* UpdateEntitlements adds the entitlements, or deletes them if remove is true. The users,
+   groups and apps are found by name, then all entitlements are sent in one bulk request, and
+   the result of each is reported. Entitlements that are not valid, or whose subject or app
+   cannot be found, are reported and skipped. Returns the first error.
+*/
+func UpdateEntitlements(ctx *HttpContext, ents []Entitlement, remove bool) (err error) {
+	for i := range ents {
+		if e := ents[i].validate(); e != nil {
+			ctx.Log.Err("Invalid entitlement %d: %v\n", i+1, e)
+			keepFirst(&err, &Error{Kind: ErrUsage, Err: e})
+		}
+	}
+	if err != nil {
+		return
+	}
+	method, summary := "POST", "added"
+	if remove {
+		method, summary = "DELETE", "deleted"
+	}
+	ids, apps := make(map[string]string), make(map[string]string)
+	var ops []entitlementOp
+	for i := range ents {
+		ent := &ents[i]
+		resType, nameAttr, name := ent.scimSubject()
+		subjID, e := ids[resType+"/"+name], error(nil)
+		if subjID == "" {
+			if subjID, e = scimGetID(ctx, resType, nameAttr, name); e == nil {
+				ids[resType+"/"+name] = subjID
+			}
+		}
+		appID := apps[strings.ToLower(ent.App)]
+		if appID == "" && e == nil {
+			if appID, _, e = getAppUuid(ctx, ent.App); e == nil {
+				apps[strings.ToLower(ent.App)] = appID
+			}
+		}
+		if e != nil {
+			verb, _ := entitlementVerbs(method)
+			ctx.Log.Err("Could not %s %s to app \"%s\": %v\n", verb, ent.subject(), ent.App, e)
+			keepFirst(&err, e)
+			continue
+		}
+		policy := ""
+		if !remove {
+			policy = ent.policy()
+		}
+		ops = append(ops, entitlementOp{bulkOperation{method, entitlementData{appID, strings.ToUpper(resType), subjID, policy}}, ent})
+	}
+	if len(ops) == 0 {
+		return
+	}
+	updated, e := sendEntitlements(ctx, ops)
+	keepFirst(&err, e)
+	if !ctx.DryRun {
+		ctx.Log.Info("%d of %d entitlements %s\n", updated, len(ents), summary)
+	}
+	return
+}
+
+// returns the entitlement of an app for an entitlement definition, with the name of its
+// subject, or its id if the name cannot be found
+func definedEntitlement(ctx *HttpContext, app string, def map[string]interface{}) *Entitlement {
+	id, ent := InterfaceToString(def["subjectId"]), &Entitlement{App: app}
+	resType, nameAttr := "Users", "userName"
+	if strings.EqualFold(InterfaceToString(def["subjectType"]), "GROUPS") {
+		resType, nameAttr = "Groups", "displayName"
+	}
+	subject, name := make(map[string]interface{}), id
+	if ctx.Accept("json").Request("GET", "scim/"+resType+"/"+id, nil, &subject) == nil {
+		name = StringOrDefault(InterfaceToString(subject[nameAttr]), id)
+	}
+	if resType == "Groups" {
+		ent.Group = name
+	} else {
+		ent.User = name
+	}
+	return ent
+}
+
+/* reconcileEntitlements makes the entitlements of an app match the given entitlements.
+   Entitlements that are missing, or that have another activation policy, are added. With
+   revoke, the entitlements of other users and groups are removed, unless some of the given
+   users or groups could not be found. An app that was just added has no entitlements to
+   compare with.
+*/
+func reconcileEntitlements(ctx *HttpContext, app, appID string, ents []Entitlement, added, revoke bool) (err error) {
+	current := make(map[string]map[string]interface{})
+	if !added {
+		outp := &itemResponse{}
+		path := fmt.Sprintf("entitlements/definitions/catalogitems/%s", appID)
+		if err = ctx.Accept("").Request("GET", path, nil, outp); err != nil {
+			ctx.Log.Err("Error getting entitlements of app \"%s\": %v\n", app, err)
+			return
+		}
+		for _, def := range outp.Items {
+			current[strings.ToUpper(InterfaceToString(def["subjectType"]))+"/"+InterfaceToString(def["subjectId"])] = def
+		}
+	}
+	var ops []entitlementOp
+	for i := range ents {
+		ent := &ents[i]
+		resType, nameAttr, name := ent.scimSubject()
+		id, e := scimGetID(ctx, resType, nameAttr, name)
+		if e != nil {
+			ctx.Log.Err("Could not entitle %s to app \"%s\": %v\n", ent.subject(), app, e)
+			keepFirst(&err, e)
+			continue
+		}
+		key := strings.ToUpper(resType) + "/" + id
+		if def := current[key]; def == nil || !CaselessEqual(ent.policy(), def["activationPolicy"]) {
+			ops = append(ops, entitlementOp{bulkOperation{"POST", entitlementData{appID, strings.ToUpper(resType), id, ent.policy()}}, ent})
+		}
+		delete(current, key)
+	}
+	if revoke && err != nil && len(current) > 0 {
+		ctx.Log.Err("Not removing entitlements of app \"%s\" since some users or groups were not found\n", app)
+	} else if revoke {
+		keys := make([]string, 0, len(current))
+		for key := range current {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			def := current[key]
+			ops = append(ops, entitlementOp{bulkOperation{"DELETE", entitlementData{appID,
+				strings.ToUpper(InterfaceToString(def["subjectType"])), InterfaceToString(def["subjectId"]), ""}},
+				definedEntitlement(ctx, app, def)})
+		}
+	}
+	_, e := sendEntitlements(ctx, ops)
+	keepFirst(&err, e)
+	return
+}
+
+// LoadEntitlements adds the entitlements of a yaml file, or deletes them if remove is true
+func LoadEntitlements(ctx *HttpContext, fileName string, remove bool) error {
+	var ents []Entitlement
+	if err := GetYamlFile(fileName, &ents); err != nil {
+		ctx.Log.Err("could not read file of entitlements: %v\n", err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	return UpdateEntitlements(ctx, ents, remove)
 }
 
 // Get entitlement for the given user whose username is 'name'
 // rtypeName has been validated before and is one of 'user', 'group' or 'app'
-func GetEntitlement(ctx *HttpContext, rtypeName, name string) {
+func GetEntitlement(ctx *HttpContext, rtypeName, name string) (err error) {
 	var resType, id string
 	body := make(map[string]interface{})
 	switch rtypeName {
 	case "user":
-		resType, id = "users", scimNameToID(ctx, "Users", "userName", name)
+		resType = "users"
+		id, err = scimNameToID(ctx, "Users", "userName", name)
 	case "group":
-		resType, id = "groups", scimNameToID(ctx, "Groups", "displayName", name)
+		resType = "groups"
+		id, err = scimNameToID(ctx, "Groups", "displayName", name)
 	case "app":
 		resType, id = "catalogitems", name
 	}
-	if id == "" {
+	if err != nil {
 		return
 	}
 	path := fmt.Sprintf("entitlements/definitions/%s/%s", resType, id)
-	if err := ctx.Request("GET", path, nil, &body); err != nil {
+	if err = ctx.Request("GET", path, nil, &body); err != nil {
 		ctx.Log.Err("Error: %v\n", err)
 	} else {
 		ctx.Log.PP("Entitlements", body["items"],
 			"catalogItemId", "subjectType", "subjectId", "activationPolicy")
 	}
+	return
 }
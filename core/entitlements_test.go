@@ -17,7 +17,11 @@ package core
 
 import (
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"gopkg.in/yaml.v2"
 	"strings"
 	"testing"
 )
@@ -65,19 +69,16 @@ func TestGetEntitlementForUnknownUserEntitlement(t *testing.T) {
 }
 
 func TestCreateEntitlementForUser(t *testing.T) {
-	entReply := func(t *testing.T, req *TstReq) *TstReply {
-		return &TstReply{Output: `{"test": "unused"}`, ContentType: "application/json"}
-	}
 	idH := func(t *testing.T, req *TstReq) *TstReply {
 		output := `{"resources": [{ "userName" : "patrick", "id": "12345"}]}`
 		return &TstReply{Output: output, ContentType: "application/json"}
 	}
 	paths := map[string]TstHandler{
 		"GET/scim/Users?count=10000&filter=userName+eq+%22patrick%22": idH,
-		"POST/entitlements/definitions":                               entReply}
+		"POST/entitlements/definitions":                               bulkCreatedH}
 	srv, ctx := NewTestContext(t, paths)
 	defer srv.Close()
-	maybeEntitle(ctx, "baby", "patrick", "user", "userName", "dance")
+	reconcileEntitlements(ctx, "dance", "baby", []Entitlement{{User: "patrick", App: "dance"}}, true, false)
 	AssertOnlyInfoContains(t, ctx, `Entitled user "patrick" to app "dance"`)
 }
 
@@ -91,8 +92,8 @@ func TestCreateEntitlementFailedForUnknownUser(t *testing.T) {
 		"GET/scim/Users?count=10000&filter=userName+eq+%22patrick%22": errorReply}
 	srv, ctx := NewTestContext(t, paths)
 	defer srv.Close()
-	maybeEntitle(ctx, "baby", "patrick", "user", "userName", "dance")
-	AssertErrorContains(t, ctx, `Could not entitle user "patrick" to app "dance", error: 404 Not Found`)
+	reconcileEntitlements(ctx, "dance", "baby", []Entitlement{{User: "patrick", App: "dance"}}, true, false)
+	AssertErrorContains(t, ctx, `Could not entitle user "patrick" to app "dance": 404 Not Found`)
 }
 
 // common method to test getting basic entitlements
@@ -114,3 +115,87 @@ func checkGetEntitlementReturns(t *testing.T, entity, rType, rID string) {
 	GetEntitlement(ctx, entity, "foo")
 	AssertOnlyInfoContains(t, ctx, "activationPolicy: bar")
 }
+
+func TestUpdateEntitlementsSendsOneBulkRequestAndReportsEachResult(t *testing.T) {
+	bulkH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.ContentType, "entitlements.definition.bulk")
+		assert.JSONEq(t, `{"returnPayloadOnError": true, "operations": [
+			{"method": "POST", "data": {"catalogItemId": "app-1", "subjectType": "USERS", "subjectId": "user-1", "activationPolicy": "AUTOMATIC"}},
+			{"method": "POST", "data": {"catalogItemId": "app-1", "subjectType": "GROUPS", "subjectId": "group-1", "activationPolicy": "USER_ACTIVATED"}}]}`, req.Input)
+		return &TstReply{ContentType: "application/json", Output: `{"operations": [
+			{"method": "POST", "status": "201"}, {"method": "POST", "status": 409, "reason": "already entitled"}]}`}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe%22":         GoodPathHandler(`{"Resources": [{"userName": "joe", "id": "user-1"}]}`),
+		"GET/scim/Groups?count=10000&filter=displayName+eq+%22dancers%22": GoodPathHandler(`{"Resources": [{"displayName": "dancers", "id": "group-1"}]}`),
+		"POST/catalogitems/search?pageSize=10000":                         GoodPathHandler(`{"items": [{"name": "crm", "uuid": "app-1"}]}`),
+		"POST/entitlements/definitions":                                   bulkH})
+	defer srv.Close()
+	err := UpdateEntitlements(ctx, []Entitlement{{User: "joe", App: "crm"}, {Group: "dancers", App: "CRM", Activation: "user"}}, false)
+	assert.Equal(t, ErrConflict, KindOf(err))
+	assert.Equal(t, "Entitled user \"joe\" to app \"crm\"\n1 of 2 entitlements added\n", ctx.Log.InfoString())
+	AssertErrorContains(t, ctx, `Could not entitle group "dancers" to app "CRM": 409 Conflict`)
+	AssertErrorContains(t, ctx, "already entitled")
+}
+
+func TestDeleteEntitlementOfUnknownAppIsNotSent(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe%22": GoodPathHandler(`{"Resources": [{"userName": "joe", "id": "user-1"}]}`),
+		"POST/catalogitems/search?pageSize=10000":                 GoodPathHandler(`{"items": []}`)})
+	defer srv.Close()
+	err := UpdateEntitlements(ctx, []Entitlement{{User: "joe", App: "crm"}}, true)
+	assert.Equal(t, ErrNotFound, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `Could not remove entitlement of user "joe" to app "crm": No app found with name "crm"`)
+}
+
+func TestLoadEntitlementsReportsAllInvalidEntitlements(t *testing.T) {
+	file := WriteTempFile(t, "---\n- {user: joe}\n- {user: joe, group: dancers, app: crm}\n- {group: dancers, app: crm, activation: never}\n")
+	defer CleanupTempFile(file)
+	ctx := NewHttpContext(NewBufferedLogr(), "http://localhost", "/", "")
+	err := LoadEntitlements(ctx, file.Name(), false)
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, "Invalid entitlement 1: an app must be given\n"+
+		"Invalid entitlement 2: either a user or a group must be given\n"+
+		"Invalid entitlement 3: activation must be automatic or user, not \"never\"\n")
+}
+
+func TestReconcileEntitlementsAddsMissingAndRevokesOthers(t *testing.T) {
+	bulkH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.JSONEq(t, `{"returnPayloadOnError": true, "operations": [
+			{"method": "POST", "data": {"catalogItemId": "a1", "subjectType": "USERS", "subjectId": "u1", "activationPolicy": "USER_ACTIVATED"}},
+			{"method": "DELETE", "data": {"catalogItemId": "a1", "subjectType": "GROUPS", "subjectId": "g2"}}]}`, req.Input)
+		return &TstReply{Output: `{"operations": [{"status": "201"}, {"status": "200"}]}`, ContentType: "application/json"}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/entitlements/definitions/catalogitems/a1": GoodPathHandler(`{"items": [
+			{"subjectType": "GROUPS", "subjectId": "g1", "activationPolicy": "AUTOMATIC"},
+			{"subjectType": "GROUPS", "subjectId": "g2", "activationPolicy": "AUTOMATIC"}]}`),
+		"GET/scim/Groups?count=10000&filter=displayName+eq+%22dancers%22": GoodPathHandler(`{"Resources": [{"displayName": "dancers", "id": "g1"}]}`),
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe%22":         GoodPathHandler(`{"Resources": [{"userName": "joe", "id": "u1"}]}`),
+		"GET/scim/Groups/g2":            GoodPathHandler(`{"displayName": "singers", "id": "g2"}`),
+		"POST/entitlements/definitions": bulkH})
+	defer srv.Close()
+	ents := []Entitlement{{Group: "dancers", App: "crm"}, {User: "joe", App: "crm", Activation: "user"}}
+	assert.Nil(t, reconcileEntitlements(ctx, "crm", "a1", ents, false, true))
+	assert.Equal(t, "Entitled user \"joe\" to app \"crm\"\nRemoved entitlement of group \"singers\" to app \"crm\"\n",
+		ctx.Log.InfoString())
+}
+
+func TestReconcileEntitlementsDoesNotRevokeIfSubjectsAreNotFound(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/entitlements/definitions/catalogitems/a1": GoodPathHandler(`{"items": [
+			{"subjectType": "GROUPS", "subjectId": "g2", "activationPolicy": "AUTOMATIC"}]}`),
+		"GET/scim/Groups?count=10000&filter=displayName+eq+%22dancers%22": GoodPathHandler(`{"Resources": []}`)})
+	defer srv.Close()
+	err := reconcileEntitlements(ctx, "crm", "a1", []Entitlement{{Group: "dancers", App: "crm"}}, false, true)
+	assert.Equal(t, ErrNotFound, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `Not removing entitlements of app "crm" since some users or groups were not found`)
+}
+
+func TestManifestEntitlementsAcceptNamesAndActivationPolicies(t *testing.T) {
+	var w priamApp
+	require.Nil(t, yaml.Unmarshal([]byte("name: crm\nentitleGroup: ALL USERS\n"+
+		"entitleGroups: [dancers, {name: singers, activation: user}]\nentitleUsers: [{name: joe}]\n"), &w))
+	assert.Equal(t, []Entitlement{{Group: "ALL USERS", App: "crm"}, {Group: "dancers", App: "crm"},
+		{Group: "singers", App: "crm", Activation: "user"}, {User: "joe", App: "crm"}}, w.entitlements())
+}
@@ -0,0 +1,287 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	. "github.com/vmware/priam/util"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kinds of entities that can be exported
+const (
+	ExportUsers  = "users"
+	ExportGroups = "groups"
+	ExportRoles  = "roles"
+	ExportAll    = "all"
+)
+
+// ExportKinds are the kinds of entities that can be exported, all is users, groups and roles
+var ExportKinds = []string{ExportUsers, ExportGroups, ExportRoles, ExportAll}
+
+// ExportFormats are the formats entities can be exported in, csv is only supported for users
+var ExportFormats = []string{YamlFormat, CsvFormat, JsonFormat}
+
+// returns the value of the first email of a SCIM user
+func primaryEmail(user map[string]interface{}) string {
+	if emails, ok := user["emails"].([]interface{}); ok && len(emails) > 0 {
+		if m, ok := emails[0].(map[string]interface{}); ok {
+			return InterfaceToString(m["value"])
+		}
+	}
+	return ""
+}
+
+// returns the attributes of the extension schemas of a SCIM user that have string values,
+// other than the workspace extension which is managed by the server
+func userExtensions(user map[string]interface{}) map[string]map[string]string {
+	var extensions map[string]map[string]string
+	for urn, value := range user {
+		attrs, ok := value.(map[string]interface{})
+		if !ok || !strings.HasPrefix(urn, "urn:") || urn == wksExtSchemaURN {
+			continue
+		}
+		for attr, v := range attrs {
+			if s, ok := v.(string); ok {
+				if extensions == nil {
+					extensions = make(map[string]map[string]string)
+				}
+				if extensions[urn] == nil {
+					extensions[urn] = make(map[string]string)
+				}
+				extensions[urn][attr] = s
+			}
+		}
+	}
+	return extensions
+}
+
+// returns the names in the index in order
+func sortedNames(index scimIndex, nameAttr string) []string {
+	var names []string
+	for _, item := range index {
+		names = append(names, InterfaceToString(item[nameAttr]))
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names
+}
+
+// returns the names of the members of each group or role by its id, in order
+func memberNames(users scimIndex, attr string) map[string][]string {
+	names := make(map[string]string)
+	for _, user := range users {
+		names[InterfaceToString(user["id"])] = InterfaceToString(user["userName"])
+	}
+	members := make(map[string][]string)
+	for id, uids := range membershipsByID(users, attr) {
+		for uid := range uids {
+			members[id] = append(members[id], names[uid])
+		}
+		sort.Strings(members[id])
+	}
+	return members
+}
+
+// returns the users of the index as they are read by user load. Passwords cannot be exported.
+func exportedUsers(users scimIndex) []BasicUser {
+	exported := []BasicUser{}
+	for _, name := range sortedNames(users, "userName") {
+		item := users[strings.ToLower(name)]
+		fullName, _ := item["name"].(map[string]interface{})
+		u := BasicUser{Name: name, Given: InterfaceToString(fullName["givenName"]),
+			Family: InterfaceToString(fullName["familyName"]), Email: primaryEmail(item),
+			ExternalId: InterfaceToString(item["externalId"]), Extensions: userExtensions(item)}
+		if active, ok := item["active"].(bool); ok {
+			u.Active = &active
+		}
+		phones, _ := item["phoneNumbers"].([]interface{})
+		for _, p := range phones {
+			if m, ok := p.(map[string]interface{}); ok && InterfaceToString(m["value"]) != "" {
+				u.Phones = append(u.Phones, InterfaceToString(m["value"]))
+			}
+		}
+		exported = append(exported, u)
+	}
+	return exported
+}
+
+// returns the groups of the index with their members as they are read by group load. Built-in
+// groups and groups synced from a directory are left out since they cannot be loaded.
+func exportedGroups(groups, users scimIndex) []BasicGroup {
+	exported, members := []BasicGroup{}, memberNames(users, "groups")
+	for _, name := range sortedNames(groups, "displayName") {
+		item := groups[strings.ToLower(name)]
+		if managedGroup(item) {
+			continue
+		}
+		exported = append(exported, BasicGroup{Name: name, Description: InterfaceToString(item["description"]),
+			Members: members[InterfaceToString(item["id"])]})
+	}
+	return exported
+}
+
+// returns the strings in a list of values from a SCIM resource
+func stringValues(i interface{}) (values []string) {
+	list, _ := i.([]interface{})
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return
+}
+
+// returns the roles of the index with their members as they are read by role load
+func exportedRoles(roles, users scimIndex) []BasicRole {
+	exported, members := []BasicRole{}, memberNames(users, "roles")
+	for _, name := range sortedNames(roles, "displayName") {
+		item := roles[strings.ToLower(name)]
+		ext, _ := item[wksExtSchemaURN].(map[string]interface{})
+		exported = append(exported, BasicRole{Name: name, Description: InterfaceToString(item["description"]),
+			Scopes: stringValues(ext["scopes"]), Permissions: stringValues(ext["permissions"]),
+			Members: members[InterfaceToString(item["id"])]})
+	}
+	return exported
+}
+
+// returns users as CSV with the fields read by user load. Extension attributes are not included.
+func usersCsv(users []BasicUser) ([]byte, error) {
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Write([]string{"name", "given", "family", "email", "active", "externalId", "phones"})
+	for _, u := range users {
+		active := ""
+		if u.Active != nil {
+			active = strconv.FormatBool(*u.Active)
+		}
+		w.Write([]string{u.Name, u.Given, u.Family, u.Email, active, u.ExternalId, strings.Join(u.Phones, ";")})
+	}
+	w.Flush()
+	return out.Bytes(), w.Error()
+}
+
+// returns the entities in the given format. JSON has the same field names as YAML so
+// that it can be read by the load commands.
+func exportContent(entities interface{}, format string) ([]byte, error) {
+	if users, ok := entities.([]BasicUser); ok && format == CsvFormat {
+		return usersCsv(users)
+	}
+	content, err := yaml.Marshal(entities)
+	if err != nil || format == YamlFormat {
+		return append([]byte("---\n"), content...), err
+	}
+	var generic interface{}
+	if err = yaml.Unmarshal(content, &generic); err != nil {
+		return nil, err
+	}
+	if content, err = json.MarshalIndent(ChangeKeysToString(generic), "", "  "); err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// writes the entities to the file, or to the output of the log if no file name is given
+func writeExport(ctx *HttpContext, kind string, entities interface{}, count int, format, fileName string) error {
+	content, err := exportContent(entities, format)
+	if err == nil && fileName != "" {
+		err = ioutil.WriteFile(fileName, content, 0644)
+	}
+	if err != nil {
+		ctx.Log.Err("Error exporting %s: %v\n", kind, err)
+		return NewError(ErrGeneral, "could not export %s: %v", kind, err)
+	}
+	if fileName == "" {
+		ctx.Log.Info("%s", content)
+	} else {
+		ctx.Log.Info("%d %s exported to %s\n", count, kind, fileName)
+	}
+	return nil
+}
+
+/* ExportEntities writes the users, groups or roles of the tenant in files that can be read
+   by the load commands. Members of groups and roles are exported with the groups and roles so
+   that users are loaded first, and the groups of exported users are not given, so exporting
+   only users loses their memberships. Output is the file to write, or the output of the log if empty.
+   When all kinds are exported, output is the directory to write a file for each kind to, the
+   current directory if empty. Groups and roles can only be loaded from YAML, so they are
+   exported as YAML when CSV is requested for all kinds. Built-in groups such as ALL USERS and
+   groups synced from a directory are not exported.
+*/
+func ExportEntities(ctx *HttpContext, kind, format, output string) error {
+	kind, format = strings.ToLower(kind), strings.ToLower(StringOrDefault(format, YamlFormat))
+	if !HasString(kind, ExportKinds) {
+		ctx.Log.Err("Unknown kind \"%s\", must be one of %s\n", kind, strings.Join(ExportKinds, ", "))
+		return NewError(ErrUsage, "unknown kind \"%s\"", kind)
+	}
+	if !HasString(format, ExportFormats) || format == CsvFormat && (kind == ExportGroups || kind == ExportRoles) {
+		ctx.Log.Err("Cannot export %s as \"%s\", must be one of %s, csv is only supported for users\n",
+			kind, format, strings.Join(ExportFormats, ", "))
+		return NewError(ErrUsage, "unsupported format \"%s\"", format)
+	}
+	users, err := scimIndexByName(ctx, "Users", "userName")
+	if err != nil {
+		ctx.Log.Err("Error getting users: %v\n", err)
+		return err
+	}
+	fileName := func(k, f string) string {
+		if kind != ExportAll {
+			return output
+		}
+		return filepath.Join(output, k+"."+f)
+	}
+	if kind == ExportAll {
+		if err = os.MkdirAll(StringOrDefault(output, "."), 0755); err != nil {
+			ctx.Log.Err("Error creating directory for export: %v\n", err)
+			return NewError(ErrGeneral, "could not create directory: %v", err)
+		}
+	}
+	if kind == ExportUsers || kind == ExportAll {
+		if err = writeExport(ctx, ExportUsers, exportedUsers(users), len(users), format, fileName(ExportUsers, format)); err != nil {
+			return err
+		}
+	}
+	if format == CsvFormat {
+		format = YamlFormat
+	}
+	for _, k := range []struct{ kind, resType string }{{ExportGroups, "Groups"}, {ExportRoles, "Roles"}} {
+		if kind != k.kind && kind != ExportAll {
+			continue
+		}
+		index, err := scimIndexByName(ctx, k.resType, "displayName")
+		if err != nil {
+			ctx.Log.Err("Error getting %s: %v\n", k.kind, err)
+			return err
+		}
+		var entities interface{} = exportedRoles(index, users)
+		count := len(index)
+		if k.kind == ExportGroups {
+			groups := exportedGroups(index, users)
+			entities, count = groups, len(groups)
+		}
+		if err = writeExport(ctx, k.kind, entities, count, format, fileName(k.kind, format)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
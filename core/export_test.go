@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const exportUsersJSON = `{"totalResults": 2, "Resources": [
+	{"userName": "sue", "id": "2", "name": {"givenName": "Susan", "familyName": "Jones"},
+	 "emails": [{"value": "sue@what.com"}], "groups": [{"value": "g1"}], "roles": [{"value": "r1"}],
+	 "` + enterpriseURN + `": {"department": "sales", "manager": {"value": "3"}},
+	 "urn:scim:schemas:extension:workspace:1.0": {"userStatus": "1"}},
+	{"userName": "joe", "id": "1", "groups": [{"value": "g1"}]}]}`
+
+func exportPaths() map[string]TstHandler {
+	return map[string]TstHandler{
+		"GET/scim/Users?count=10000": GoodPathHandler(exportUsersJSON),
+		"GET/scim/Groups?count=10000": GoodPathHandler(`{"totalResults": 1, "Resources": [
+			{"displayName": "dancers", "id": "g1", "description": "all the dancers"}]}`),
+		"GET/scim/Roles?count=10000": GoodPathHandler(`{"totalResults": 1, "Resources": [
+			{"displayName": "Administrator", "id": "r1",
+			 "urn:scim:schemas:extension:workspace:1.0": {"scopes": ["admin"], "permissions": ["all"]}}]}`)}
+}
+
+func TestExportAllWritesFilesThatCanBeLoaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "priam-export")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	srv, ctx := NewTestContext(t, exportPaths())
+	defer srv.Close()
+
+	require.Nil(t, ExportEntities(ctx, "all", "", dir))
+	AssertOnlyInfoContains(t, ctx, "2 users exported to "+filepath.Join(dir, "users.yaml"))
+	assert.Contains(t, ctx.Log.InfoString(), "1 roles exported to "+filepath.Join(dir, "roles.yaml"))
+
+	users, err := ReadUsersFile(filepath.Join(dir, "users.yaml"), "", "")
+	require.Nil(t, err)
+	assert.Equal(t, []BasicUser{{Name: "joe"}, {Name: "sue", Given: "Susan", Family: "Jones", Email: "sue@what.com",
+		Extensions: map[string]map[string]string{enterpriseURN: {"department": "sales"}}}}, users)
+	var groups []BasicGroup
+	require.Nil(t, GetYamlFile(filepath.Join(dir, "groups.yaml"), &groups))
+	assert.Equal(t, []BasicGroup{{Name: "dancers", Description: "all the dancers", Members: []string{"joe", "sue"}}}, groups)
+	var roles []BasicRole
+	require.Nil(t, GetYamlFile(filepath.Join(dir, "roles.yaml"), &roles))
+	assert.Equal(t, []BasicRole{{Name: "Administrator", Scopes: []string{"admin"}, Permissions: []string{"all"},
+		Members: []string{"sue"}}}, roles)
+}
+
+func TestExportAllAsCsvWritesGroupsAsYaml(t *testing.T) {
+	dir, err := ioutil.TempDir("", "priam-export")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	srv, ctx := NewTestContext(t, exportPaths())
+	defer srv.Close()
+
+	require.Nil(t, ExportEntities(ctx, "all", "csv", dir))
+	users, err := ReadUsersFile(filepath.Join(dir, "users.csv"), "", "")
+	require.Nil(t, err)
+	assert.Equal(t, []BasicUser{{Name: "joe"}, {Name: "sue", Given: "Susan", Family: "Jones", Email: "sue@what.com"}}, users)
+	assert.FileExists(t, filepath.Join(dir, "groups.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "roles.yaml"))
+}
+
+func TestExportGroupsAsJsonCanBeLoaded(t *testing.T) {
+	srv, ctx := NewTestContext(t, exportPaths())
+	defer srv.Close()
+	require.Nil(t, ExportEntities(ctx, "Groups", "json", ""))
+	assert.Contains(t, ctx.Log.InfoString(), `"name": "dancers"`)
+
+	f := WriteTempFile(t, ctx.Log.InfoString())
+	defer CleanupTempFile(f)
+	var groups []BasicGroup
+	require.Nil(t, GetYamlFile(f.Name(), &groups))
+	assert.Equal(t, []BasicGroup{{Name: "dancers", Description: "all the dancers", Members: []string{"joe", "sue"}}}, groups)
+}
+
+func TestExportedGroupsCanBeLoadedBackIntoTheTenant(t *testing.T) {
+	paths := exportPaths()
+	paths["GET/scim/Groups?count=10000"] = GoodPathHandler(`{"totalResults": 3, "Resources": [
+		{"displayName": "dancers", "id": "g1", "description": "all the dancers"},
+		{"displayName": "ALL USERS", "id": "g2"},
+		{"displayName": "engineers", "id": "g3", "` + wksExtSchemaURN + `": {"internalGroupType": "EXTERNAL"}}]}`)
+	paths["GET/scim/Users?count=10000&filter=userName+eq+%22joe%22"] = GoodPathHandler(
+		`{"Resources": [{"userName": "joe", "id": "1"}]}`)
+	paths["GET/scim/Users?count=10000&filter=userName+eq+%22sue%22"] = GoodPathHandler(
+		`{"Resources": [{"userName": "sue", "id": "2"}]}`)
+	paths["POST/scim/Groups/g1"] = func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Members":[{"Value":"1","Type":"User"},{"Value":"2","Type":"User"}]`)
+		return &TstReply{Output: `{}`, ContentType: "application/json"}
+	}
+	srv, ctx := NewTestContext(t, paths)
+	defer srv.Close()
+	f := WriteTempFile(t, "")
+	defer CleanupTempFile(f)
+
+	require.Nil(t, ExportEntities(ctx, "groups", "", f.Name()))
+	AssertOnlyInfoContains(t, ctx, "1 groups exported to "+f.Name())
+	ctx.Log.ClearBuffers()
+	require.Nil(t, new(SCIMGroupsService).LoadEntities(ctx, f.Name(), LoadOptions{}))
+	AssertOnlyInfoContains(t, ctx, `Group "dancers" updated`)
+}
+
+func TestExportWithUnknownFormatFails(t *testing.T) {
+	srv, ctx := NewTestContext(t, exportPaths())
+	defer srv.Close()
+	err := ExportEntities(ctx, "users", "ldif", "")
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `Cannot export users as "ldif"`)
+}
+
+func TestExportFailsIfUsersCannotBeRead(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"GET/scim/Users?count=10000": ErrorHandler(403, "not allowed")})
+	defer srv.Close()
+	err := ExportEntities(ctx, "groups", "", "")
+	assert.Equal(t, ErrAuth, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, "Error getting users: 403 Forbidden")
+}
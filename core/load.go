@@ -0,0 +1,210 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	. "github.com/vmware/priam/util"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadOptions control how entities are loaded from a file
+type LoadOptions struct {
+	Parallel    int    // number of entities to add at the same time, 1 if not set
+	ResultsFile string // file to write the result of each entity to, if set
+	ResumeFile  string // results file of an earlier load, only entities that were not created are added
+	Format      string // format of the file of users, see UserFileFormats, found from the extension if empty
+	MappingFile string // file of the UserMapping of the fields of a file of users
+}
+
+// status of an entity in the results of a load
+const (
+	LoadCreated = "created"
+	LoadFailed  = "failed"
+	LoadSkipped = "skipped"
+	LoadDryRun  = "dry-run" // not created because requests were not sent in dry run mode
+)
+
+// LoadResult is the result of loading an entity, as written to the results file
+type LoadResult struct {
+	Name, Status string
+	Reason       string `yaml:",omitempty"`
+}
+
+// time between progress reports while loading, changed by tests
+var progressInterval = 5 * time.Second
+
+// returns the results of the entities created by an earlier load, by name, which do not need to be loaded again
+func loadedBefore(fileName string) (map[string]LoadResult, error) {
+	var results []LoadResult
+	if err := GetYamlFile(fileName, &results); err != nil {
+		return nil, err
+	}
+	done := make(map[string]LoadResult)
+	for _, r := range results {
+		if r.Status == LoadCreated && r.Name != "" {
+			done[r.Name] = r
+		}
+	}
+	return done, nil
+}
+
+// returns the message of an error on one line, for the results file
+func oneLine(err error) string {
+	return strings.Join(strings.Fields(err.Error()), " ")
+}
+
+/* loadEntities adds the entities of the given names with the add function, as many at the
+   same time as set in the options. Entities without a name, with the name of an earlier
+   entity, or created before according to the resume file of the options are skipped, and
+   the results file keeps their earlier result. In dry run mode entities are not created, and
+   their status in the results file is dry-run so that they are loaded when resuming. The
+   output of each entity is printed when it has been added so that the output of entities
+   added at the same time is not mixed, and progress is reported on the error output while
+   loading. Returns the first error in the order of the entities.
+*/
+func loadEntities(ctx *HttpContext, kind string, names []string, opts LoadOptions, add func(ctx *HttpContext, i int) error) error {
+	done := make(map[string]LoadResult)
+	if opts.ResumeFile != "" {
+		var err error
+		if done, err = loadedBefore(opts.ResumeFile); err != nil {
+			ctx.Log.Err("could not read results of earlier load: %v\n", err)
+			return &Error{Kind: ErrUsage, Err: err}
+		}
+	}
+	results, errs, seen, todo := make([]LoadResult, len(names)), make([]error, len(names)), make(map[string]bool), []int{}
+	for i, name := range names {
+		results[i] = LoadResult{Name: name, Status: LoadSkipped}
+		switch {
+		case name == "":
+			results[i].Reason = "no name given"
+		case seen[name]:
+			results[i].Reason = "same name as an earlier entry"
+		case done[name].Name != "":
+			results[i] = done[name]
+		default:
+			todo = append(todo, i)
+		}
+		seen[name] = true
+	}
+
+	// mu serializes output, the results and the refresh of the access token
+	var mu sync.Mutex
+	created, failed := 0, 0
+	report := func() {
+		ctx.Log.Err("loaded %d of %d %s, %d failed\n", created+failed, len(todo), kind, failed)
+	}
+	// the token is refreshed once in the shared context, workers rejected with
+	// the same token then use the refreshed one
+	onUnauthorized := ctx.OnUnauthorized
+	if onUnauthorized != nil {
+		onUnauthorized = func(wctx *HttpContext) bool {
+			rejected := wctx.Headers("Authorization")
+			mu.Lock()
+			defer mu.Unlock()
+			if ctx.Headers("Authorization") == rejected && !ctx.OnUnauthorized(ctx) {
+				return false
+			}
+			wctx.Authorization(ctx.Headers("Authorization"))
+			return true
+		}
+	}
+	parallel, indexes, wg := opts.Parallel, make(chan int), sync.WaitGroup{}
+	if parallel < 1 {
+		parallel = 1
+	}
+	for w := 0; w < parallel; w++ {
+		wctx, log := ctx.Clone(), *ctx.Log
+		wctx.Log, wctx.OnUnauthorized = log.ClearBuffers(), onUnauthorized
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				err := add(wctx, i)
+				mu.Lock()
+				fmt.Fprint(ctx.Log.OutW, wctx.Log.InfoString())
+				fmt.Fprint(ctx.Log.ErrW, wctx.Log.ErrString())
+				wctx.Log.ClearBuffers()
+				if errs[i] = err; err != nil {
+					results[i].Status, results[i].Reason = LoadFailed, oneLine(err)
+					failed++
+				} else {
+					results[i].Status = LoadCreated
+					if ctx.DryRun {
+						results[i].Status = LoadDryRun
+					}
+					created++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	ticker, reported := time.NewTicker(progressInterval), false
+	progress := func() {
+		mu.Lock()
+		report()
+		mu.Unlock()
+		reported = true
+	}
+	for _, i := range todo {
+		for sent := false; !sent; {
+			select {
+			case indexes <- i:
+				sent = true
+			case <-ticker.C:
+				progress()
+			}
+		}
+	}
+	close(indexes)
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	for waiting := true; waiting; {
+		select {
+		case <-finished:
+			waiting = false
+		case <-ticker.C:
+			progress()
+		}
+	}
+	ticker.Stop()
+	if reported {
+		// the last report counts every entity
+		report()
+	}
+
+	var err error
+	for _, e := range errs {
+		keepFirst(&err, e)
+	}
+	summary := "%d %s created, %d failed, %d skipped\n"
+	if ctx.DryRun {
+		summary = "%d %s to be created in dry run, %d failed, %d skipped\n"
+	}
+	ctx.Log.Info(summary, created, kind, failed, len(names)-created-failed)
+	if opts.ResultsFile != "" {
+		if werr := PutYamlFile(opts.ResultsFile, results); werr != nil {
+			ctx.Log.Err("could not write results file: %v\n", werr)
+			keepFirst(&err, NewError(ErrGeneral, "could not write results file: %v", werr))
+		}
+	}
+	return err
+}
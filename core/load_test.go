@@ -0,0 +1,174 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// returns a handler that adds users slowly, fails to add users whose names start with "bad",
+// and records the names and the highest number of users added at the same time.
+func slowAddUserHandler(failBad bool) (TstHandler, *[]string, *int) {
+	var mu sync.Mutex
+	names, inFlight, maxInFlight := []string{}, 0, 0
+	return func(t *testing.T, req *TstReq) *TstReply {
+		mu.Lock()
+		names, inFlight = append(names, req.Input), inFlight+1
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if failBad && strings.Contains(req.Input, `"UserName":"bad`) {
+			return &TstReply{Status: 409, StatusMsg: "user exists"}
+		}
+		return &TstReply{Output: req.Input, ContentType: "application/json"}
+	}, &names, &maxInFlight
+}
+
+func TestLoadUsersInParallel(t *testing.T) {
+	users := ""
+	for i := 0; i < 12; i++ {
+		users += fmt.Sprintf("- {name: user%d}\n", i)
+	}
+	usersFile := WriteTempFile(t, users)
+	defer CleanupTempFile(usersFile)
+	handler, names, maxInFlight := slowAddUserHandler(false)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": handler})
+	defer srv.Close()
+
+	assert.Nil(t, new(SCIMUsersService).LoadEntities(ctx, usersFile.Name(), LoadOptions{Parallel: 4}))
+	AssertOnlyInfoContains(t, ctx, "12 users created, 0 failed, 0 skipped")
+	assert.Contains(t, ctx.Log.InfoString(), "User 'user11' successfully added\n")
+	assert.Len(t, *names, 12)
+	assert.True(t, *maxInFlight > 1 && *maxInFlight <= 4, "users added at the same time: %d", *maxInFlight)
+}
+
+func TestLoadUsersWritesResultsAndResumesFailures(t *testing.T) {
+	usersFile := WriteTempFile(t, "- {name: joe}\n- {name: bad-sue}\n- {given: nobody}\n- {name: joe, given: again}\n")
+	defer CleanupTempFile(usersFile)
+	resultsFile := WriteTempFile(t, "")
+	defer CleanupTempFile(resultsFile)
+	handler, _, _ := slowAddUserHandler(true)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": handler})
+	defer srv.Close()
+
+	err := new(SCIMUsersService).LoadEntities(ctx, usersFile.Name(), LoadOptions{Parallel: 2, ResultsFile: resultsFile.Name()})
+	assert.Equal(t, ErrConflict, KindOf(err))
+	assert.Contains(t, ctx.Log.InfoString(), "1 users created, 1 failed, 2 skipped")
+	var results []LoadResult
+	require.Nil(t, GetYamlFile(resultsFile.Name(), &results))
+	assert.Equal(t, []LoadResult{
+		{Name: "joe", Status: LoadCreated},
+		{Name: "bad-sue", Status: LoadFailed, Reason: "409 Conflict user exists"},
+		{Name: "", Status: LoadSkipped, Reason: "no name given"},
+		{Name: "joe", Status: LoadSkipped, Reason: "same name as an earlier entry"}}, results)
+
+	// only the failed user is added again when resuming
+	handler, names, _ := slowAddUserHandler(false)
+	srv2, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": handler})
+	defer srv2.Close()
+	err = new(SCIMUsersService).LoadEntities(ctx, usersFile.Name(), LoadOptions{ResultsFile: resultsFile.Name(), ResumeFile: resultsFile.Name()})
+	assert.Nil(t, err)
+	AssertOnlyInfoContains(t, ctx, "1 users created, 0 failed, 3 skipped")
+	if assert.Len(t, *names, 1) {
+		assert.Contains(t, (*names)[0], `"UserName":"bad-sue"`)
+	}
+	require.Nil(t, GetYamlFile(resultsFile.Name(), &results))
+	assert.Equal(t, []LoadResult{
+		{Name: "joe", Status: LoadCreated},
+		{Name: "bad-sue", Status: LoadCreated},
+		{Name: "", Status: LoadSkipped, Reason: "no name given"},
+		{Name: "joe", Status: LoadSkipped, Reason: "same name as an earlier entry"}}, results)
+}
+
+func TestLoadUsersInDryRunAreLoadedWhenResuming(t *testing.T) {
+	usersFile := WriteTempFile(t, "- {name: joe}\n- {name: sue}\n")
+	defer CleanupTempFile(usersFile)
+	resultsFile := WriteTempFile(t, "")
+	defer CleanupTempFile(resultsFile)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{})
+	defer srv.Close()
+	ctx.DryRun = true
+	assert.Nil(t, new(SCIMUsersService).LoadEntities(ctx, usersFile.Name(), LoadOptions{ResultsFile: resultsFile.Name()}))
+	assert.Contains(t, ctx.Log.InfoString(), "2 users to be created in dry run, 0 failed, 0 skipped")
+	var results []LoadResult
+	require.Nil(t, GetYamlFile(resultsFile.Name(), &results))
+	assert.Equal(t, []LoadResult{{Name: "joe", Status: LoadDryRun}, {Name: "sue", Status: LoadDryRun}}, results)
+
+	handler, names, _ := slowAddUserHandler(false)
+	srv2, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": handler})
+	defer srv2.Close()
+	assert.Nil(t, new(SCIMUsersService).LoadEntities(ctx, usersFile.Name(), LoadOptions{ResumeFile: resultsFile.Name()}))
+	AssertOnlyInfoContains(t, ctx, "2 users created, 0 failed, 0 skipped")
+	assert.Len(t, *names, 2)
+}
+
+func TestLoadUsersFailsIfResumeFileDoesNotExist(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{})
+	defer srv.Close()
+	err := new(SCIMUsersService).LoadEntities(ctx, YAML_USERS_FILE, LoadOptions{ResumeFile: "no-such-results.yaml"})
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, "could not read results of earlier load")
+}
+
+func TestLoadUsersReportsProgress(t *testing.T) {
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = time.Millisecond
+	handler, _, _ := slowAddUserHandler(false)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": handler})
+	defer srv.Close()
+	assert.Nil(t, new(SCIMUsersService).LoadEntities(ctx, YAML_USERS_FILE, LoadOptions{}))
+	assert.True(t, strings.HasSuffix(ctx.Log.ErrString(), "loaded 2 of 2 users, 0 failed\n"), ctx.Log.ErrString())
+}
+
+func TestLoadUsersInParallelRefreshesExpiredTokenOnce(t *testing.T) {
+	users := ""
+	for i := 0; i < 6; i++ {
+		users += fmt.Sprintf("- {name: user%d}\n", i)
+	}
+	usersFile := WriteTempFile(t, users)
+	defer CleanupTempFile(usersFile)
+	handler := func(t *testing.T, req *TstReq) *TstReply {
+		if req.Authorization != "Bearer fresh" {
+			time.Sleep(10 * time.Millisecond)
+			return &TstReply{Status: 401, StatusMsg: "token expired"}
+		}
+		return &TstReply{Output: req.Input, ContentType: "application/json"}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": handler})
+	defer srv.Close()
+	refreshes := 0
+	ctx.Authorization("Bearer stale").OnUnauthorized = func(ctx *HttpContext) bool {
+		refreshes++
+		ctx.Authorization("Bearer fresh")
+		return true
+	}
+	assert.Nil(t, new(SCIMUsersService).LoadEntities(ctx, usersFile.Name(), LoadOptions{Parallel: 3}))
+	assert.Equal(t, 1, refreshes)
+	assert.Contains(t, ctx.Log.InfoString(), "6 users created, 0 failed, 0 skipped")
+}
@@ -0,0 +1,331 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	. "github.com/vmware/priam/util"
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// checks of the authInfo of the applications of a catalog item type
+type appTypeSchema struct {
+	required []string          // fields that must be given
+	kinds    map[string]string // kinds of the values of fields: int, url, or the allowed values separated by |
+}
+
+var samlSchema = appTypeSchema{kinds: map[string]string{"validityTimeSeconds": "int", "configureAs": "manual|url",
+	"assertionConsumerServiceUrl": "url", "metadataUrl": "url"}}
+
+/* appTypeSchemas are the catalog item types of applications whose authInfo is checked, by the
+   catalogItemType given by the server. Apps of other types, such as NativeApp or VirtualApp,
+   only get the checks that apply to every app.
+*/
+var appTypeSchemas = map[string]appTypeSchema{
+	"Saml20":  samlSchema,
+	"Saml11":  samlSchema,
+	"WSFed12": {},
+	"WebAppLink": {required: []string{"targetUrl"},
+		kinds: map[string]string{"targetUrl": "url"}},
+	"OpenIDConnect": {required: []string{"clientId", "redirectUrl", "targetUrl"},
+		kinds: map[string]string{"redirectUrl": "url", "targetUrl": "url"}},
+}
+
+// other names of catalog item types, which the server does not accept
+var appTypeAliases = map[string]string{"OIDC": "OpenIDConnect"}
+
+// returns the name of the catalog item type as given in the schemas, or "" if it is unknown
+func appTypeName(itemType string) string {
+	for name := range appTypeSchemas {
+		if strings.EqualFold(name, itemType) {
+			return name
+		}
+	}
+	return ""
+}
+
+// returns an error if the value of an authInfo field is not of the kind of the schema
+func checkAuthField(name, kind, s string) error {
+	switch kind {
+	case "int":
+		if _, err := strconv.Atoi(s); err != nil {
+			return fmt.Errorf("authInfo.%s must be a number, not \"%s\"", name, s)
+		}
+	case "url":
+		if u, err := url.Parse(s); err != nil || !u.IsAbs() || u.Host == "" {
+			return fmt.Errorf("authInfo.%s must be an absolute URL, not \"%s\"", name, s)
+		}
+	default:
+		if !HasString(s, strings.Split(kind, "|")) {
+			return fmt.Errorf("authInfo.%s must be one of %s, not \"%s\"", name, strings.Replace(kind, "|", ", ", -1), s)
+		}
+	}
+	return nil
+}
+
+// a problem found in a manifest, with the path of the value in error to find its line. Warnings
+// do not keep the app from being published.
+type manifestProblem struct {
+	path, app, msg string
+	warning        bool
+}
+
+// returns the problems of an application of a manifest. The path is the path of the app in the manifest.
+func validateApp(path string, w *priamApp) (problems []manifestProblem) {
+	ws := path + ".workspace"
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, manifestProblem{path, w.Name, fmt.Sprintf(format, args...), false})
+	}
+	if w.Name == "" {
+		add(path, "a name must be given")
+	}
+	if w.AccessPolicy != "" && w.AccessPolicySetUuid != "" {
+		add(ws+".accessPolicySetUuid", "both accessPolicy \"%s\" and AccessPolicySetUuid \"%s\" cannot be specified",
+			w.AccessPolicy, w.AccessPolicySetUuid)
+	}
+	if w.IconFile != "" {
+		if _, err := os.Stat(w.IconFile); err != nil {
+			add(ws+".iconFile", "cannot read icon file: %v", err)
+		}
+	}
+	for _, list := range []struct {
+		key      string
+		subjects []appSubject
+		user     bool
+	}{{"entitleGroups", w.EntitleGroups, false}, {"entitleUsers", w.EntitleUsers, true}} {
+		for j, s := range list.subjects {
+			ent := Entitlement{App: w.Name, Activation: s.Activation}
+			if list.user {
+				ent.User = s.Name
+			} else {
+				ent.Group = s.Name
+			}
+			if s.Name == "" {
+				add(fmt.Sprintf("%s.%s[%d]", ws, list.key, j), "a name must be given for each of %s", list.key)
+			} else if err := ent.validate(); err != nil {
+				add(fmt.Sprintf("%s.%s[%d]", ws, list.key, j), "%s: %v", ent.subject(), err)
+			}
+		}
+	}
+	authValue := func(name string) string {
+		if value := w.AuthInfo[name]; value != nil {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+	if w.CatalogItemType == "" {
+		add(ws, "a catalogItemType must be given")
+		return
+	}
+	if authType := authValue("type"); authType != "" && !strings.EqualFold(authType, w.CatalogItemType) {
+		add(ws+".authInfo.type", "authInfo type \"%s\" is not the catalogItemType \"%s\"", authType, w.CatalogItemType)
+	}
+	for alias, name := range appTypeAliases {
+		if strings.EqualFold(alias, w.CatalogItemType) {
+			add(ws+".catalogItemType", "catalogItemType \"%s\" must be given as %s", w.CatalogItemType, name)
+			return
+		}
+	}
+	itemType := appTypeName(w.CatalogItemType)
+	if itemType == "" {
+		problems = append(problems, manifestProblem{ws + ".catalogItemType", w.Name,
+			fmt.Sprintf("authInfo of catalogItemType \"%s\" is not checked", w.CatalogItemType), true})
+		return
+	}
+	schema := appTypeSchemas[itemType]
+	for _, name := range schema.required {
+		if authValue(name) == "" {
+			add(ws+".authInfo", "authInfo.%s must be given for %s apps", name, itemType)
+		}
+	}
+	fields := make([]string, 0, len(schema.kinds))
+	for name := range schema.kinds {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	for _, name := range fields {
+		if value := authValue(name); value != "" {
+			if err := checkAuthField(name, schema.kinds[name], value); err != nil {
+				add(ws+".authInfo."+name, "%v", err)
+			}
+		}
+	}
+	return
+}
+
+// the position of a value in a YAML document
+type yamlPos struct {
+	line, col int
+}
+
+/* yamlPositions returns the positions of the values of the first document of a YAML file by
+   their path, such as applications[0].workspace.name. The position of a value of a mapping
+   is the position of its key. Values of aliases are not found, nor is anything if the file
+   cannot be parsed.
+*/
+func yamlPositions(content []byte) map[string]yamlPos {
+	positions := make(map[string]yamlPos)
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(content, &doc); err != nil {
+		return positions
+	}
+	var walk func(path string, n *yaml3.Node)
+	walk = func(path string, n *yaml3.Node) {
+		switch n.Kind {
+		case yaml3.DocumentNode:
+			for _, c := range n.Content {
+				walk(path, c)
+			}
+		case yaml3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i]
+				p := key.Value
+				if path != "" {
+					p = path + "." + p
+				}
+				positions[p] = yamlPos{key.Line, key.Column}
+				walk(p, n.Content[i+1])
+			}
+		case yaml3.SequenceNode:
+			for i, c := range n.Content {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				positions[p] = yamlPos{c.Line, c.Column}
+				walk(p, c)
+			}
+		}
+	}
+	walk("", &doc)
+	return positions
+}
+
+// returns the position of the value at the path, or of the closest value that contains it, a zero position if none is found
+func positionOf(positions map[string]yamlPos, path string) yamlPos {
+	for path != "" {
+		if pos, ok := positions[path]; ok {
+			return pos
+		}
+		path = path[:strings.LastIndexAny(path, ".[")+1]
+		path = strings.TrimRight(path, ".[")
+	}
+	return yamlPos{}
+}
+
+// matches the line number in the errors of the yaml parser
+var yamlErrLineRE = regexp.MustCompile(`^(yaml: )?line (\d+): `)
+
+// returns the errors of the yaml parser as "file:line: message"
+func yamlErrors(fileName string, err error) (msgs []string) {
+	errs := []string{err.Error()}
+	if te, ok := err.(*yaml.TypeError); ok {
+		errs = te.Errors
+	}
+	for _, e := range errs {
+		if m := yamlErrLineRE.FindStringSubmatch(e); m != nil {
+			msgs = append(msgs, fmt.Sprintf("%s:%s: %s", fileName, m[2], e[len(m[0]):]))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", fileName, e))
+		}
+	}
+	return
+}
+
+// returns true if the named file exists
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+/* readManifest reads the applications of a manifest file and checks them against the schema
+   of their catalog item type. The keys of the maps of the applications are converted to
+   strings so that they can be sent as JSON, and icon files are found relative to the
+   directory of the manifest. All problems are reported with their file and
+   line, and none of the applications are returned if there are any.
+*/
+func readManifest(ctx *HttpContext, fileName string) ([]*priamApp, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		ctx.Log.Err("Error getting manifest: %v\n", err)
+		return nil, &Error{Kind: ErrUsage, Err: err}
+	}
+	var manifest struct{ Applications []manifestApp }
+	if err = yaml.Unmarshal(content, &manifest); err != nil {
+		for _, msg := range yamlErrors(fileName, err) {
+			ctx.Log.Err("Error getting manifest: %s\n", msg)
+		}
+		return nil, &Error{Kind: ErrUsage, Err: err}
+	}
+	if len(manifest.Applications) == 0 {
+		ctx.Log.Err("Error getting manifest: %s: no applications in manifest\n", fileName)
+		return nil, NewError(ErrUsage, "no applications in manifest %s", fileName)
+	}
+	var apps []*priamApp
+	var problems []manifestProblem
+	errCount := 0
+	for i := range manifest.Applications {
+		v := &manifest.Applications[i]
+		w := &v.Workspace
+		if w.Name == "" {
+			w.Name = v.Name
+		}
+		if w.IconFile != "" && !filepath.IsAbs(w.IconFile) {
+			// older manifests may give the icon relative to the current directory
+			iconFile := filepath.Join(filepath.Dir(fileName), w.IconFile)
+			if fileExists(iconFile) || !fileExists(w.IconFile) {
+				w.IconFile = iconFile
+			}
+		}
+		if w.AuthInfo != nil {
+			w.AuthInfo = ChangeKeysToString(w.AuthInfo).(map[string]interface{})
+		}
+		if w.ResourceConfiguration != nil {
+			w.ResourceConfiguration = ChangeKeysToString(w.ResourceConfiguration).(map[string]interface{})
+		}
+		for j := range w.Labels {
+			w.Labels[j] = ChangeKeysToString(w.Labels[j]).(map[string]interface{})
+		}
+		problems = append(problems, validateApp(fmt.Sprintf("applications[%d]", i), w)...)
+		apps = append(apps, w)
+	}
+	if len(problems) == 0 {
+		return apps, nil
+	}
+	positions := yamlPositions(content)
+	for _, p := range problems {
+		location, label := fileName, "Invalid manifest"
+		if pos := positionOf(positions, p.path); pos.line > 0 {
+			location += fmt.Sprintf(":%d:%d", pos.line, pos.col)
+		}
+		if p.warning {
+			label = "Warning"
+		} else {
+			errCount++
+		}
+		ctx.Log.Err("%s: %s for %s: %s\n", location, label, StringOrDefault(p.app, "app"), p.msg)
+	}
+	if errCount == 0 {
+		return apps, nil
+	}
+	return nil, NewError(ErrUsage, "%d problems in manifest %s", errCount, fileName)
+}
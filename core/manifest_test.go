@@ -0,0 +1,217 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"path/filepath"
+	"testing"
+)
+
+const twoAppsManifest = `---
+applications:
+- name: olaf
+  workspace:
+    catalogItemType: Saml20
+    authInfo:
+      type: Saml20
+      validityTimeSeconds: 200
+      attributes:
+      - name: role
+        value: dancer
+- name: sven
+  workspace:
+    catalogItemType: WebAppLink
+    resourceConfiguration:
+      nested: {depth: 2}
+    labels:
+    - name: reindeer
+    authInfo:
+      type: WebAppLink
+      targetUrl: https://sven.example.com
+      extra: {a: b}
+`
+
+// returns a test context that fails the test on any request, and the name of a manifest file
+func manifestTester(t *testing.T, content string) (*HttpContext, string, func()) {
+	file := WriteTempFile(t, content)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{})
+	return ctx, file.Name(), func() {
+		srv.Close()
+		CleanupTempFile(file)
+	}
+}
+
+func TestReadManifestConvertsKeysOfEveryApp(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, twoAppsManifest)
+	defer cleanup()
+	apps, err := readManifest(ctx, fileName)
+	require.Nil(t, err)
+	require.Len(t, apps, 2)
+	assert.Equal(t, "olaf", apps[0].Name)
+	attrs := apps[0].AuthInfo["attributes"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"name": "role", "value": "dancer"}, attrs[0])
+	assert.Equal(t, "sven", apps[1].Name)
+	assert.Equal(t, map[string]interface{}{"a": "b"}, apps[1].AuthInfo["extra"])
+	assert.Equal(t, map[string]interface{}{"depth": 2}, apps[1].ResourceConfiguration["nested"])
+	assert.Equal(t, []map[string]interface{}{{"name": "reindeer"}}, apps[1].Labels)
+	_, err = ToJson(apps[1])
+	assert.Nil(t, err)
+}
+
+func TestReadManifestWithoutApplicationsFails(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, "---\napplications: []\n")
+	defer cleanup()
+	_, err := readManifest(ctx, fileName)
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, fileName+": no applications in manifest")
+}
+
+func TestReadManifestReportsEveryProblemWithItsPosition(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, `---
+applications:
+- name: olaf
+  workspace:
+    catalogItemType: Saml20
+    accessPolicy: default
+    accessPolicySetUuid: 1234
+    authInfo:
+      type: WSFed12
+      validityTimeSeconds: soon
+      configureAs: magic
+- name: sven
+  workspace:
+    description: |
+      name: not a key
+    catalogItemType: WebAppLink
+    entitleUsers:
+    - joe
+    - name: ann
+      activation: never
+    authInfo:
+      type: WebAppLink
+- workspace:
+    catalogItemType: Unknown
+    iconFile: /no/such/icon.png
+`)
+	defer cleanup()
+	apps, err := readManifest(ctx, fileName)
+	assert.Nil(t, apps)
+	assert.Equal(t, ErrUsage, KindOf(err))
+	assert.EqualError(t, err, "8 problems in manifest "+fileName)
+	for _, msg := range []string{
+		`:7:5: Invalid manifest for olaf: both accessPolicy "default" and AccessPolicySetUuid "1234" cannot be specified`,
+		`:9:7: Invalid manifest for olaf: authInfo type "WSFed12" is not the catalogItemType "Saml20"`,
+		`:10:7: Invalid manifest for olaf: authInfo.validityTimeSeconds must be a number, not "soon"`,
+		`:11:7: Invalid manifest for olaf: authInfo.configureAs must be one of manual, url, not "magic"`,
+		`:19:7: Invalid manifest for sven: user "ann": activation must be automatic or user, not "never"`,
+		`:21:5: Invalid manifest for sven: authInfo.targetUrl must be given for WebAppLink apps`,
+		`:23:3: Invalid manifest for app: a name must be given`,
+		`:25:5: Invalid manifest for app: cannot read icon file: stat /no/such/icon.png: no such file or directory`,
+		`:24:5: Warning for app: authInfo of catalogItemType "Unknown" is not checked`,
+	} {
+		AssertErrorContains(t, ctx, fileName+msg)
+	}
+	assert.Empty(t, ctx.Log.InfoString())
+}
+
+func TestReadManifestWarnsAboutAppsOfOtherTypes(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, twoAppsManifest+"- name: anna\n  workspace:\n    catalogItemType: NativeApp\n")
+	defer cleanup()
+	apps, err := readManifest(ctx, fileName)
+	require.Nil(t, err)
+	assert.Len(t, apps, 3)
+	AssertOnlyErrorContains(t, ctx, fileName+`:25:5: Warning for anna: authInfo of catalogItemType "NativeApp" is not checked`)
+}
+
+func TestReadManifestChecksOpenIDConnectApps(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, `---
+applications:
+- name: anna
+  workspace:
+    catalogItemType: OpenIDConnect
+    authInfo:
+      type: OpenIDConnect
+      clientId: anna
+      redirectUrl: https://anna.example.com/callback
+      targetUrl: https://anna.example.com
+- name: elsa
+  workspace:
+    catalogItemType: OpenIDConnect
+    authInfo: {type: OpenIDConnect, clientId: elsa, redirectUrl: callback, targetUrl: https://elsa.example.com}
+- name: kristoff
+  workspace:
+    catalogItemType: OIDC
+`)
+	defer cleanup()
+	_, err := readManifest(ctx, fileName)
+	assert.EqualError(t, err, "2 problems in manifest "+fileName)
+	AssertErrorContains(t, ctx, fileName+`:14:53: Invalid manifest for elsa: authInfo.redirectUrl must be an absolute URL, not "callback"`)
+	AssertErrorContains(t, ctx, fileName+`:17:5: Invalid manifest for kristoff: catalogItemType "OIDC" must be given as OpenIDConnect`)
+	assert.NotContains(t, ctx.Log.ErrString(), "anna")
+}
+
+func TestReadManifestFindsIconFileRelativeToManifest(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, "---\napplications:\n- name: olaf\n  workspace:\n"+
+		"    catalogItemType: WSFed12\n    iconFile: no-such-icon.png\n")
+	defer cleanup()
+	_, err := readManifest(ctx, fileName)
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, "stat "+filepath.Join(filepath.Dir(fileName), "no-such-icon.png")+": no such file")
+}
+
+func TestReadManifestReportsYamlErrorLines(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, "---\napplications:\n- name: olaf\n  instances: many\n")
+	defer cleanup()
+	_, err := readManifest(ctx, fileName)
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, "Error getting manifest: "+fileName+":4: cannot unmarshal !!str `many` into int")
+}
+
+func TestPublishAppsSendsNothingIfManifestIsInvalid(t *testing.T) {
+	ctx, fileName, cleanup := manifestTester(t, twoAppsManifest+"- name: anna\n  workspace:\n    catalogItemType: OpenIDConnect\n")
+	defer cleanup()
+	err := PublishApps(ctx, fileName, false)
+	assert.Equal(t, ErrUsage, KindOf(err))
+	AssertErrorContains(t, ctx, fileName+":24:3: Invalid manifest for anna: authInfo.clientId must be given for OpenIDConnect apps")
+	assert.Empty(t, ctx.Log.InfoString())
+}
+
+func TestYamlPositionsFindsValuesByPath(t *testing.T) {
+	positions := yamlPositions([]byte(twoAppsManifest))
+	for path, pos := range map[string]yamlPos{"applications": {2, 1}, "applications[0]": {3, 3}, "applications[0].name": {3, 3},
+		"applications[0].workspace.authInfo.attributes[0].value": {11, 9}, "applications[1].workspace.labels[0].name": {18, 7},
+		"applications[1].workspace.resourceConfiguration.nested.depth": {16, 16},
+		"applications[1].workspace.authInfo.targetUrl": {21, 7}} {
+		assert.Equal(t, pos, positions[path], path)
+	}
+	assert.Equal(t, yamlPos{19, 5}, positionOf(positions, "applications[1].workspace.authInfo.missing"))
+	assert.Equal(t, yamlPos{}, positionOf(positions, "missing"))
+}
+
+func TestYamlPositionsOfAnchorsTabsAndQuotedKeys(t *testing.T) {
+	positions := yamlPositions([]byte("---\ndefaults: &defaults\n  type:\tSaml20\n" +
+		"applications:\n- name: olaf\n  workspace:\n    authInfo: *defaults\n    \"a:b\": {c: [d, e]}\n---\nother: doc\n"))
+	for path, pos := range map[string]yamlPos{"defaults.type": {3, 3}, "applications[0].workspace.authInfo": {7, 5},
+		"applications[0].workspace.a:b.c[1]": {8, 20}} {
+		assert.Equal(t, pos, positions[path], path)
+	}
+	assert.Equal(t, yamlPos{7, 5}, positionOf(positions, "applications[0].workspace.authInfo.type"))
+	assert.NotContains(t, positions, "other")
+}
@@ -22,13 +22,19 @@ import (
 	"strings"
 )
 
-func CmdLocalUserStore(ctx *HttpContext, args []string) {
+// keeps the first of a series of errors, for operations that continue after an error
+func keepFirst(first *error, err error) {
+	if *first == nil {
+		*first = err
+	}
+}
+
+func CmdLocalUserStore(ctx *HttpContext, args []string) error {
 	const desc = "Local User Store configuration"
 	const path = "localuserstore"
 	const mtype = "local.userstore"
 	if len(args) == 0 {
-		ctx.GetPrintJson(desc, path, mtype)
-		return
+		return ctx.GetPrintJson(desc, path, mtype)
 	}
 	keyvals, outp := make(map[string]interface{}), ""
 	for _, arg := range args {
@@ -36,15 +42,17 @@ func CmdLocalUserStore(ctx *HttpContext, args []string) {
 		keyvals[strings.TrimSuffix(kv[0], "=")] = kv[1]
 	}
 	ctx.Accept(mtype).ContentType(mtype)
-	if err := ctx.Request("PUT", path, keyvals, &outp); err != nil {
+	err := ctx.Request("PUT", path, keyvals, &outp)
+	if err != nil {
 		ctx.Log.Err("Error: %v\n", err)
 	} else {
 		ctx.Log.PP(desc, outp, "name", "showLocalUserStore", "associatedIdPNames", "syncClient",
 			"userStoreNameUsedForAuth", "uuid")
 	}
+	return err
 }
 
-func CmdTenantConfig(ctx *HttpContext, name string, nvpairs []string) {
+func CmdTenantConfig(ctx *HttpContext, name string, nvpairs []string) error {
 	const desc = "Tenant configuration"
 	const mtype = "tenants.tenant.config.list"
 	path := fmt.Sprintf("tenants/tenant/%s/config", name)
@@ -54,8 +62,7 @@ func CmdTenantConfig(ctx *HttpContext, name string, nvpairs []string) {
 		Links map[string]string `json:"_links"`
 	}
 	if len(nvpairs) == 0 {
-		ctx.GetPrintJson(desc, path, mtype)
-		return
+		return ctx.GetPrintJson(desc, path, mtype)
 	}
 	keyvals, outp := []nvpair{}, ""
 	for _, arg := range nvpairs {
@@ -63,25 +70,29 @@ func CmdTenantConfig(ctx *HttpContext, name string, nvpairs []string) {
 		keyvals = append(keyvals, nvpair{strings.TrimSuffix(kv[0], "="), kv[1], map[string]string{}})
 	}
 	ctx.Accept(mtype).ContentType(mtype)
-	if err := ctx.Request("PUT", path, keyvals, &outp); err != nil {
+	err := ctx.Request("PUT", path, keyvals, &outp)
+	if err != nil {
 		ctx.Log.Err("Error: %v\n", err)
 	} else {
 		ctx.Log.PP(desc, outp)
 	}
+	return err
 }
 
-func CmdSchema(ctx *HttpContext, name string) {
+func CmdSchema(ctx *HttpContext, name string) error {
 	vals := make(url.Values)
 	vals.Set("filter", fmt.Sprintf("name eq \"%s\"", name))
 	path := fmt.Sprintf("scim/Schemas?%v", vals.Encode())
-	ctx.GetPrintJson("Schema for "+name, path, "")
+	return ctx.GetPrintJson("Schema for "+name, path, "")
 }
 
-func HealthCheck(ctx *HttpContext) {
+func HealthCheck(ctx *HttpContext) error {
 	var outp interface{}
-	if err := ctx.Request("GET", "health", nil, &outp); err != nil {
+	err := ctx.Request("GET", "health", nil, &outp)
+	if err != nil {
 		ctx.Log.Err("Error on Check Health: %v\n", err)
 	} else {
 		ctx.Log.PP("Health info", outp)
 	}
+	return err
 }
@@ -22,16 +22,16 @@ import (
 // The oauth resource service interface.
 type OauthResource interface {
 	// Add creates a new oauth resource
-	Add(ctx *HttpContext, name string, info map[string]interface{})
+	Add(ctx *HttpContext, name string, info map[string]interface{}) error
 
 	// Get displays the given oauth resource by name
-	Get(ctx *HttpContext, name string)
+	Get(ctx *HttpContext, name string) error
 
 	// Delete removes an oauth resource by name
-	Delete(ctx *HttpContext, name string)
+	Delete(ctx *HttpContext, name string) error
 
 	// List displays all oauth resources of a type
-	List(ctx *HttpContext)
+	List(ctx *HttpContext) error
 }
 
 // The generic resource service interface.
@@ -51,29 +51,33 @@ var OauthClientService = &OauthResourceService{"Oauth2 Client", "oauth2clients",
 	}}
 
 // Get displays oauth2 resource info
-func (rs *OauthResourceService) Get(ctx *HttpContext, name string) {
-	ctx.GetPrintJson("Get "+rs.resType+" "+name, rs.path+"/"+name, rs.itemMT, rs.summaryFields...)
+func (rs *OauthResourceService) Get(ctx *HttpContext, name string) error {
+	return ctx.GetPrintJson("Get "+rs.resType+" "+name, rs.path+"/"+name, rs.itemMT, rs.summaryFields...)
 }
 
 // Delete removes an oauth2 resource
-func (rs *OauthResourceService) Delete(ctx *HttpContext, name string) {
-	if err := ctx.ContentType(rs.itemMT).Accept(rs.itemMT).Request("DELETE", rs.path+"/"+name, nil, nil); err != nil {
+func (rs *OauthResourceService) Delete(ctx *HttpContext, name string) error {
+	err := ctx.ContentType(rs.itemMT).Accept(rs.itemMT).Request("DELETE", rs.path+"/"+name, nil, nil)
+	if err != nil {
 		ctx.Log.Err("Error deleting %s \"%s\": %v\n", rs.resType, name, err)
 	} else {
 		ctx.Log.Info("%s \"%s\" deleted\n", rs.resType, name)
 	}
+	return err
 }
 
 // List all oauth2 resources of a type
-func (rs *OauthResourceService) List(ctx *HttpContext) {
-	ctx.GetPrintJson("List "+rs.resType+"s", rs.path, rs.listMT, rs.summaryFields...)
+func (rs *OauthResourceService) List(ctx *HttpContext) error {
+	return ctx.GetPrintJson("List "+rs.resType+"s", rs.path, rs.listMT, rs.summaryFields...)
 }
 
 // add a new oauth2 resource
-func (rs *OauthResourceService) Add(ctx *HttpContext, name string, info map[string]interface{}) {
-	if err := ctx.ContentType(rs.itemMT).Request("POST", rs.path, info, nil); err != nil {
+func (rs *OauthResourceService) Add(ctx *HttpContext, name string, info map[string]interface{}) error {
+	err := ctx.ContentType(rs.itemMT).Request("POST", rs.path, info, nil)
+	if err != nil {
 		ctx.Log.Err("Error adding %s \"%s\": %v\n", rs.resType, name, err)
 	} else {
 		ctx.Log.Info("Successfully added %s \"%s\"\n", rs.resType, name)
 	}
+	return err
 }
@@ -18,6 +18,7 @@ package core
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/xml"
 	"errors"
@@ -26,6 +27,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/toqueteos/webbrowser"
@@ -50,12 +53,18 @@ type TokenInfo struct {
 type TokenGrants interface {
 	ClientCredentialsGrant(ctx *HttpContext, clientID, clientSecret string) (TokenInfo, error)
 	LoginSystemUser(ctx *HttpContext, user, password string) (TokenInfo, error)
-	AuthCodeGrant(ctx *HttpContext, userHint string) (TokenInfo, error)
-	ValidateIDToken(ctx *HttpContext, idToken string)
-	UpdateAWSCredentials(log *Logr, idToken, role, stsURL, credFile, profile string)
+	AuthCodeGrant(ctx *HttpContext, userHint string, port int) (TokenInfo, error)
+	DeviceAuthorizationGrant(ctx *HttpContext) (TokenInfo, error)
+	RefreshTokenGrant(ctx *HttpContext, refreshToken string) (TokenInfo, error)
+	ValidateIDToken(ctx *HttpContext, idToken string) error
+	UpdateAWSCredentials(log *Logr, idToken, role, stsURL, credFile, profile string) error
 }
 
-type TokenService struct{ BasePath, AuthorizePath, TokenPath, LoginPath, CliClientID, CliClientSecret string }
+type TokenService struct {
+	BasePath, AuthorizePath, TokenPath, LoginPath, DeviceAuthorizePath, CliClientID string
+
+	Proxy ProxyOptions // for requests to AWS STS, requests to the target use the context given
+}
 
 /* ClientCredsGrant takes a clientID and clientSecret and makes a request for an access token.
    Returns common TokenInfo.
@@ -84,13 +93,19 @@ func (ts TokenService) LoginSystemUser(ctx *HttpContext, user, password string)
 }
 
 const (
-	TokenCatcherPort = "8089"
-	TokenCatcherPath = "/authcodecatcher"
-	TokenCatcherHost = "http://localhost:" + TokenCatcherPort
-	TokenCatcherURI  = TokenCatcherHost + TokenCatcherPath
+	DefaultTokenCatcherPort = 8089
+	TokenCatcherPath        = "/authcodecatcher"
 )
 
-var catcherAddress = ""
+// TokenCatcherURI returns the redirect URI of the local authorization code catcher. Port 0
+// gives a URI without a port, for servers that accept any port on the loopback interface.
+func TokenCatcherURI(port int) string {
+	if port == 0 {
+		return "http://localhost" + TokenCatcherPath
+	}
+	return fmt.Sprintf("http://localhost:%d%s", port, TokenCatcherPath)
+}
+
 var authCodeDelivery, authStateDelivery = make(chan string, 1), make(chan string, 1)
 var browserLauncher = webbrowser.Open
 var openListener = net.Listen
@@ -107,6 +122,15 @@ func GenerateRandomString(randomByteCount int) string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
+/* PKCEChallenge returns a new random PKCE code verifier and its S256 code challenge.
+   See https://tools.ietf.org/html/rfc7636#section-4
+*/
+func PKCEChallenge() (verifier, challenge string) {
+	verifier = strings.TrimRight(GenerateRandomString(32), "=")
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
 // AuthCodeCatcher receives oauth2 authorization codes
 func AuthCodeCatcher(w http.ResponseWriter, req *http.Request) {
 	values := req.URL.Query()
@@ -123,29 +147,32 @@ func AuthCodeCatcher(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-/* AuthCodeGrant takes a clientID and clientSecret and makes a request for id, access, and
-   refresh tokens by launching a browser. Returns TokenInfo or an error.
+/* AuthCodeGrant makes a request for id, access, and refresh tokens by launching a browser.
+   The authorization code is received by a local http listener on the given port, or on any
+   free port if port is 0, and is protected by a PKCE code challenge. Returns TokenInfo or an error.
 */
-func (ts TokenService) AuthCodeGrant(ctx *HttpContext, userHint string) (ti TokenInfo, err error) {
-
+func (ts TokenService) AuthCodeGrant(ctx *HttpContext, userHint string, port int) (ti TokenInfo, err error) {
 	state := GenerateRandomString(32)
-	if catcherAddress == "" {
-		if listener, err := openListener("tcp", ":"+TokenCatcherPort); err != nil {
-			return ti, err
-		} else {
-			http.HandleFunc(TokenCatcherPath, AuthCodeCatcher)
-			go func() {
-				err := http.Serve(listener, nil)
-				ctx.Log.Err("Local http authcode catcher exited: %v\n", err)
-			}()
-			catcherAddress = listener.Addr().String()
-		}
-		ctx.Log.Trace("local server listening on: %s\n", catcherAddress)
+	verifier, challenge := PKCEChallenge()
+	listener, err := openListener("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return ti, err
 	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(TokenCatcherPath, AuthCodeCatcher)
+	catcher := &http.Server{Handler: mux}
+	go func() {
+		if err := catcher.Serve(listener); err != http.ErrServerClosed {
+			ctx.Log.Err("Local http authcode catcher exited: %v\n", err)
+		}
+	}()
+	defer catcher.Close()
+	ctx.Log.Trace("local server listening on: %s\n", listener.Addr().String())
+	redirectURI := TokenCatcherURI(listener.Addr().(*net.TCPAddr).Port)
 
 	authStateDelivery <- state
-	vals := url.Values{"response_type": {"code"}, "client_id": {ts.CliClientID},
-		"state": {state}, "redirect_uri": {TokenCatcherURI}}
+	vals := url.Values{"response_type": {"code"}, "client_id": {ts.CliClientID}, "state": {state},
+		"redirect_uri": {redirectURI}, "code_challenge": {challenge}, "code_challenge_method": {"S256"}}
 	if userHint != "" {
 		vals.Set("login_hint", userHint)
 	}
@@ -158,6 +185,7 @@ func (ts TokenService) AuthCodeGrant(ctx *HttpContext, userHint string) (ti Toke
 			err.Error() == fmt.Errorf("webbrowser: tried to open %q, but you are running a shell session", authUrl).Error():
 			ctx.Log.Info("Please open \n\t%s \n\t\tin your browser\n", authUrl)
 		default:
+			<-authStateDelivery
 			return TokenInfo{}, err
 		}
 	}
@@ -166,13 +194,115 @@ func (ts TokenService) AuthCodeGrant(ctx *HttpContext, userHint string) (ti Toke
 	} else {
 		ctx.Log.Trace("caught authcode: %s\n", authcode)
 		inp := url.Values{"grant_type": {"authorization_code"}, "code": {authcode},
-			"redirect_uri": {TokenCatcherURI}, "client_id": {ts.CliClientID}}.Encode()
-		ctx.BasicAuth(ts.CliClientID, ts.CliClientSecret).ContentType("application/x-www-form-urlencoded")
+			"redirect_uri": {redirectURI}, "client_id": {ts.CliClientID}, "code_verifier": {verifier}}.Encode()
+		// the code verifier authenticates this public client, no client secret is sent
+		ctx.Authorization("").ContentType("application/x-www-form-urlencoded")
 		err = ctx.Request("POST", ts.BasePath+ts.TokenPath, inp, &ti)
 	}
 	return
 }
 
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+/* DeviceAuthorization is the reply to a device authorization request.
+   See https://tools.ietf.org/html/rfc8628#section-3.2
+*/
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in,omitempty"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// token reply which may be an error while the user has not yet completed the device authorization
+type deviceTokenReply struct {
+	TokenInfo
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// default polling interval and lifetime of a device code if not given by the server, in seconds
+const defaultDevicePollInterval, defaultDeviceCodeLifetime = 5, 600
+
+var devicePollWait = time.Sleep // called via variable so that tests can avoid waiting
+
+/* DeviceAuthorizationGrant gets id, access, and refresh tokens without a local browser or
+   listener. The user is asked to open a verification URI on any device and enter a code,
+   while the token endpoint is polled until the user has completed authentication.
+   See https://tools.ietf.org/html/rfc8628. Returns TokenInfo or an error.
+*/
+func (ts TokenService) DeviceAuthorizationGrant(ctx *HttpContext) (ti TokenInfo, err error) {
+	var da DeviceAuthorization
+	// the CLI is a public client, it only identifies itself with its client_id
+	ctx.Authorization("").ContentType("application/x-www-form-urlencoded")
+	inp := url.Values{"client_id": {ts.CliClientID}}.Encode()
+	if err = ctx.Request("POST", ts.BasePath+ts.DeviceAuthorizePath, inp, &da); err != nil {
+		return
+	}
+	if da.DeviceCode == "" || da.UserCode == "" || da.VerificationURI == "" {
+		return ti, errors.New("Invalid response: no device code, user code or verification URI in reply from server")
+	}
+	ctx.Log.Info("To log in, open %s in a browser on any device and enter the code: %s\n", da.VerificationURI, da.UserCode)
+	if da.VerificationURIComplete != "" {
+		ctx.Log.Info("Or open %s\n", da.VerificationURIComplete)
+	}
+	interval, lifetime := da.Interval, da.ExpiresIn
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+	if lifetime <= 0 {
+		lifetime = defaultDeviceCodeLifetime
+	}
+	inp = url.Values{"grant_type": {DeviceCodeGrantType}, "device_code": {da.DeviceCode},
+		"client_id": {ts.CliClientID}}.Encode()
+	for waited := 0; waited < lifetime; waited += interval {
+		devicePollWait(time.Duration(interval) * time.Second)
+		reply := deviceTokenReply{}
+		if err = ctx.Request("POST", ts.BasePath+ts.TokenPath, inp, &reply); err == nil {
+			return reply.TokenInfo, nil
+		}
+		switch reply.Error {
+		case "authorization_pending":
+			ctx.Log.Trace("authorization pending, polling again in %d seconds\n", interval)
+		case "slow_down":
+			interval += 5
+			ctx.Log.Trace("server asked to slow down, polling again in %d seconds\n", interval)
+		case "":
+			return TokenInfo{}, err
+		default:
+			return TokenInfo{}, fmt.Errorf("%s: %s", reply.Error, reply.ErrorDescription)
+		}
+	}
+	return TokenInfo{}, errors.New("device code expired before authorization was completed")
+}
+
+/* RefreshTokenGrant takes a refresh token from a previous grant and makes a request for a new
+   access token. As for the authorization code grant, the CLI is a public client that only
+   sends its client id. Returns TokenInfo, which may also contain new refresh and id tokens,
+   or an error.
+*/
+func (ts TokenService) RefreshTokenGrant(ctx *HttpContext, refreshToken string) (ti TokenInfo, err error) {
+	inp := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}, "client_id": {ts.CliClientID}}.Encode()
+	ctx.Authorization("").ContentType("application/x-www-form-urlencoded")
+	err = ctx.Request("POST", ts.BasePath+ts.TokenPath, inp, &ti)
+	return
+}
+
+/* TokenExpired returns true if the token is a JWT with an expiration time that has passed.
+   The signature is not verified, so this is only a hint to get a new token before the server
+   rejects the old one.
+*/
+func TokenExpired(token string) bool {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return false
+	}
+	_, hasExp := claims["exp"]
+	return hasExp && !claims.VerifyExpiresAt(time.Now().Unix(), true)
+}
+
 /* Fetch the public key to validate JWT. Return the key in PEM format or an error if not found. */
 func (ts TokenService) GetPublicKeyPEM(ctx *HttpContext) (pemPublicKey *rsa.PublicKey, err error) {
 	// @todo - we could cache the public key
@@ -184,17 +314,17 @@ func (ts TokenService) GetPublicKeyPEM(ctx *HttpContext) (pemPublicKey *rsa.Publ
 }
 
 /* Validate the ID token (locally). */
-func (ts TokenService) ValidateIDToken(ctx *HttpContext, idToken string) {
+func (ts TokenService) ValidateIDToken(ctx *HttpContext, idToken string) error {
 	if idToken == "" {
 		ctx.Log.Err("No ID token provided.")
-		return
+		return NewError(ErrAuth, "no ID token provided")
 	}
 
 	// Fetch the public key
 	publicKey, err := ts.GetPublicKeyPEM(ctx)
 	if err != nil {
 		ctx.Log.Err(fmt.Sprintf("Could not fetch public key: %v\n", err))
-		return
+		return err
 	}
 
 	// Parse takes the token string and a function for looking up the public key
@@ -210,7 +340,7 @@ func (ts TokenService) ValidateIDToken(ctx *HttpContext, idToken string) {
 
 	if token == nil {
 		ctx.Log.Err(fmt.Sprintf("Could not parse the token: %v\n", err))
-		return
+		return &Error{Kind: ErrAuth, Err: err}
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
@@ -219,10 +349,11 @@ func (ts TokenService) ValidateIDToken(ctx *HttpContext, idToken string) {
 		expectedIssuer := ctx.HostURL + "/SAAS/auth"
 		if !token.Claims.(jwt.MapClaims).VerifyIssuer(expectedIssuer, true) {
 			ctx.Log.Err(fmt.Sprintf("Invalid issuer: '%s', expected '%s", claims["iss"], expectedIssuer))
-		} else {
-			ctx.Log.Info("ID token is valid:\n")
-			ctx.Log.PP("claims", claims)
+			return NewError(ErrAuth, "invalid issuer: '%s', expected '%s'", claims["iss"], expectedIssuer)
 		}
+		ctx.Log.Info("ID token is valid:\n")
+		ctx.Log.PP("claims", claims)
+		return nil
 	} else if ve, ok := err.(*jwt.ValidationError); ok {
 		// give more information on why this is not valid
 		if ve.Errors&jwt.ValidationErrorExpired != 0 {
@@ -233,6 +364,7 @@ func (ts TokenService) ValidateIDToken(ctx *HttpContext, idToken string) {
 			ctx.Log.Err("Could not validate the token: %v\n", err)
 		}
 	}
+	return &Error{Kind: ErrAuth, Err: err}
 }
 
 // define cred file handlers so that they can be stubbed for testing
@@ -243,14 +375,18 @@ var updateKeyInCredFile = func(f *ini.File, section, key, value string) error {
 }
 
 // exchange an ID token for AWS credentials and update them in the credFile
-func (ts TokenService) UpdateAWSCredentials(log *Logr, idToken, role, stsURL, credFile, profile string) {
+func (ts TokenService) UpdateAWSCredentials(log *Logr, idToken, role, stsURL, credFile, profile string) error {
 	if idToken == "" {
 		log.Err("No ID token provided.")
-		return
+		return NewError(ErrAuth, "no ID token provided")
 	}
 
 	// set up and make call to aws sts
 	actx, vals, outp := NewHttpContext(log, stsURL, "/", ""), make(url.Values), ""
+	if err := actx.Proxy(ts.Proxy); err != nil {
+		log.Err("Error in proxy settings: %v\n", err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
 	vals.Set("Action", "AssumeRoleWithWebIdentity")
 	vals.Set("DurationSeconds", "7200")
 	vals.Set("RoleSessionName", ts.CliClientID)
@@ -259,7 +395,7 @@ func (ts TokenService) UpdateAWSCredentials(log *Logr, idToken, role, stsURL, cr
 	vals.Set("Version", "2011-06-15")
 	if err := actx.Request("GET", fmt.Sprintf("?%v", vals.Encode()), nil, &outp); err != nil {
 		log.Err("Error getting AWS credentials: %v\n", err)
-		return
+		return err
 	}
 
 	// extract credentials from XML response
@@ -271,26 +407,28 @@ func (ts TokenService) UpdateAWSCredentials(log *Logr, idToken, role, stsURL, cr
 	}{}
 	if err := xml.Unmarshal([]byte(outp), &creds); err != nil {
 		log.Err("Error extracting credentials from AWS STS response: %v\n", err)
-		return
+		return err
 	}
 
     log.Debug("Acquired token with expiration: %s\n", creds.Expiration)
 	// save credentials in the specified AWS CLI credentials file
 	ini.PrettyFormat = false // we're updating someone's aws config file, don't mess it up.
-	if awsCfg, err := ini.LooseLoad(credFile); err != nil {
+	awsCfg, err := ini.LooseLoad(credFile)
+	if err != nil {
 		log.Err("Error loading AWS CLI credentials file \"%s\": %v\n", credFile, err)
-	} else {
-		for k, v := range map[string]string{"aws_access_key_id": creds.AccessKeyId,
-			"aws_secret_access_key": creds.SecretAccessKey, "aws_session_token": creds.SessionToken} {
-			if err := updateKeyInCredFile(awsCfg, profile, k, v); err != nil {
-				log.Err("Error updating credential in section \"%s\" of file \"%s\": %v", profile, credFile, err)
-				return
-			}
-		}
-		if err := saveCredFile(awsCfg, credFile); err != nil {
-			log.Err("Could not update AWS credentials file \"%s\": %v\n", credFile, err)
-		} else {
-			log.Info("Successfully updated AWS credentials file: %s\n", credFile)
+		return err
+	}
+	for k, v := range map[string]string{"aws_access_key_id": creds.AccessKeyId,
+		"aws_secret_access_key": creds.SecretAccessKey, "aws_session_token": creds.SessionToken} {
+		if err := updateKeyInCredFile(awsCfg, profile, k, v); err != nil {
+			log.Err("Error updating credential in section \"%s\" of file \"%s\": %v", profile, credFile, err)
+			return err
 		}
 	}
+	if err = saveCredFile(awsCfg, credFile); err != nil {
+		log.Err("Could not update AWS credentials file \"%s\": %v\n", credFile, err)
+	} else {
+		log.Info("Successfully updated AWS credentials file: %s\n", credFile)
+	}
+	return err
 }
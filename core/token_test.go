@@ -16,6 +16,8 @@ limitations under the License.
 package core
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -39,7 +41,7 @@ const (
 	goodAccessToken = "travolta.was.here"
 )
 
-var testTS = TokenService{"/base", "/authorize", "/token", "/login", "salo", "tralfamadore"}
+var testTS = TokenService{"/base", "/authorize", "/token", "/login", "/device", "salo", ProxyOptions{}}
 
 /* in these tests the clientID is "john" and the client secret is "travolta". These are adapted
    from tests written by Fanny, who apparently likes John Travolta.
@@ -95,6 +97,96 @@ func TestSystemUserLogin(t *testing.T) {
 	assert.Equal(t, ti.AccessToken, goodAccessToken)
 }
 
+func deviceAuthorizationHandler(t *testing.T, req *TstReq) *TstReply {
+	assert.Empty(t, req.Authorization, "public client should not send a client secret")
+	assert.Equal(t, "client_id=salo", req.Input)
+	return &TstReply{Output: `{"device_code": "ice-nine", "user_code": "KRSS-CYNC",
+		"verification_uri": "https://example.com/device", "expires_in": 30, "interval": 2}`}
+}
+
+// returns a token handler that replies with the given errors before replying with tokens
+func deviceTokenHandler(errs ...string) TstHandler {
+	return func(t *testing.T, req *TstReq) *TstReply {
+		assert.Empty(t, req.Authorization, "public client should not send a client secret")
+		assert.Equal(t, "client_id=salo&device_code=ice-nine&grant_type="+url.QueryEscape(DeviceCodeGrantType), req.Input)
+		if len(errs) > 0 {
+			reply := &TstReply{Status: 400, StatusMsg: `{"error": "` + errs[0] + `", "error_description": "not yet"}`}
+			errs = errs[1:]
+			return reply
+		}
+		return &TstReply{Output: `{"token_type": "Bearer", "access_token": "` + goodAccessToken + `", "refresh_token": "bokonon"}`}
+	}
+}
+
+func runDeviceAuthorizationGrant(t *testing.T, tokenHandler TstHandler) (waits []time.Duration, ti TokenInfo, err error, ctx *HttpContext) {
+	devicePollWait = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { devicePollWait = time.Sleep }()
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"POST" + testTS.BasePath + testTS.DeviceAuthorizePath: deviceAuthorizationHandler,
+		"POST" + testTS.BasePath + testTS.TokenPath:           tokenHandler})
+	defer srv.Close()
+	ti, err = testTS.DeviceAuthorizationGrant(ctx)
+	return
+}
+
+func TestDeviceAuthorizationGrantPollsUntilAuthorized(t *testing.T) {
+	waits, ti, err, ctx := runDeviceAuthorizationGrant(t, deviceTokenHandler("authorization_pending", "slow_down"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", ti.AccessTokenType)
+	assert.Equal(t, goodAccessToken, ti.AccessToken)
+	assert.Equal(t, "bokonon", ti.RefreshToken)
+	assert.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second, 7 * time.Second}, waits)
+	assert.Contains(t, ctx.Log.InfoString(), "open https://example.com/device in a browser on any device and enter the code: KRSS-CYNC")
+}
+
+func TestDeviceAuthorizationGrantFailsWhenDenied(t *testing.T) {
+	_, _, err, _ := runDeviceAuthorizationGrant(t, deviceTokenHandler("authorization_pending", "access_denied"))
+	assert.EqualError(t, err, "access_denied: not yet")
+}
+
+func TestDeviceAuthorizationGrantFailsWhenCodeExpires(t *testing.T) {
+	pending := make([]string, 100)
+	for i := range pending {
+		pending[i] = "authorization_pending"
+	}
+	waits, _, err, _ := runDeviceAuthorizationGrant(t, deviceTokenHandler(pending...))
+	assert.EqualError(t, err, "device code expired before authorization was completed")
+	assert.Len(t, waits, 15)
+}
+
+func TestDeviceAuthorizationGrantHandlesBadReply(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"POST" + testTS.BasePath + testTS.DeviceAuthorizePath: GoodPathHandler(`{"user_code": "KRSS-CYNC"}`)})
+	defer srv.Close()
+	_, err := testTS.DeviceAuthorizationGrant(ctx)
+	assert.EqualError(t, err, "Invalid response: no device code, user code or verification URI in reply from server")
+}
+
+func TestRefreshTokenGrant(t *testing.T) {
+	handler := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Empty(t, req.Authorization, "public client should not send a client secret")
+		assert.Equal(t, "client_id=salo&grant_type=refresh_token&refresh_token=bokonon", req.Input)
+		return &TstReply{Output: `{"token_type": "Bearer", "access_token": "` + goodAccessToken + `"}`}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST" + testTS.BasePath + testTS.TokenPath: handler})
+	defer srv.Close()
+	ti, err := testTS.RefreshTokenGrant(ctx, "bokonon")
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", ti.AccessTokenType)
+	assert.Equal(t, goodAccessToken, ti.AccessToken)
+}
+
+func TestTokenExpired(t *testing.T) {
+	tokenWithExp := func(exp time.Time) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": exp.Unix()}).SignedString([]byte("ice-nine"))
+		require.Nil(t, err)
+		return token
+	}
+	assert.True(t, TokenExpired(tokenWithExp(time.Now().Add(-time.Minute))))
+	assert.False(t, TokenExpired(tokenWithExp(time.Now().Add(time.Hour))))
+	assert.False(t, TokenExpired(goodAccessToken), "tokens that are not JWTs are not known to be expired")
+}
+
 type codeReplyType int
 
 const (
@@ -103,18 +195,28 @@ const (
 	errorReply
 )
 
+// redirect URI and PKCE code challenge sent to the simulated browser, checked by the token handler
+var browserRedirectURI, browserCodeChallenge string
+
 func simulateBrowser(t *testing.T, replyType codeReplyType, authcode string) func(authzURL string) error {
 	return func(authzURL string) error {
 		purl, err := url.Parse(authzURL)
 		assert.Nil(t, err)
 		vals := purl.Query()
-		assert.Equal(t, TokenCatcherURI, vals.Get("redirect_uri"))
+		browserRedirectURI, browserCodeChallenge = vals.Get("redirect_uri"), vals.Get("code_challenge")
+		redirectURL, err := url.Parse(browserRedirectURI)
+		assert.Nil(t, err)
+		assert.Equal(t, "localhost", redirectURL.Hostname())
+		assert.NotEmpty(t, redirectURL.Port())
+		assert.Equal(t, TokenCatcherPath, redirectURL.Path)
 		assert.Equal(t, testTS.CliClientID, vals.Get("client_id"))
 		assert.Equal(t, "code", vals.Get("response_type"))
 		assert.Equal(t, "kazak", vals.Get("login_hint"))
+		assert.Equal(t, "S256", vals.Get("code_challenge_method"))
+		assert.Len(t, browserCodeChallenge, 43)
 		state := vals.Get("state")
 		assert.NotNil(t, state)
-		hc, outp := NewHttpContext(NewBufferedLogr(), TokenCatcherHost, "", ""), ""
+		hc, outp := NewHttpContext(NewBufferedLogr(), "http://"+redirectURL.Host, "", ""), ""
 		switch replyType {
 		case goodReply:
 			vals = url.Values{"code": {authcode}, "state": {state}}
@@ -131,13 +233,15 @@ func simulateBrowser(t *testing.T, replyType codeReplyType, authcode string) fun
 
 func tokenHandler(authcode string) func(t *testing.T, req *TstReq) *TstReply {
 	return func(t *testing.T, req *TstReq) *TstReply {
-		assert.Equal(t, "Basic c2Fsbzp0cmFsZmFtYWRvcmU=", req.Authorization)
+		assert.Empty(t, req.Authorization, "public client should not send a client secret")
 		assert.Equal(t, "application/x-www-form-urlencoded", req.ContentType)
 		vals, err := url.ParseQuery(req.Input)
 		assert.Nil(t, err)
 		assert.Equal(t, "authorization_code", vals.Get("grant_type"))
-		assert.Equal(t, TokenCatcherURI, vals.Get("redirect_uri"))
+		assert.Equal(t, browserRedirectURI, vals.Get("redirect_uri"))
 		assert.Equal(t, testTS.CliClientID, vals.Get("client_id"))
+		sum := sha256.Sum256([]byte(vals.Get("code_verifier")))
+		assert.Equal(t, browserCodeChallenge, base64.RawURLEncoding.EncodeToString(sum[:]), "code verifier should match challenge")
 		if vals.Get("code") != authcode {
 			return &TstReply{Status: 400, Output: `{"error": "invalid_request", "error_description": "so it goes..."}`}
 		}
@@ -151,7 +255,7 @@ func TestAuthCodeGrant(t *testing.T) {
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST" + testTS.BasePath + testTS.TokenPath: tokenHandler(authcode)})
 	defer srv.Close()
 	ctx.Log.TraceOn = true
-	ti, err := testTS.AuthCodeGrant(ctx, "kazak")
+	ti, err := testTS.AuthCodeGrant(ctx, "kazak", 0)
 	assert.Nil(t, err)
 	assert.Equal(t, "Bearer", ti.AccessTokenType)
 	assert.Equal(t, goodAccessToken, ti.AccessToken)
@@ -162,7 +266,7 @@ func TestHandleBadAuthCode(t *testing.T) {
 	browserLauncher = simulateBrowser(t, goodReply, "hi-ho")
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST" + testTS.BasePath + testTS.TokenPath: tokenHandler("bad-auth-code")})
 	defer srv.Close()
-	_, err := testTS.AuthCodeGrant(ctx, "kazak")
+	_, err := testTS.AuthCodeGrant(ctx, "kazak", 0)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "400 Bad Request")
 	assert.Contains(t, err.Error(), "invalid_request")
@@ -174,7 +278,7 @@ func TestHandleBadState(t *testing.T) {
 	browserLauncher = simulateBrowser(t, badState, authcode)
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST" + testTS.BasePath + testTS.TokenPath: tokenHandler(authcode)})
 	defer srv.Close()
-	_, err := testTS.AuthCodeGrant(ctx, "kazak")
+	_, err := testTS.AuthCodeGrant(ctx, "kazak", 0)
 	assert.NotNil(t, err)
 	assert.EqualError(t, err, "failed to get authorization code from server. See browser for error message.")
 }
@@ -182,7 +286,7 @@ func TestHandleBadState(t *testing.T) {
 func testAuthCodeFailure(t *testing.T, authcode, errmsg string) {
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST" + testTS.BasePath + testTS.TokenPath: tokenHandler(authcode)})
 	defer srv.Close()
-	_, err := testTS.AuthCodeGrant(ctx, "kazak")
+	_, err := testTS.AuthCodeGrant(ctx, "kazak", 0)
 	assert.EqualError(t, err, errmsg)
 }
 
@@ -197,11 +301,40 @@ func TestCanHandleFailedBrowserLaunch(t *testing.T) {
 }
 
 func TestCanHandleFailedListener(t *testing.T) {
-	origAddress, origListener := catcherAddress, openListener
-	catcherAddress = ""
+	origListener := openListener
 	openListener = func(proto, addr string) (n net.Listener, err error) { return n, errors.New("can't open listener") }
 	testAuthCodeFailure(t, "hi-ho", "can't open listener")
-	catcherAddress, openListener = origAddress, origListener
+	openListener = origListener
+}
+
+func TestAuthCodeGrantListensOnGivenPort(t *testing.T) {
+	origListener, listenAddress := openListener, ""
+	openListener = func(proto, addr string) (net.Listener, error) {
+		listenAddress = addr
+		return origListener(proto, "localhost:0")
+	}
+	defer func() { openListener = origListener }()
+	browserLauncher = simulateBrowser(t, errorReply, "hi-ho")
+	srv, ctx := NewTestContext(t, map[string]TstHandler{})
+	defer srv.Close()
+	_, err := testTS.AuthCodeGrant(ctx, "kazak", 9089)
+	assert.NotNil(t, err)
+	assert.Equal(t, "localhost:9089", listenAddress)
+}
+
+func TestTokenCatcherURI(t *testing.T) {
+	assert.Equal(t, "http://localhost:8089/authcodecatcher", TokenCatcherURI(DefaultTokenCatcherPort))
+	assert.Equal(t, "http://localhost/authcodecatcher", TokenCatcherURI(0))
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	verifier, challenge := PKCEChallenge()
+	assert.Len(t, verifier, 43)
+	assert.Regexp(t, "^[A-Za-z0-9_-]+$", verifier)
+	sum := sha256.Sum256([]byte(verifier))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), challenge)
+	otherVerifier, _ := PKCEChallenge()
+	assert.NotEqual(t, verifier, otherVerifier)
 }
 
 func TestPanicOnSecureRandomFailure(t *testing.T) {
@@ -462,6 +595,21 @@ func TestCanUpdateAWSCredentials(t *testing.T) {
 	assert.Equal(t, awsCredFileContents(goodKeyId, goodKey, goodSessionToken), string(contents))
 }
 
+func TestUpdateAWSCredentialsThroughProxy(t *testing.T) {
+	// the test server acts as proxy, so it gets requests with the full URL of STS
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GEThttp://sts.example.com/" + awsStsQueryString(goodAwsRole, goodIdToken): awsStsHandler(goodKeyId, goodKey, goodSessionToken)})
+	defer srv.Close()
+	cfgFile := WriteTempFile(t, awsCredFileContents("1", "2", "3"))
+	defer CleanupTempFile(cfgFile)
+
+	ts := testTS
+	ts.Proxy = ProxyOptions{URL: srv.URL}
+	err := ts.UpdateAWSCredentials(ctx.Log, goodIdToken, goodAwsRole, "http://sts.example.com", cfgFile.Name(), goodAwsProfile)
+	assert.Nil(t, err)
+	AssertOnlyInfoContains(t, ctx, "Successfully updated AWS credentials file")
+}
+
 func TestUpdateAWSCredentialsFailsWithoutIDToken(t *testing.T) {
 	log, expected := NewBufferedLogr(), "No ID token provided."
 	testTS.UpdateAWSCredentials(log, "", goodAwsRole, "https://nonexxistent.example.com", "/tmp/notused", goodAwsProfile)
@@ -24,26 +24,28 @@ type TokenServiceFactoryImpl struct{}
 
 /* Factory that we can mock to return the right token service */
 type TokenServiceFactory interface {
-	GetTokenService(cfg *Config, cliClientID string, cliClientSecret string) TokenGrants
+	GetTokenService(cfg *Config, cliClientID string) TokenGrants
 }
 
-func (factory TokenServiceFactoryImpl) GetTokenService(cfg *Config, cliClientID string, cliClientSecret string) TokenGrants {
+func (factory TokenServiceFactoryImpl) GetTokenService(cfg *Config, cliClientID string) TokenGrants {
 	if cfg.IsTenantInHost() {
 		return TokenService{
-			BasePath:        "/SAAS",
-			AuthorizePath:   "/auth/oauth2/authorize",
-			TokenPath:       "/auth/oauthtoken",
-			LoginPath:       "/API/1.0/REST/auth/system/login",
-			CliClientID:     cliClientID,
-			CliClientSecret: cliClientSecret}
+			BasePath:            "/SAAS",
+			AuthorizePath:       "/auth/oauth2/authorize",
+			TokenPath:           "/auth/oauthtoken",
+			LoginPath:           "/API/1.0/REST/auth/system/login",
+			DeviceAuthorizePath: "/auth/oauth2/device_authorization",
+			CliClientID:         cliClientID,
+			Proxy:               cfg.ProxyOptions()}
 	}
 	// Note: defining a base yoken service structure to avoid copy/pasting the same values
 	// for AuthorizePath, tokenPath, ... did not pass "go vet": "composite literal uses unkeyed fields"
 	return TokenService{
-		BasePath:        "",
-		AuthorizePath:   "/auth/oauth2/authorize",
-		TokenPath:       "/auth/oauthtoken",
-		LoginPath:       "/API/1.0/REST/auth/system/login",
-		CliClientID:     cliClientID,
-		CliClientSecret: cliClientSecret}
+		BasePath:            "",
+		AuthorizePath:       "/auth/oauth2/authorize",
+		TokenPath:           "/auth/oauthtoken",
+		LoginPath:           "/API/1.0/REST/auth/system/login",
+		DeviceAuthorizePath: "/auth/oauth2/device_authorization",
+		CliClientID:         cliClientID,
+		Proxy:               cfg.ProxyOptions()}
 }
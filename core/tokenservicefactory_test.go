@@ -28,7 +28,7 @@ func TestTenantInUrlTokenService(t *testing.T) {
 	cfg.Targets = make(map[string]map[string]string)
 	cfg.Targets[cfg.CurrentTarget] = map[string]string{HostOption: "full-url", HostMode: "tenant-in-host"}
 
-	svc, ok := factory.GetTokenService(cfg, "id", "secret").(TokenService)
+	svc, ok := factory.GetTokenService(cfg, "id").(TokenService)
 
 	assert.True(t, ok, "should get back a TokenService object")
 	assert.Equal(t, "/SAAS", svc.BasePath)
@@ -38,7 +38,7 @@ func TestTenantInPathTokenService(t *testing.T) {
 	factory := &TokenServiceFactoryImpl{}
 	cfg := configFor(TenantInPath)
 
-	svc, ok := factory.GetTokenService(cfg, "id", "secret").(TokenService)
+	svc, ok := factory.GetTokenService(cfg, "id").(TokenService)
 
 	assert.True(t, ok, "should get back a TokenService object")
 	assert.Equal(t, "", svc.BasePath)
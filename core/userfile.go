@@ -0,0 +1,326 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	. "github.com/vmware/priam/util"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formats of files of users
+const (
+	YamlFormat = "yaml"
+	JsonFormat = "json"
+	CsvFormat  = "csv"
+	LdifFormat = "ldif"
+)
+
+// UserFileFormats are the formats of files that users can be loaded from
+var UserFileFormats = []string{YamlFormat, JsonFormat, CsvFormat, LdifFormat}
+
+/* UserMapping maps the fields of the records in a file of users to the attributes of the
+   users. Each attribute is given the value of the named field. Field names are not case
+   sensitive. Groups is the field with the names of the groups the user is added to, and
+   Phones the field with the phone numbers of the user, which may have several values.
+   Attributes gives the field for other attributes, by the name of the attribute or the URN
+   of its schema followed by a colon and its name. Extensions gives the field for each
+   attribute of an extension schema, by the URN of the schema.
+*/
+type UserMapping struct {
+	Name, Given, Family, Email, Pwd, Groups string
+	Active                                  string                       `yaml:",omitempty"`
+	ExternalId                              string                       `yaml:"externalId,omitempty"`
+	Phones                                  string                       `yaml:",omitempty"`
+	Attributes                              map[string]string            `yaml:",omitempty"`
+	Extensions                              map[string]map[string]string `yaml:",omitempty"`
+}
+
+// mapping for files with the same fields as BasicUser
+var defaultUserMapping = UserMapping{Name: "name", Given: "given", Family: "family", Email: "email",
+	Pwd: "pwd", Groups: "groups", Active: "active", ExternalId: "externalId", Phones: "phones"}
+
+// mapping for LDIF files with the attributes of the inetOrgPerson object class. Passwords
+// are not mapped, since exports of directories usually hold hashes of the passwords.
+var defaultLdifMapping = UserMapping{Name: "uid", Given: "givenName", Family: "sn", Email: "mail",
+	Groups: "memberOf", Phones: "telephoneNumber"}
+
+// matches a password hashed with a scheme, such as {SSHA}, rather than in clear text
+var hashedPasswordRE = regexp.MustCompile(`^\{[A-Za-z0-9._-]+\}`)
+
+// a record of a file of users, with the values of each field by the lower case name of the field
+type userRecord map[string][]string
+
+func (r userRecord) value(field string) string {
+	if values := r[strings.ToLower(field)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// returns the name of a group, which is the value of the first attribute if it is a distinguished name
+func groupName(value string) string {
+	if i := strings.Index(value, "="); i > 0 && strings.HasPrefix(strings.ToLower(value), "cn=") {
+		return strings.TrimSpace(strings.SplitN(value[i+1:], ",", 2)[0])
+	}
+	return value
+}
+
+func (m *UserMapping) user(r userRecord) (BasicUser, error) {
+	u := BasicUser{Name: r.value(m.Name), Given: r.value(m.Given), Family: r.value(m.Family),
+		Email: r.value(m.Email), Pwd: r.value(m.Pwd), ExternalId: r.value(m.ExternalId)}
+	if scheme := hashedPasswordRE.FindString(u.Pwd); scheme != "" {
+		return u, fmt.Errorf("password of user \"%s\" is a %s hash, not a password", u.Name, scheme)
+	}
+	if m.Groups != "" {
+		for _, g := range r[strings.ToLower(m.Groups)] {
+			u.Groups = append(u.Groups, groupName(g))
+		}
+	}
+	if m.Phones != "" {
+		u.Phones = r[strings.ToLower(m.Phones)]
+	}
+	if v := r.value(m.Active); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return u, fmt.Errorf("active must be true or false, not \"%s\"", v)
+		}
+		u.Active = &active
+	}
+	for attr, field := range m.Attributes {
+		if v := r.value(field); v != "" {
+			u.SetAttribute(attr, v)
+		}
+	}
+	for urn, attrs := range m.Extensions {
+		for attr, field := range attrs {
+			if v := r.value(field); v != "" {
+				u.SetAttribute(urn+":"+attr, v)
+			}
+		}
+	}
+	return u, nil
+}
+
+// returns the records of a CSV file with a header line. Values of the given fields with several values are separated by ";".
+func csvRecords(content []byte, multiValued ...string) ([]userRecord, error) {
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	header, records := rows[0], []userRecord{}
+	for _, row := range rows[1:] {
+		r := make(userRecord)
+		for i, value := range row {
+			field := strings.ToLower(strings.TrimSpace(header[i]))
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			if HasString(field, multiValued) {
+				for _, v := range strings.Split(value, ";") {
+					if v = strings.TrimSpace(v); v != "" {
+						r[field] = append(r[field], v)
+					}
+				}
+			} else {
+				r[field] = append(r[field], value)
+			}
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+/* ldifRecords returns the entries of an LDIF file of content records. Values encoded in
+   base64 are decoded and folded lines are joined. Entries are separated by empty lines.
+*/
+func ldifRecords(content []byte) ([]userRecord, error) {
+	var records []userRecord
+	var lines []string
+	var lineNumbers []int // of the first line of each of the joined lines
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+		} else {
+			lines, lineNumbers = append(lines, line), append(lineNumbers, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	r := make(userRecord)
+	for i, line := range append(lines, "") {
+		if strings.TrimSpace(line) == "" {
+			if len(r) > 0 {
+				records = append(records, r)
+				r = make(userRecord)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		n, colon := lineNumbers[i], strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("line %d: expected an attribute and value", n)
+		}
+		attr, value := strings.ToLower(line[:colon]), line[colon+1:]
+		switch {
+		case strings.HasPrefix(value, ":"):
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			value = string(decoded)
+		case strings.HasPrefix(value, "<"):
+			return nil, fmt.Errorf("line %d: values from URLs are not supported", n)
+		default:
+			value = strings.TrimSpace(value)
+		}
+		if attr == "version" && len(records) == 0 && len(r) == 0 {
+			continue
+		}
+		r[attr] = append(r[attr], value)
+	}
+	return records, nil
+}
+
+// returns the string values of a field of a YAML or JSON record, which may be a single value or a list
+func fieldValues(value interface{}) []string {
+	if list, ok := value.([]interface{}); ok {
+		var values []string
+		for _, v := range list {
+			values = append(values, fmt.Sprint(v))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// returns the records of a YAML or JSON file of a list of objects
+func objectRecords(content []byte, format string) ([]userRecord, error) {
+	var objects []map[string]interface{}
+	var err error
+	if format == JsonFormat {
+		err = json.Unmarshal(content, &objects)
+	} else {
+		var yamlObjects []interface{}
+		if err = yaml.Unmarshal(content, &yamlObjects); err == nil {
+			for _, o := range yamlObjects {
+				if m, ok := ChangeKeysToString(o).(map[string]interface{}); ok {
+					objects = append(objects, m)
+				} else {
+					return nil, fmt.Errorf("expected a list of objects")
+				}
+			}
+		}
+	}
+	records := make([]userRecord, len(objects))
+	for i, o := range objects {
+		records[i] = make(userRecord)
+		for k, v := range o {
+			if v != nil {
+				records[i][strings.ToLower(k)] = fieldValues(v)
+			}
+		}
+	}
+	return records, err
+}
+
+// UserFileFormat returns the given format, or the format for the extension of the file name
+func UserFileFormat(format, fileName string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	switch ext := strings.ToLower(filepath.Ext(fileName)); ext {
+	case ".csv", ".ldif", ".json":
+		return ext[1:]
+	}
+	return YamlFormat
+}
+
+/* ReadUsersFile reads users from a file in the given format, which is found from the extension
+   of the file name if empty. The fields of the records in the file are mapped to the users by
+   the mapping file, if given. Otherwise LDIF attributes of the inetOrgPerson object class, or
+   the fields of BasicUser for other formats, are used.
+*/
+func ReadUsersFile(fileName, format, mappingFile string) ([]BasicUser, error) {
+	format = UserFileFormat(format, fileName)
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var users []BasicUser
+	if mappingFile == "" && format == YamlFormat {
+		return users, yaml.Unmarshal(content, &users)
+	} else if mappingFile == "" && format == JsonFormat {
+		return users, json.Unmarshal(content, &users)
+	}
+	mapping := defaultUserMapping
+	if format == LdifFormat {
+		mapping = defaultLdifMapping
+	}
+	if mappingFile != "" {
+		mapping = UserMapping{}
+		if err = GetYamlFile(mappingFile, &mapping); err != nil {
+			return nil, fmt.Errorf("could not read mapping file: %v", err)
+		}
+	}
+	var records []userRecord
+	switch format {
+	case CsvFormat:
+		records, err = csvRecords(content, strings.ToLower(mapping.Groups), strings.ToLower(mapping.Phones))
+	case LdifFormat:
+		records, err = ldifRecords(content)
+	case YamlFormat, JsonFormat:
+		records, err = objectRecords(content, format)
+	default:
+		return nil, fmt.Errorf("unknown format \"%s\", must be one of %s", format, strings.Join(UserFileFormats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	users = make([]BasicUser, len(records))
+	for i, r := range records {
+		if users[i], err = mapping.user(r); err != nil {
+			return nil, fmt.Errorf("record %d: %v", i+1, err)
+		}
+	}
+	return users, nil
+}
+
+// returns the URNs of the extension schemas in order
+func sortedSchemas(extensions map[string]map[string]string) []string {
+	var urns []string
+	for urn := range extensions {
+		urns = append(urns, urn)
+	}
+	sort.Strings(urns)
+	return urns
+}
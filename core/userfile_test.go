@@ -0,0 +1,158 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"os"
+	"testing"
+)
+
+const enterpriseURN = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
+// writes a temporary file with the given extension and returns its name
+func writeUsersFile(t *testing.T, ext, content string) string {
+	f := WriteTempFile(t, content)
+	name := f.Name() + ext
+	require.Nil(t, os.Rename(f.Name(), name))
+	return name
+}
+
+func TestReadUsersFromCsvFile(t *testing.T) {
+	fileName := writeUsersFile(t, ".csv", "name,given,Family,email,groups\n"+
+		"joe,joseph,,joe@example.com,admins; dancers\n"+
+		"\"sue\",\"susan, jr\",jones,,\n")
+	defer os.Remove(fileName)
+	users, err := ReadUsersFile(fileName, "", "")
+	require.Nil(t, err)
+	assert.Equal(t, []BasicUser{
+		{Name: "joe", Given: "joseph", Email: "joe@example.com", Groups: []string{"admins", "dancers"}},
+		{Name: "sue", Given: "susan, jr", Family: "jones"}}, users)
+}
+
+func TestReadUsersFromLdifFile(t *testing.T) {
+	fileName := writeUsersFile(t, ".txt", "version: 1\n\n"+
+		"# first user\n"+
+		"dn: uid=joe,ou=people,dc=example,dc=com\nuid: joe\ngivenName: Jo\n seph\nsn:: am9uZXM=\n"+
+		"memberOf: cn=admins,ou=groups,dc=example,dc=com\nmemberOf: cn=dancers,ou=groups,dc=example,dc=com\n\n"+
+		"dn: uid=sue,ou=people,dc=example,dc=com\r\nuid: sue\r\nmail: sue@example.com\r\nuserPassword: {SSHA}c2FsdA==\r\n")
+	defer os.Remove(fileName)
+	users, err := ReadUsersFile(fileName, "LDIF", "")
+	require.Nil(t, err)
+	assert.Equal(t, []BasicUser{
+		{Name: "joe", Given: "Joseph", Family: "jones", Groups: []string{"admins", "dancers"}},
+		{Name: "sue", Email: "sue@example.com"}}, users)
+}
+
+func TestReadUsersFromLdifFileWithBadLineReportsLineNumber(t *testing.T) {
+	fileName := writeUsersFile(t, ".ldif", "dn: uid=joe\ngivenName: Jo\n seph\nno colon here\n")
+	defer os.Remove(fileName)
+	_, err := ReadUsersFile(fileName, "", "")
+	assert.EqualError(t, err, "line 4: expected an attribute and value")
+}
+
+func TestReadUsersWithMappingFile(t *testing.T) {
+	mappingFile := writeUsersFile(t, ".yaml", "name: login\nemail: Mail\ngroups: teams\nextensions:\n"+
+		"  "+enterpriseURN+": {department: dept, employeeNumber: badge}\n")
+	defer os.Remove(mappingFile)
+	fileName := writeUsersFile(t, ".json", `[{"login": "joe", "mail": "joe@example.com", "teams": ["admins"], "dept": "sales", "badge": 42},
+		{"login": "sue", "given": "not mapped"}]`)
+	defer os.Remove(fileName)
+	users, err := ReadUsersFile(fileName, "", mappingFile)
+	require.Nil(t, err)
+	assert.Equal(t, []BasicUser{
+		{Name: "joe", Email: "joe@example.com", Groups: []string{"admins"},
+			Extensions: map[string]map[string]string{enterpriseURN: {"department": "sales", "employeeNumber": "42"}}},
+		{Name: "sue"}}, users)
+}
+
+func TestReadUsersWithMappedPasswordFromLdifFile(t *testing.T) {
+	mappingFile := writeUsersFile(t, ".yaml", "name: uid\npwd: userPassword\n")
+	defer os.Remove(mappingFile)
+	fileName := writeUsersFile(t, ".ldif", "dn: uid=joe\nuid: joe\nuserPassword: ice-nine\n")
+	defer os.Remove(fileName)
+	users, err := ReadUsersFile(fileName, "", mappingFile)
+	require.Nil(t, err)
+	assert.Equal(t, []BasicUser{{Name: "joe", Pwd: "ice-nine"}}, users)
+}
+
+func TestReadUsersWithHashedPasswordFails(t *testing.T) {
+	mappingFile := writeUsersFile(t, ".yaml", "name: uid\npwd: userPassword\n")
+	defer os.Remove(mappingFile)
+	fileName := writeUsersFile(t, ".ldif", "dn: uid=joe\nuid: joe\nuserPassword: ice-nine\n\n"+
+		"dn: uid=sue\nuid: sue\nuserPassword:: e1NTSEF9YzJGc2RBPT0=\n")
+	defer os.Remove(fileName)
+	_, err := ReadUsersFile(fileName, "", mappingFile)
+	assert.EqualError(t, err, `record 2: password of user "sue" is a {SSHA} hash, not a password`)
+}
+
+func TestReadUsersFromJsonFile(t *testing.T) {
+	fileName := writeUsersFile(t, ".json", `[{"name": "joe", "groups": ["admins"]}]`)
+	defer os.Remove(fileName)
+	users, err := ReadUsersFile(fileName, "", "")
+	require.Nil(t, err)
+	assert.Equal(t, []BasicUser{{Name: "joe", Groups: []string{"admins"}}}, users)
+}
+
+func TestReadUsersWithUnknownFormatFails(t *testing.T) {
+	_, err := ReadUsersFile(YAML_USERS_FILE, "xml", "")
+	assert.EqualError(t, err, `unknown format "xml", must be one of yaml, json, csv, ldif`)
+}
+
+func TestReadUsersWithMissingMappingFileFails(t *testing.T) {
+	_, err := ReadUsersFile(YAML_USERS_FILE, "", "no-such-mapping.yaml")
+	assert.Contains(t, err.Error(), "could not read mapping file")
+}
+
+func TestAddUserWithExtensionsAndGroups(t *testing.T) {
+	userH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Schemas":["urn:scim:schemas:core:1.0","`+enterpriseURN+`"]`)
+		assert.Contains(t, req.Input, `"`+enterpriseURN+`":{"department":"sales"}`)
+		return &TstReply{Output: `{"userName": "john", "id": "12345"}`, ContentType: "application/json"}
+	}
+	patchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Members":[{"Value":"12345","Type":"User"}]`)
+		return &TstReply{Status: 204}
+	}
+	var schemaRequests int32
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		userSchemaURL:           userSchemaHandler(&schemaRequests),
+		"POST/scim/Users":       userH,
+		DEFAULT_GET_USER_URL:    scimDefaultUserHandler(),
+		DEFAULT_GET_GROUP_URL:   scimDefaultGroupHandler(),
+		"POST/scim/Groups/6789": patchH})
+	defer srv.Close()
+	err := new(SCIMUsersService).AddEntity(ctx, &BasicUser{Name: DEFAULT_USERNAME, Groups: []string{DEFAULT_GROUP_NAME},
+		Extensions: map[string]map[string]string{enterpriseURN: {"department": "sales"}}})
+	assert.Nil(t, err)
+	AssertOnlyInfoContains(t, ctx, "User 'john' successfully added")
+	assert.Contains(t, ctx.Log.InfoString(), "Updated SCIM resource "+DEFAULT_GROUP_NAME)
+}
+
+func TestAddUserFailsIfGroupDoesNotExist(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"POST/scim/Users":     GoodPathHandler(`{"userName": "john", "id": "12345"}`),
+		DEFAULT_GET_USER_URL:  scimDefaultUserHandler(),
+		DEFAULT_GET_GROUP_URL: ErrorHandler(404, "no such group")})
+	defer srv.Close()
+	err := new(SCIMUsersService).AddEntity(ctx, &BasicUser{Name: DEFAULT_USERNAME, Groups: []string{DEFAULT_GROUP_NAME}})
+	assert.Equal(t, ErrNotFound, KindOf(err))
+	assert.Contains(t, ctx.Log.InfoString(), "User 'john' successfully added")
+	AssertErrorContains(t, ctx, "no such group")
+}
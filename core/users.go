@@ -20,6 +20,7 @@ import (
 	. "github.com/vmware/priam/util"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // SCIM implementation of the users service
@@ -32,10 +33,32 @@ type SCIMGroupsService struct{}
 type SCIMRolesService struct{}
 
 const coreSchemaURN = "urn:scim:schemas:core:1.0"
+const wksExtSchemaURN = "urn:scim:schemas:extension:workspace:1.0"
 
-// Define user information
+// Define user information. Users can also be given the names of groups to add them to, other
+// attributes of the core schema by name, and attributes of extension schemas by the URN of the
+// schema. Attributes other than the names, email and password are checked against the schema.
 type BasicUser struct {
-	Name, Given, Family, Email, Pwd string `yaml:",omitempty,flow"`
+	Name, Given, Family, Email, Pwd string                       `yaml:",omitempty,flow"`
+	Active                          *bool                        `yaml:",omitempty"`
+	ExternalId                      string                       `yaml:"externalId,omitempty"`
+	Phones                          []string                     `yaml:",omitempty,flow"`
+	Groups                          []string                     `yaml:",omitempty,flow"`
+	Attributes                      map[string]string            `yaml:",omitempty"`
+	Extensions                      map[string]map[string]string `yaml:",omitempty"`
+}
+
+// Define group information, members are user names
+type BasicGroup struct {
+	Name, Description string   `yaml:",omitempty"`
+	Members           []string `yaml:",omitempty,flow"`
+}
+
+// Define role information, members are user names. Scopes and permissions
+// are set in the workspace extension of the role.
+type BasicRole struct {
+	Name, Description            string   `yaml:",omitempty"`
+	Scopes, Permissions, Members []string `yaml:",omitempty,flow"`
 }
 
 type dispValue struct {
@@ -50,8 +73,10 @@ type userAccount struct {
 	Schemas               []string                                                   `json:",omitempty"`
 	UserName              string                                                     `json:",omitempty"`
 	Id                    string                                                     `json:",omitempty"`
-	Active                bool                                                       `json:",omitempty"`
+	ExternalId            string                                                     `json:",omitempty"`
+	Active                *bool                                                      `json:",omitempty"`
 	Emails, Groups, Roles []dispValue                                                `json:",omitempty"`
+	PhoneNumbers          []dispValue                                                `json:",omitempty"`
 	Meta                  *struct{ Created, LastModified, Location, Version string } `json:",omitempty"`
 	Name                  *nameAttr                                                  `json:",omitempty"`
 	WksExt                *struct{ InternalUserType, UserStatus string }             `json:"urn:scim:schemas:extension:workspace:1.0,omitempty"`
@@ -62,6 +87,28 @@ type memberValue struct {
 	Value, Type, Operation string `json:",omitempty"`
 }
 
+type groupAccount struct {
+	Schemas     []string      `json:",omitempty"`
+	DisplayName string        `json:",omitempty"`
+	Id          string        `json:",omitempty"`
+	Description string        `json:",omitempty"`
+	Members     []memberValue `json:",omitempty"`
+}
+
+type roleExt struct {
+	Scopes      []string `json:"scopes,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+type roleAccount struct {
+	Schemas     []string      `json:",omitempty"`
+	DisplayName string        `json:",omitempty"`
+	Id          string        `json:",omitempty"`
+	Description string        `json:",omitempty"`
+	Members     []memberValue `json:",omitempty"`
+	WksExt      *roleExt      `json:"urn:scim:schemas:extension:workspace:1.0,omitempty"`
+}
+
 type memberPatch struct {
 	Schemas []string      `json:",omitempty"`
 	Members []memberValue `json:",omitempty"`
@@ -70,171 +117,391 @@ type memberPatch struct {
 // -- USERS
 // @todo to put in scim_users.go
 
-func (userService SCIMUsersService) DisplayEntity(ctx *HttpContext, username string) {
-	scimGet(ctx, "Users", "userName", username)
+func (userService SCIMUsersService) DisplayEntity(ctx *HttpContext, username string) error {
+	return scimGet(ctx, "Users", "userName", username)
 }
 
-func (userService SCIMUsersService) LoadEntities(ctx *HttpContext, fileName string) {
-	var newUsers []BasicUser
-	if err := GetYamlFile(fileName, &newUsers); err != nil {
+func (userService SCIMUsersService) LoadEntities(ctx *HttpContext, fileName string, opts LoadOptions) error {
+	newUsers, err := ReadUsersFile(fileName, opts.Format, opts.MappingFile)
+	if err != nil {
 		ctx.Log.Err("could not read file of bulk users: %v\n", err)
-	} else {
-		for _, v := range newUsers {
-			userService.AddEntity(ctx, &v)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	names, schemaNeeded := make([]string, len(newUsers)), false
+	for i := range newUsers {
+		names[i], schemaNeeded = newUsers[i].Name, schemaNeeded || needsSchema(&newUsers[i])
+	}
+	var schema userSchema
+	if schemaNeeded {
+		if schema, err = getUserSchema(ctx); err != nil {
+			ctx.Log.Err("Error getting User schema: %v\n", err)
+			return err
 		}
 	}
+	return loadEntities(ctx, "users", names, opts, func(ctx *HttpContext, i int) error {
+		return scimAddUser(ctx, &newUsers[i], schema)
+	})
 }
 
-func (userService SCIMUsersService) AddEntity(ctx *HttpContext, entity interface{}) {
-	scimAddUser(ctx, entity.(*BasicUser))
+func (userService SCIMUsersService) AddEntity(ctx *HttpContext, entity interface{}) error {
+	return scimAddUser(ctx, entity.(*BasicUser), nil)
 }
 
-func (userService SCIMUsersService) UpdateEntity(ctx *HttpContext, name string, entity interface{}) {
-	scimUpdateUser(ctx, name, entity.(*BasicUser))
+func (userService SCIMUsersService) UpdateEntity(ctx *HttpContext, name string, entity interface{}) error {
+	return scimUpdateUser(ctx, name, entity.(*BasicUser))
 }
 
-func (userService SCIMUsersService) ListEntities(ctx *HttpContext, count int, filter string) {
-	scimList(ctx, count, filter,
+func (userService SCIMUsersService) ListEntities(ctx *HttpContext, count, startIndex, pageSize int, filter string) error {
+	return scimList(ctx, count, startIndex, pageSize, filter,
 		"Users", "Users", "userName", "id", "emails",
 		"display", "roles", "groups", "name",
 		"givenName", "familyName", "value")
 }
 
-func (userService SCIMUsersService) UpdateMember(ctx *HttpContext, name, member string, remove bool) {
+func (userService SCIMUsersService) UpdateMember(ctx *HttpContext, name, member string, remove bool) error {
 	ctx.Log.Err("Not implemented.")
+	return NewError(ErrUsage, "users do not have members")
 }
 
-func (userService SCIMUsersService) DeleteEntity(ctx *HttpContext, username string) {
-	scimDelete(ctx, "Users", "userName", username)
+func (userService SCIMUsersService) DeleteEntity(ctx *HttpContext, username string) error {
+	return scimDelete(ctx, "Users", "userName", username)
 }
 
 // -- GROUPS
 // @todo to put in scim_groups.go
 
-func (groupService SCIMGroupsService) DisplayEntity(ctx *HttpContext, name string) {
-	scimGet(ctx, "Groups", "displayName", name)
+func (groupService SCIMGroupsService) DisplayEntity(ctx *HttpContext, name string) error {
+	return scimGet(ctx, "Groups", "displayName", name)
 }
 
-func (groupService SCIMGroupsService) LoadEntities(ctx *HttpContext, fileName string) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (groupService SCIMGroupsService) LoadEntities(ctx *HttpContext, fileName string, opts LoadOptions) error {
+	var newGroups []BasicGroup
+	if err := GetYamlFile(fileName, &newGroups); err != nil {
+		ctx.Log.Err("could not read file of bulk groups: %v\n", err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	names := make([]string, len(newGroups))
+	for i := range newGroups {
+		names[i] = newGroups[i].Name
+	}
+	// groups that exist, such as the groups of an exported tenant loaded back into it, are updated
+	groups, err := scimIndexByName(ctx, "Groups", "displayName")
+	if err != nil {
+		ctx.Log.Err("Error getting groups: %v\n", err)
+		return err
+	}
+	return loadEntities(ctx, "groups", names, opts, func(ctx *HttpContext, i int) error {
+		item := groups[strings.ToLower(newGroups[i].Name)]
+		if item == nil {
+			return groupService.AddEntity(ctx, &newGroups[i])
+		}
+		group, err := makeGroupAccount(ctx, &newGroups[i])
+		if err != nil {
+			ctx.Log.Err("Error updating group \"%s\": could not resolve all members\n", newGroups[i].Name)
+			return err
+		}
+		return scimUpdate(ctx, "Groups", InterfaceToString(item["id"]), "group", newGroups[i].Name, group)
+	})
 }
 
-func (groupService SCIMGroupsService) AddEntity(ctx *HttpContext, entity interface{}) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (groupService SCIMGroupsService) AddEntity(ctx *HttpContext, entity interface{}) error {
+	return scimAddGroup(ctx, entity.(*BasicGroup))
 }
 
-func (groupService SCIMGroupsService) ListEntities(ctx *HttpContext, count int, filter string) {
-	scimList(ctx, count, filter, "Groups", "displayName", "id", "members", "display")
+func (groupService SCIMGroupsService) ListEntities(ctx *HttpContext, count, startIndex, pageSize int, filter string) error {
+	return scimList(ctx, count, startIndex, pageSize, filter, "Groups", "displayName", "id", "members", "display")
 }
 
-func (groupService SCIMGroupsService) DeleteEntity(ctx *HttpContext, username string) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (groupService SCIMGroupsService) DeleteEntity(ctx *HttpContext, name string) error {
+	return scimDelete(ctx, "Groups", "displayName", name)
 }
 
-func (groupService SCIMGroupsService) UpdateEntity(ctx *HttpContext, name string, entity interface{}) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (groupService SCIMGroupsService) UpdateEntity(ctx *HttpContext, name string, entity interface{}) error {
+	return scimUpdateGroup(ctx, name, entity.(*BasicGroup))
 }
 
-func (groupService SCIMGroupsService) UpdateMember(ctx *HttpContext, name, member string, remove bool) {
-	scimMember(ctx, "Groups", "displayName", name, member, remove)
+func (groupService SCIMGroupsService) UpdateMember(ctx *HttpContext, name, member string, remove bool) error {
+	return scimMember(ctx, "Groups", "displayName", name, member, remove)
 }
 
 // -- ROLES
 // @todo to put in scim_roles.go
 
-func (roleService SCIMRolesService) DisplayEntity(ctx *HttpContext, name string) {
-	scimGet(ctx, "Roles", "displayName", name)
+func (roleService SCIMRolesService) DisplayEntity(ctx *HttpContext, name string) error {
+	return scimGet(ctx, "Roles", "displayName", name)
 }
 
-func (roleService SCIMRolesService) LoadEntities(ctx *HttpContext, fileName string) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (roleService SCIMRolesService) LoadEntities(ctx *HttpContext, fileName string, opts LoadOptions) error {
+	var newRoles []BasicRole
+	if err := GetYamlFile(fileName, &newRoles); err != nil {
+		ctx.Log.Err("could not read file of bulk roles: %v\n", err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	names := make([]string, len(newRoles))
+	for i := range newRoles {
+		names[i] = newRoles[i].Name
+	}
+	// roles that exist, such as the built-in roles of an exported tenant, are updated
+	roles, err := scimIndexByName(ctx, "Roles", "displayName")
+	if err != nil {
+		ctx.Log.Err("Error getting roles: %v\n", err)
+		return err
+	}
+	return loadEntities(ctx, "roles", names, opts, func(ctx *HttpContext, i int) error {
+		item := roles[strings.ToLower(newRoles[i].Name)]
+		if item == nil {
+			return roleService.AddEntity(ctx, &newRoles[i])
+		}
+		role, err := makeRoleAccount(ctx, &newRoles[i])
+		if err != nil {
+			ctx.Log.Err("Error updating role \"%s\": could not resolve all members\n", newRoles[i].Name)
+			return err
+		}
+		return scimUpdate(ctx, "Roles", InterfaceToString(item["id"]), "role", newRoles[i].Name, role)
+	})
 }
 
-func (roleService SCIMRolesService) AddEntity(ctx *HttpContext, entity interface{}) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (roleService SCIMRolesService) AddEntity(ctx *HttpContext, entity interface{}) error {
+	return scimAddRole(ctx, entity.(*BasicRole))
 }
 
-func (roleService SCIMRolesService) ListEntities(ctx *HttpContext, count int, filter string) {
-	scimList(ctx, count, filter, "Roles", "displayName", "id")
+func (roleService SCIMRolesService) ListEntities(ctx *HttpContext, count, startIndex, pageSize int, filter string) error {
+	return scimList(ctx, count, startIndex, pageSize, filter, "Roles", "displayName", "id")
 }
 
-func (roleService SCIMRolesService) DeleteEntity(ctx *HttpContext, username string) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (roleService SCIMRolesService) DeleteEntity(ctx *HttpContext, name string) error {
+	return scimDelete(ctx, "Roles", "displayName", name)
 }
 
-func (roleService SCIMRolesService) UpdateEntity(ctx *HttpContext, name string, entity interface{}) {
-	// not implemented
-	ctx.Log.Err("Not implemented.")
+func (roleService SCIMRolesService) UpdateEntity(ctx *HttpContext, name string, entity interface{}) error {
+	return scimUpdateRole(ctx, name, entity.(*BasicRole))
 }
 
-func (roleService SCIMRolesService) UpdateMember(ctx *HttpContext, name, member string, remove bool) {
-	scimMember(ctx, "Roles", "displayName", name, member, remove)
+func (roleService SCIMRolesService) UpdateMember(ctx *HttpContext, name, member string, remove bool) error {
+	return scimMember(ctx, "Roles", "displayName", name, member, remove)
 }
 
 // -- SCIM common code
 
-func scimAddUser(ctx *HttpContext, u *BasicUser) {
+// SetAttribute sets an attribute of the core schema, or of an extension schema if the name
+// is the URN of the schema followed by a colon and the name of the attribute
+func (u *BasicUser) SetAttribute(name, value string) {
+	if i := strings.LastIndex(name, ":"); strings.HasPrefix(name, "urn:") && i > 0 {
+		urn := name[:i]
+		if u.Extensions == nil {
+			u.Extensions = make(map[string]map[string]string)
+		}
+		if u.Extensions[urn] == nil {
+			u.Extensions[urn] = make(map[string]string)
+		}
+		u.Extensions[urn][name[i+1:]] = value
+		return
+	}
+	if u.Attributes == nil {
+		u.Attributes = make(map[string]string)
+	}
+	u.Attributes[name] = value
+}
+
+// gets the User schema if it is needed to set the attributes of the user and not already known
+func schemaFor(ctx *HttpContext, u *BasicUser, schema userSchema) (userSchema, error) {
+	if schema != nil || !needsSchema(u) {
+		return schema, nil
+	}
+	schema, err := getUserSchema(ctx)
+	if err != nil {
+		ctx.Log.Err("Error getting User schema: %v\n", err)
+	}
+	return schema, err
+}
+
+// adds a user, checking attributes against the schema, which is fetched if nil and needed
+func scimAddUser(ctx *HttpContext, u *BasicUser, schema userSchema) error {
 	acct := &userAccount{UserName: u.Name, Schemas: []string{coreSchemaURN}, Password: u.Pwd}
 	acct.Name = &nameAttr{FamilyName: StringOrDefault(u.Family, u.Name), GivenName: StringOrDefault(u.Given, u.Name)}
 	acct.Emails = []dispValue{{Value: StringOrDefault(u.Email, u.Name+"@example.com")}}
-	ctx.Log.PP("add user: ", acct)
-	if err := ctx.Accept("json").Request("POST", "scim/Users", acct, acct); err != nil {
+	schema, err := schemaFor(ctx, u, schema)
+	if err != nil {
+		return err
+	}
+	body, err := userBody(acct, u, schema)
+	if err != nil {
+		ctx.Log.Err("Error creating user '%s': %v\n", u.Name, err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+	ctx.Log.PP("add user: ", body)
+	if err = ctx.Accept("json").Request("POST", "scim/Users", body, acct); err != nil {
 		ctx.Log.Err("Error creating user '%s': %v\n", u.Name, err)
+		return err
+	}
+	ctx.Log.Info(fmt.Sprintf("User '%s' successfully added\n", u.Name))
+	for _, group := range u.Groups {
+		keepFirst(&err, scimMember(ctx, "Groups", "displayName", group, u.Name, false))
+	}
+	return err
+}
+
+func scimUpdateUser(ctx *HttpContext, name string, u *BasicUser) error {
+	id, err := scimNameToID(ctx, "Users", "userName", name)
+	if err != nil {
+		return err
+	}
+	return scimPatchUser(ctx, id, name, u)
+}
+
+func scimPatchUser(ctx *HttpContext, id, name string, u *BasicUser) error {
+	acct := userAccount{UserName: u.Name, Schemas: []string{coreSchemaURN}}
+	if u.Pwd != "" {
+		acct.Password = u.Pwd
+	}
+	if u.Given != "" || u.Family != "" {
+		acct.Name = &nameAttr{FamilyName: u.Family, GivenName: u.Given}
+	}
+	if u.Email != "" {
+		acct.Emails = []dispValue{{Value: u.Email}}
+	}
+	schema, err := schemaFor(ctx, u, nil)
+	if err != nil {
+		return err
+	}
+	body, err := userBody(&acct, u, schema)
+	if err != nil {
+		ctx.Log.Err("Error updating user \"%s\": %v\n", name, err)
+		return &Error{Kind: ErrUsage, Err: err}
+	}
+
+	err = scimPatch(ctx, "Users", id, body)
+	if err != nil {
+		ctx.Log.Err("Error updating user \"%s\": %v\n", name, err)
 	} else {
-		ctx.Log.Info(fmt.Sprintf("User '%s' successfully added\n", u.Name))
+		ctx.Log.Info("User \"%s\" updated\n", name)
 	}
+	return err
 }
 
-func scimUpdateUser(ctx *HttpContext, name string, u *BasicUser) {
-	if id := scimNameToID(ctx, "Users", "userName", name); id != "" {
-		acct := userAccount{UserName: u.Name, Schemas: []string{coreSchemaURN}}
-		if u.Pwd != "" {
-			acct.Password = u.Pwd
-		}
-		if u.Given != "" || u.Family != "" {
-			acct.Name = &nameAttr{FamilyName: u.Family, GivenName: u.Given}
-		}
-		if u.Email != "" {
-			acct.Emails = []dispValue{{Value: u.Email}}
+// converts user names to SCIM member values, returns an error if any user could not be found
+func scimUserMembers(ctx *HttpContext, names []string) ([]memberValue, error) {
+	var members []memberValue
+	for _, name := range names {
+		id, err := scimNameToID(ctx, "Users", "userName", name)
+		if err != nil {
+			return nil, err
 		}
+		members = append(members, memberValue{Value: id, Type: "User"})
+	}
+	return members, nil
+}
 
-		if err := scimPatch(ctx, "Users", id, &acct); err != nil {
-			ctx.Log.Err("Error updating user \"%s\": %v\n", name, err)
-		} else {
-			ctx.Log.Info("User \"%s\" updated\n", name)
-		}
+// builds the SCIM representation of a group, returns an error if any member could not be found
+func makeGroupAccount(ctx *HttpContext, g *BasicGroup) (*groupAccount, error) {
+	members, err := scimUserMembers(ctx, g.Members)
+	if err != nil {
+		return nil, err
 	}
+	return &groupAccount{Schemas: []string{coreSchemaURN}, DisplayName: g.Name,
+		Description: g.Description, Members: members}, nil
 }
 
-func scimGetByName(ctx *HttpContext, resType, nameAttr, name string) (item map[string]interface{}, err error) {
-	output := &struct {
-		Resources                              []map[string]interface{}
-		ItemsPerPage, TotalResults, StartIndex uint
-		Schemas                                []string
-	}{}
-	vals := url.Values{"count": {"10000"}, "filter": {fmt.Sprintf("%s eq \"%s\"", nameAttr, name)}}
-	path := fmt.Sprintf("scim/%v?%v", resType, vals.Encode())
-	if err = ctx.Accept("json").Request("GET", path, nil, &output); err != nil {
-		return
+func scimAddGroup(ctx *HttpContext, g *BasicGroup) error {
+	group, err := makeGroupAccount(ctx, g)
+	if err != nil {
+		ctx.Log.Err("Error creating group '%s': could not resolve all members\n", g.Name)
+		return err
+	}
+	return scimCreate(ctx, "Groups", "group", g.Name, group)
+}
+
+func scimUpdateGroup(ctx *HttpContext, name string, g *BasicGroup) error {
+	id, err := scimNameToID(ctx, "Groups", "displayName", name)
+	if err != nil {
+		return err
+	}
+	group, err := makeGroupAccount(ctx, g)
+	if err != nil {
+		ctx.Log.Err("Error updating group \"%s\": could not resolve all members\n", name)
+		return err
+	}
+	return scimUpdate(ctx, "Groups", id, "group", name, group)
+}
+
+// builds the SCIM representation of a role, returns an error if any member could not be found
+func makeRoleAccount(ctx *HttpContext, r *BasicRole) (*roleAccount, error) {
+	members, err := scimUserMembers(ctx, r.Members)
+	if err != nil {
+		return nil, err
+	}
+	role := &roleAccount{Schemas: []string{coreSchemaURN}, DisplayName: r.Name,
+		Description: r.Description, Members: members}
+	if len(r.Scopes) > 0 || len(r.Permissions) > 0 {
+		role.Schemas = append(role.Schemas, wksExtSchemaURN)
+		role.WksExt = &roleExt{Scopes: r.Scopes, Permissions: r.Permissions}
+	}
+	return role, nil
+}
+
+func scimAddRole(ctx *HttpContext, r *BasicRole) error {
+	role, err := makeRoleAccount(ctx, r)
+	if err != nil {
+		ctx.Log.Err("Error creating role '%s': could not resolve all members\n", r.Name)
+		return err
+	}
+	return scimCreate(ctx, "Roles", "role", r.Name, role)
+}
+
+func scimUpdateRole(ctx *HttpContext, name string, r *BasicRole) error {
+	id, err := scimNameToID(ctx, "Roles", "displayName", name)
+	if err != nil {
+		return err
 	}
-	for _, v := range output.Resources {
-		if CaselessEqual(name, v[nameAttr]) {
-			if item != nil {
-				return nil, fmt.Errorf("multiple %v found named \"%s\"", resType, name)
-			} else {
+	role, err := makeRoleAccount(ctx, r)
+	if err != nil {
+		ctx.Log.Err("Error updating role \"%s\": could not resolve all members\n", name)
+		return err
+	}
+	return scimUpdate(ctx, "Roles", id, "role", name, role)
+}
+
+// creates a SCIM resource, label is the lower case name of the resource type used in messages
+func scimCreate(ctx *HttpContext, resType, label, name string, item interface{}) error {
+	ctx.Log.PP("add "+label+": ", item)
+	err := ctx.Accept("json").Request("POST", "scim/"+resType, item, item)
+	if err != nil {
+		ctx.Log.Err("Error creating %s '%s': %v\n", label, name, err)
+	} else {
+		ctx.Log.Info("%s '%s' successfully added\n", strings.Title(label), name)
+	}
+	return err
+}
+
+// patches the SCIM resource with the given id, label is used in messages
+func scimUpdate(ctx *HttpContext, resType, id, label, name string, item interface{}) error {
+	err := scimPatch(ctx, resType, id, item)
+	if err != nil {
+		ctx.Log.Err("Error updating %s \"%s\": %v\n", label, name, err)
+	} else {
+		ctx.Log.Info("%s \"%s\" updated\n", strings.Title(label), name)
+	}
+	return err
+}
+
+func scimGetByName(ctx *HttpContext, resType, nameAttr, name string) (item map[string]interface{}, err error) {
+	filter := fmt.Sprintf("%s eq \"%s\"", nameAttr, name)
+	err = scimEach(ctx, resType, filter, 0, 0, scimPageSize, func(resources []interface{}) error {
+		for _, r := range resources {
+			if v, ok := r.(map[string]interface{}); ok && CaselessEqual(name, v[nameAttr]) {
+				if item != nil {
+					return NewError(ErrConflict, "multiple %v found named \"%s\"", resType, name)
+				}
 				item = v
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	if item == nil {
-		err = fmt.Errorf("no %v found named \"%s\"", resType, name)
+		err = NewError(ErrNotFound, "no %v found named \"%s\"", resType, name)
 	}
 	return
 }
@@ -249,71 +516,154 @@ func scimGetID(ctx *HttpContext, resType, nameAttr, name string) (string, error)
 	}
 }
 
-// @param count the number of records to return
-// @param summaryLabels keys to filter the results of what to display
-func scimList(ctx *HttpContext, count int, filter string, resType string, summaryLabels ...string) {
-	vals := url.Values{}
-	if count > 0 {
-		vals.Set("count", strconv.Itoa(count))
-	}
-	if filter != "" {
-		vals.Set("filter", filter)
+// page size used when all matching resources are needed rather than displayed
+const scimPageSize = 10000
+
+// scimEach gets SCIM resources of the given type one page at a time, following startIndex
+// and totalResults until all resources are fetched, and calls handler with each page.
+// Resources already received are left out of later pages, and paging stops at a page of
+// only such resources, so that a server which ignores startIndex is not asked forever.
+// Stops on the first error returned by a request or by handler.
+// @param startIndex the 1-based index of the first resource to get, 0 for the first
+// @param count the maximum number of resources to get, 0 for all
+// @param pageSize the number of resources to request at a time, 0 for the server default
+func scimEach(ctx *HttpContext, resType, filter string, startIndex, count, pageSize int,
+	handler func(resources []interface{}) error) error {
+	seen := make(map[string]bool)
+	for {
+		vals := url.Values{}
+		if filter != "" {
+			vals.Set("filter", filter)
+		}
+		if startIndex > 1 {
+			vals.Set("startIndex", strconv.Itoa(startIndex))
+		}
+		if n := pageSize; count > 0 && (n == 0 || count < n) {
+			vals.Set("count", strconv.Itoa(count))
+		} else if n > 0 {
+			vals.Set("count", strconv.Itoa(n))
+		}
+		page := &struct {
+			Resources                              []interface{}
+			ItemsPerPage, TotalResults, StartIndex int
+		}{}
+		path := fmt.Sprintf("scim/%s?%v", resType, vals.Encode())
+		if err := ctx.Accept("json").Request("GET", path, nil, &page); err != nil {
+			return err
+		}
+		var resources []interface{}
+		for _, r := range page.Resources {
+			item, _ := r.(map[string]interface{})
+			if id := InterfaceToString(item["id"]); id == "" || !seen[id] {
+				seen[id] = id != ""
+				resources = append(resources, r)
+			}
+		}
+		received := len(page.Resources)
+		if received > 0 && len(resources) == 0 {
+			return nil
+		}
+		if err := handler(resources); err != nil {
+			return err
+		}
+		if startIndex < 1 {
+			startIndex = 1
+		}
+		if page.StartIndex > startIndex {
+			startIndex = page.StartIndex
+		}
+		if count > 0 {
+			if count -= len(resources); count <= 0 {
+				return nil
+			}
+		}
+		if startIndex += received; received == 0 || startIndex > page.TotalResults {
+			return nil
+		}
 	}
-	path := fmt.Sprintf("scim/%s?%v", resType, vals.Encode())
-	outp := make(map[string]interface{})
-	if err := ctx.Accept("json").Request("GET", path, nil, &outp); err != nil {
+}
+
+// scimList displays SCIM resources, printing each page as it is received
+// @param count the maximum number of records to display, 0 for all
+// @param startIndex the 1-based index of the first record to display
+// @param pageSize the number of records to request at a time, 0 for the server default
+// @param summaryLabels keys to filter the results of what to display
+func scimList(ctx *HttpContext, count, startIndex, pageSize int, filter string, resType string, summaryLabels ...string) error {
+	printer := ctx.Log.NewListPrinter(resType, summaryLabels...)
+	err := scimEach(ctx, resType, filter, startIndex, count, pageSize, func(resources []interface{}) error {
+		printer.Add(resources)
+		return nil
+	})
+	printer.Close()
+	if err != nil {
 		ctx.Log.Err("Error getting SCIM resources of type %s: %v\n", resType, err)
-	} else {
-		ctx.Log.PP(resType, outp["Resources"], summaryLabels...)
 	}
+	return err
 }
 
+// patches a SCIM resource. The method override header is removed after the request
+// so that it does not apply to later requests made with the same context.
 func scimPatch(ctx *HttpContext, resType, id string, input interface{}) error {
+	defer ctx.Header("X-HTTP-Method-Override", "")
 	ctx.Header("X-HTTP-Method-Override", "PATCH")
 	path := fmt.Sprintf("scim/%s/%s", resType, id)
 	return ctx.Request("POST", path, input, nil)
 }
 
-func scimNameToID(ctx *HttpContext, resType, nameAttr, name string) string {
-	if id, err := scimGetID(ctx, resType, nameAttr, name); err == nil {
-		return id
-	} else {
+func scimNameToID(ctx *HttpContext, resType, nameAttr, name string) (string, error) {
+	id, err := scimGetID(ctx, resType, nameAttr, name)
+	if err != nil {
 		ctx.Log.Err("Error getting SCIM %s ID of %s: %v\n", resType, name, err)
 	}
-	return ""
+	return id, err
 }
 
-func scimMember(ctx *HttpContext, resType, nameAttr, rname, uname string, remove bool) {
-	rid, uid := scimNameToID(ctx, resType, nameAttr, rname), scimNameToID(ctx, "Users", "userName", uname)
-	if rid == "" || uid == "" {
-		return
+func scimMember(ctx *HttpContext, resType, nameAttr, rname, uname string, remove bool) error {
+	rid, err := scimNameToID(ctx, resType, nameAttr, rname)
+	uid, uerr := scimNameToID(ctx, "Users", "userName", uname)
+	if err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return err
 	}
 	patch := memberPatch{Schemas: []string{coreSchemaURN}, Members: []memberValue{{Value: uid, Type: "User"}}}
 	if remove {
 		patch.Members[0].Operation = "delete"
 	}
-	if err := scimPatch(ctx, resType, rid, &patch); err != nil {
+	if err = scimPatch(ctx, resType, rid, &patch); err != nil {
 		ctx.Log.Err("Error updating SCIM resource %s of type %s: %v\n", rname, resType, err)
 	} else {
 		ctx.Log.Info("Updated SCIM resource %s of type %s\n", rname, resType)
 	}
+	return err
 }
 
-func scimGet(ctx *HttpContext, resType, nameAttr, rname string) {
-	if item, err := scimGetByName(ctx, resType, nameAttr, rname); err != nil {
+func scimGet(ctx *HttpContext, resType, nameAttr, rname string) error {
+	item, err := scimGetByName(ctx, resType, nameAttr, rname)
+	if err != nil {
 		ctx.Log.Err("Error getting SCIM resource named %s of type %s: %v\n", rname, resType, err)
 	} else {
 		ctx.Log.PP("", item)
 	}
+	return err
 }
 
-func scimDelete(ctx *HttpContext, resType, nameAttr, rname string) {
-	if id := scimNameToID(ctx, resType, nameAttr, rname); id != "" {
-		path := fmt.Sprintf("scim/%s/%s", resType, id)
-		if err := ctx.Request("DELETE", path, nil, nil); err != nil {
-			ctx.Log.Err("Error deleting %s %s: %v\n", resType, rname, err)
-		} else {
-			ctx.Log.Info("%s \"%s\" deleted\n", resType, rname)
-		}
+func scimDelete(ctx *HttpContext, resType, nameAttr, rname string) error {
+	id, err := scimNameToID(ctx, resType, nameAttr, rname)
+	if err != nil {
+		return err
+	}
+	return scimDeleteByID(ctx, resType, id, rname)
+}
+
+func scimDeleteByID(ctx *HttpContext, resType, id, rname string) error {
+	path := fmt.Sprintf("scim/%s/%s", resType, id)
+	err := ctx.Request("DELETE", path, nil, nil)
+	if err != nil {
+		ctx.Log.Err("Error deleting %s %s: %v\n", resType, rname, err)
+	} else {
+		ctx.Log.Info("%s \"%s\" deleted\n", resType, rname)
 	}
+	return err
 }
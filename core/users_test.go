@@ -31,6 +31,9 @@ const (
 	DEFAULT_POST_USER_URL = "POST/scim/Users/12345"
 	DEFAULT_GET_GROUP_URL = "GET/scim/Groups?count=10000&filter=displayName+eq+%22" + DEFAULT_GROUP_NAME + "%22"
 	YAML_USERS_FILE       = "../resources/newusers.yaml"
+	YAML_GROUPS_FILE      = "../resources/newgroups.yaml"
+	YAML_ROLES_FILE       = "../resources/newroles.yaml"
+	DEFAULT_GET_ROLE_URL  = "GET/scim/Roles?count=10000&filter=displayName+eq+%22" + DEFAULT_ROLE_NAME + "%22"
 )
 
 var aBasicUser = func() *BasicUser { return &BasicUser{Name: "john", Given: "travolta"} }
@@ -104,6 +107,7 @@ func TestScimGetByNameWhenMultipleUsersReturnsError(t *testing.T) {
 	_, err := scimGetByName(ctx, "Users", "userName", "john")
 	if assert.Error(t, err, "Should have returned an error") {
 		assert.Contains(t, err.Error(), "multiple Users found named \"john\"")
+		assert.Equal(t, ErrConflict, KindOf(err))
 	}
 }
 
@@ -114,6 +118,7 @@ func TestScimGetByNameWhenNoMatchReturnsError(t *testing.T) {
 	_, err := scimGetByName(ctx, "Users", "userName", "patrick")
 	if assert.Error(t, err, "Should have returned an error") {
 		assert.Contains(t, err.Error(), `no Users found named "patrick"`)
+		assert.Equal(t, ErrNotFound, KindOf(err))
 	}
 }
 
@@ -135,7 +140,7 @@ func TestScimListWithCountAndFilter(t *testing.T) {
 	srv := StartTstServer(t, map[string]TstHandler{
 		"GET/scim/Users?count=3&filter=myfilter": scimDefaultUserHandler()})
 	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/", "")
-	new(SCIMUsersService).ListEntities(ctx, 3, "myfilter")
+	new(SCIMUsersService).ListEntities(ctx, 3, 0, 0, "myfilter")
 	AssertOnlyInfoContains(t, ctx, `id: "12345"`)
 }
 
@@ -143,7 +148,7 @@ func TestScimListFilteredByLabel(t *testing.T) {
 	srv := StartTstServer(t, map[string]TstHandler{
 		"GET/scim/Users?filter=myfilter": scimDefaultUserHandler()})
 	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/", "")
-	scimList(ctx, 0, "myfilter", "Users", "userName")
+	scimList(ctx, 0, 0, 0, "myfilter", "Users", "userName")
 	AssertOnlyInfoContains(t, ctx, "userName: john")
 	assert.NotContains(t, ctx.Log.InfoString(), "id")
 }
@@ -158,7 +163,7 @@ func TestScimListWithNonExistingSummaryLabelsPrintsEmpty(t *testing.T) {
 	defer srv.Close()
 
 	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/", "")
-	scimList(ctx, 0, "", "Users", "IDontExist")
+	scimList(ctx, 0, 0, 0, "", "Users", "IDontExist")
 	AssertOnlyInfoContains(t, ctx, "")
 }
 
@@ -166,10 +171,68 @@ func TestScimListReturnsErrorOnInvalidRequest(t *testing.T) {
 	srv := StartTstServer(t, map[string]TstHandler{
 		"GET/scim/Users?filter=myfilter": ErrorHandler(404, "error scim list")})
 	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/", "")
-	new(SCIMUsersService).ListEntities(ctx, 0, "myfilter")
+	new(SCIMUsersService).ListEntities(ctx, 0, 0, 0, "myfilter")
 	AssertErrorContains(t, ctx, "Error getting SCIM resources of type Users: 404 Not Found\nerror scim list\n")
 }
 
+func TestScimListFollowsPages(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Users?count=2": GoodPathHandler(`{"totalResults": 5, "startIndex": 1, "itemsPerPage": 2,
+			"Resources": [{"userName": "u1"}, {"userName": "u2"}]}`),
+		"GET/scim/Users?count=2&startIndex=3": GoodPathHandler(`{"totalResults": 5, "startIndex": 3, "itemsPerPage": 2,
+			"Resources": [{"userName": "u3"}, {"userName": "u4"}]}`),
+		"GET/scim/Users?count=2&startIndex=5": GoodPathHandler(`{"totalResults": 5, "startIndex": 5, "itemsPerPage": 1,
+			"Resources": [{"userName": "u5"}]}`)})
+	defer srv.Close()
+	new(SCIMUsersService).ListEntities(ctx, 0, 0, 2, "")
+	AssertOnlyInfoContains(t, ctx, "---- Users ----\n- userName: u1\n- userName: u2\n- userName: u3\n"+
+		"- userName: u4\n- userName: u5\n")
+}
+
+func TestScimListStopsAtCountAndStartsAtIndex(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Users?count=2&startIndex=2": GoodPathHandler(`{"totalResults": 5,
+			"Resources": [{"userName": "u2"}, {"userName": "u3"}]}`),
+		"GET/scim/Users?count=1&startIndex=4": GoodPathHandler(`{"totalResults": 5,
+			"Resources": [{"userName": "u4"}]}`)})
+	defer srv.Close()
+	new(SCIMUsersService).ListEntities(ctx, 3, 2, 2, "")
+	AssertOnlyInfoContains(t, ctx, "- userName: u2\n- userName: u3\n- userName: u4\n")
+	assert.NotContains(t, ctx.Log.InfoString(), "u5")
+}
+
+func TestScimListStopsIfServerIgnoresStartIndex(t *testing.T) {
+	firstPage := GoodPathHandler(`{"totalResults": 5, "startIndex": 1, "itemsPerPage": 2,
+		"Resources": [{"userName": "u1", "id": "1"}, {"userName": "u2", "id": "2"}]}`)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Users?count=2":              firstPage,
+		"GET/scim/Users?count=2&startIndex=3": firstPage})
+	defer srv.Close()
+	assert.Nil(t, new(SCIMUsersService).ListEntities(ctx, 0, 0, 2, ""))
+	assert.Equal(t, "---- Users ----\n- id: \"1\"\n  userName: u1\n- id: \"2\"\n  userName: u2\n", ctx.Log.InfoString())
+}
+
+func TestScimListReportsErrorOnLaterPage(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Groups?count=1":              GoodPathHandler(`{"totalResults": 2, "Resources": [{"displayName": "g1"}]}`),
+		"GET/scim/Groups?count=1&startIndex=2": ErrorHandler(503, "try later")})
+	defer srv.Close()
+	new(SCIMGroupsService).ListEntities(ctx, 0, 0, 1, "")
+	AssertErrorContains(t, ctx, "Error getting SCIM resources of type Groups: 503 Service Unavailable")
+	assert.Contains(t, ctx.Log.InfoString(), "displayName: g1")
+}
+
+func TestScimGetByNameFollowsPages(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_USER_URL: GoodPathHandler(`{"totalResults": 2, "Resources": [{"userName": "johnny", "id": "1"}]}`),
+		"GET/scim/Users?count=10000&filter=userName+eq+%22john%22&startIndex=2": GoodPathHandler(
+			`{"totalResults": 2, "startIndex": 2, "Resources": [{"userName": "john", "id": "12345"}]}`)})
+	defer srv.Close()
+	id, err := scimGetID(ctx, "Users", "userName", "john")
+	assert.Nil(t, err)
+	assert.Equal(t, "12345", id)
+}
+
 func TestScimGetNameExists(t *testing.T) {
 	srv := StartTstServer(t, map[string]TstHandler{
 		DEFAULT_GET_USER_URL: scimDefaultUserHandler()})
@@ -311,21 +374,21 @@ func TestRemoveScimMemberReturnsErrorIfScimPatchFailed(t *testing.T) {
 func TestLoadUsersFromYaml(t *testing.T) {
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": scimDefaultUserHandler()})
 	defer srv.Close()
-	new(SCIMUsersService).LoadEntities(ctx, YAML_USERS_FILE)
+	new(SCIMUsersService).LoadEntities(ctx, YAML_USERS_FILE, LoadOptions{})
 	AssertOnlyInfoContains(t, ctx, "User 'joe1' successfully added")
 }
 
 func TestLoadUsersFromYamlFailedIfAddUserFailed(t *testing.T) {
 	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": ErrorHandler(404, "error scim add user")})
 	defer srv.Close()
-	new(SCIMUsersService).LoadEntities(ctx, YAML_USERS_FILE)
+	new(SCIMUsersService).LoadEntities(ctx, YAML_USERS_FILE, LoadOptions{})
 	AssertErrorContains(t, ctx, "Error creating user 'joe1': 404 Not Found")
 }
 
 func TestLoadUsersFromYamlFailedIfYamlFileDoesNotExist(t *testing.T) {
 	srv := StartTstServer(t, map[string]TstHandler{})
 	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/", "")
-	new(SCIMUsersService).LoadEntities(ctx, "newusers-does-not-exist.yaml")
+	new(SCIMUsersService).LoadEntities(ctx, "newusers-does-not-exist.yaml", LoadOptions{})
 	AssertErrorContains(t, ctx, "could not read file of bulk users")
 }
 
@@ -344,11 +407,128 @@ func TestListGroups(t *testing.T) {
 	srv := StartTstServer(t, map[string]TstHandler{
 		"GET/scim/Groups?count=3&filter=myfilter": scimDefaultGroupHandler()})
 	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/", "")
-	new(SCIMGroupsService).ListEntities(ctx, 3, "myfilter")
+	new(SCIMGroupsService).ListEntities(ctx, 3, 0, 0, "myfilter")
 	AssertOnlyInfoContains(t, ctx, `id: "6789"`)
 	AssertOnlyInfoContains(t, ctx, "displayName: "+DEFAULT_GROUP_NAME)
 }
 
+func TestAddGroup(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Groups": scimDefaultGroupHandler()})
+	defer srv.Close()
+	new(SCIMGroupsService).AddEntity(ctx, &BasicGroup{Name: DEFAULT_GROUP_NAME, Description: "disco"})
+	AssertOnlyInfoContains(t, ctx, "description: disco")
+	AssertOnlyInfoContains(t, ctx, "Group '"+DEFAULT_GROUP_NAME+"' successfully added")
+}
+
+func TestAddGroupWithMembers(t *testing.T) {
+	groupH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Members":[{"Value":"12345","Type":"User"}]`)
+		return scimDefaultGroupHandler()(t, req)
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_USER_URL: scimDefaultUserHandler(),
+		"POST/scim/Groups":   groupH})
+	defer srv.Close()
+	new(SCIMGroupsService).AddEntity(ctx, &BasicGroup{Name: DEFAULT_GROUP_NAME, Members: []string{DEFAULT_USERNAME}})
+	AssertOnlyInfoContains(t, ctx, "Group '"+DEFAULT_GROUP_NAME+"' successfully added")
+}
+
+func TestAddGroupFailsIfMemberDoesNotExist(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{DEFAULT_GET_USER_URL: ErrorHandler(404, "not found")})
+	defer srv.Close()
+	new(SCIMGroupsService).AddEntity(ctx, &BasicGroup{Name: DEFAULT_GROUP_NAME, Members: []string{DEFAULT_USERNAME}})
+	AssertErrorContains(t, ctx, "Error creating group '"+DEFAULT_GROUP_NAME+"': could not resolve all members")
+}
+
+func TestAddGroupReturnsErrorOnScimError(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Groups": ErrorHandler(409, "group exists")})
+	defer srv.Close()
+	err := new(SCIMGroupsService).AddEntity(ctx, &BasicGroup{Name: DEFAULT_GROUP_NAME})
+	assert.Equal(t, ErrConflict, KindOf(err))
+	AssertErrorContains(t, ctx, "409 Conflict\ngroup exists\n")
+}
+
+func TestUpdateGroup(t *testing.T) {
+	patchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Description":"disco"`)
+		return &TstReply{Status: 204}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_GROUP_URL:   scimDefaultGroupHandler(),
+		"POST/scim/Groups/6789": patchH})
+	defer srv.Close()
+	new(SCIMGroupsService).UpdateEntity(ctx, DEFAULT_GROUP_NAME, &BasicGroup{Description: "disco"})
+	AssertOnlyInfoContains(t, ctx, `Group "`+DEFAULT_GROUP_NAME+`" updated`)
+}
+
+func TestUpdateGroupFailsIfPatchFails(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_GROUP_URL:   scimDefaultGroupHandler(),
+		"POST/scim/Groups/6789": ErrorHandler(404, "error scim patch")})
+	defer srv.Close()
+	new(SCIMGroupsService).UpdateEntity(ctx, DEFAULT_GROUP_NAME, &BasicGroup{Name: "disco-night"})
+	AssertErrorContains(t, ctx, `Error updating group "`+DEFAULT_GROUP_NAME+`": 404 Not Found`)
+}
+
+func TestDeleteGroup(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_GROUP_URL:     scimDefaultGroupHandler(),
+		"DELETE/scim/Groups/6789": GoodPathHandler("")})
+	defer srv.Close()
+	new(SCIMGroupsService).DeleteEntity(ctx, DEFAULT_GROUP_NAME)
+	AssertOnlyInfoContains(t, ctx, `Groups "`+DEFAULT_GROUP_NAME+`" deleted`)
+}
+
+func TestLoadGroupsFromYaml(t *testing.T) {
+	userH := func(t *testing.T, req *TstReq) *TstReply {
+		return &TstReply{Output: `{"Resources": [{"userName": "joe", "id": "1"}, {"userName": "joe1", "id": "2"}]}`}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Groups?count=10000":                              GoodPathHandler(`{"Resources": []}`),
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe%22":  userH,
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe1%22": userH,
+		"POST/scim/Groups": scimDefaultGroupHandler()})
+	defer srv.Close()
+	new(SCIMGroupsService).LoadEntities(ctx, YAML_GROUPS_FILE, LoadOptions{})
+	AssertOnlyInfoContains(t, ctx, "Group 'dancers' successfully added")
+	AssertOnlyInfoContains(t, ctx, "Group 'singers' successfully added")
+}
+
+func TestLoadGroupsUpdatesExistingGroups(t *testing.T) {
+	userH := func(t *testing.T, req *TstReq) *TstReply {
+		return &TstReply{Output: `{"Resources": [{"userName": "joe", "id": "1"}, {"userName": "joe1", "id": "2"}]}`}
+	}
+	patchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"DisplayName":"dancers"`)
+		return &TstReply{Output: `{}`, ContentType: "application/json"}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Groups?count=10000":                              GoodPathHandler(`{"Resources": [{"displayName": "Dancers", "id": "g1"}]}`),
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe%22":  userH,
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe1%22": userH,
+		"POST/scim/Groups/g1":                                      patchH,
+		"POST/scim/Groups":                                         scimDefaultGroupHandler()})
+	defer srv.Close()
+	assert.Nil(t, new(SCIMGroupsService).LoadEntities(ctx, YAML_GROUPS_FILE, LoadOptions{}))
+	AssertOnlyInfoContains(t, ctx, `Group "dancers" updated`)
+	AssertOnlyInfoContains(t, ctx, "Group 'singers' successfully added")
+}
+
+func TestLoadGroupsFailsIfGroupsCannotBeRead(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"GET/scim/Groups?count=10000": ErrorHandler(403, "forbidden")})
+	defer srv.Close()
+	err := new(SCIMGroupsService).LoadEntities(ctx, YAML_GROUPS_FILE, LoadOptions{})
+	assert.Equal(t, ErrAuth, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, "Error getting groups: 403 Forbidden")
+}
+
+func TestLoadGroupsFromYamlFailedIfYamlFileDoesNotExist(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{})
+	defer srv.Close()
+	new(SCIMGroupsService).LoadEntities(ctx, "newgroups-does-not-exist.yaml", LoadOptions{})
+	AssertErrorContains(t, ctx, "could not read file of bulk groups")
+}
+
 // Tests for ROLES
 // @todo To be put in roles_test.go?
 
@@ -356,7 +536,113 @@ func TestListRoles(t *testing.T) {
 	srv := StartTstServer(t, map[string]TstHandler{
 		"GET/scim/Roles?count=3&filter=myfilter": scimDefaultRoleHandler()})
 	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/", "")
-	new(SCIMRolesService).ListEntities(ctx, 3, "myfilter")
+	new(SCIMRolesService).ListEntities(ctx, 3, 0, 0, "myfilter")
 	AssertOnlyInfoContains(t, ctx, `id: "123"`)
 	AssertOnlyInfoContains(t, ctx, "displayName: "+DEFAULT_ROLE_NAME)
 }
+
+func TestAddRoleWithScopesAndPermissions(t *testing.T) {
+	roleH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Description":"moves"`)
+		assert.Contains(t, req.Input, `"`+wksExtSchemaURN+`":{"scopes":["admin"],"permissions":["dance"]}`)
+		return scimDefaultRoleHandler()(t, req)
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Roles": roleH})
+	defer srv.Close()
+	new(SCIMRolesService).AddEntity(ctx, &BasicRole{Name: DEFAULT_ROLE_NAME, Description: "moves",
+		Scopes: []string{"admin"}, Permissions: []string{"dance"}})
+	AssertOnlyInfoContains(t, ctx, "Role '"+DEFAULT_ROLE_NAME+"' successfully added")
+}
+
+func TestAddRoleWithoutExtensionOmitsIt(t *testing.T) {
+	roleH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.NotContains(t, req.Input, wksExtSchemaURN)
+		return scimDefaultRoleHandler()(t, req)
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Roles": roleH})
+	defer srv.Close()
+	new(SCIMRolesService).AddEntity(ctx, &BasicRole{Name: DEFAULT_ROLE_NAME})
+	AssertOnlyInfoContains(t, ctx, "Role '"+DEFAULT_ROLE_NAME+"' successfully added")
+}
+
+func TestAddRoleFailsIfMemberDoesNotExist(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{DEFAULT_GET_USER_URL: ErrorHandler(404, "not found")})
+	defer srv.Close()
+	new(SCIMRolesService).AddEntity(ctx, &BasicRole{Name: DEFAULT_ROLE_NAME, Members: []string{DEFAULT_USERNAME}})
+	AssertErrorContains(t, ctx, "Error creating role '"+DEFAULT_ROLE_NAME+"': could not resolve all members")
+}
+
+func TestUpdateRole(t *testing.T) {
+	patchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"DisplayName":"choreographer"`)
+		return &TstReply{Status: 204}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_ROLE_URL:  scimDefaultRoleHandler(),
+		"POST/scim/Roles/123": patchH})
+	defer srv.Close()
+	new(SCIMRolesService).UpdateEntity(ctx, DEFAULT_ROLE_NAME, &BasicRole{Name: "choreographer"})
+	AssertOnlyInfoContains(t, ctx, `Role "`+DEFAULT_ROLE_NAME+`" updated`)
+}
+
+func TestUpdateRoleFailsIfPatchFails(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_ROLE_URL:  scimDefaultRoleHandler(),
+		"POST/scim/Roles/123": ErrorHandler(403, "forbidden")})
+	defer srv.Close()
+	new(SCIMRolesService).UpdateEntity(ctx, DEFAULT_ROLE_NAME, &BasicRole{Description: "moves"})
+	AssertErrorContains(t, ctx, `Error updating role "`+DEFAULT_ROLE_NAME+`": 403 Forbidden`)
+}
+
+func TestDeleteRole(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		DEFAULT_GET_ROLE_URL:    scimDefaultRoleHandler(),
+		"DELETE/scim/Roles/123": GoodPathHandler("")})
+	defer srv.Close()
+	new(SCIMRolesService).DeleteEntity(ctx, DEFAULT_ROLE_NAME)
+	AssertOnlyInfoContains(t, ctx, `Roles "`+DEFAULT_ROLE_NAME+`" deleted`)
+}
+
+func TestLoadRolesFromYaml(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Roles?count=10000": GoodPathHandler(`{"Resources": []}`),
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe%22": GoodPathHandler(
+			`{"Resources": [{"userName": "joe", "id": "1"}]}`),
+		"POST/scim/Roles": scimDefaultRoleHandler()})
+	defer srv.Close()
+	new(SCIMRolesService).LoadEntities(ctx, YAML_ROLES_FILE, LoadOptions{})
+	AssertOnlyInfoContains(t, ctx, "Role 'auditor' successfully added")
+	AssertOnlyInfoContains(t, ctx, "Role 'helpdesk' successfully added")
+}
+
+func TestLoadRolesUpdatesExistingRoles(t *testing.T) {
+	patchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Description":"read only access"`)
+		return &TstReply{Output: `{}`, ContentType: "application/json"}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Roles?count=10000": GoodPathHandler(`{"Resources": [{"displayName": "Auditor", "id": "123"}]}`),
+		"GET/scim/Users?count=10000&filter=userName+eq+%22joe%22": GoodPathHandler(
+			`{"Resources": [{"userName": "joe", "id": "1"}]}`),
+		"POST/scim/Roles/123": patchH,
+		"POST/scim/Roles":     scimDefaultRoleHandler()})
+	defer srv.Close()
+	assert.Nil(t, new(SCIMRolesService).LoadEntities(ctx, YAML_ROLES_FILE, LoadOptions{}))
+	AssertOnlyInfoContains(t, ctx, `Role "auditor" updated`)
+	AssertOnlyInfoContains(t, ctx, "Role 'helpdesk' successfully added")
+}
+
+func TestLoadRolesFailsIfRolesCannotBeRead(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"GET/scim/Roles?count=10000": ErrorHandler(403, "forbidden")})
+	defer srv.Close()
+	err := new(SCIMRolesService).LoadEntities(ctx, YAML_ROLES_FILE, LoadOptions{})
+	assert.Equal(t, ErrAuth, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, "Error getting roles: 403 Forbidden")
+}
+
+func TestLoadRolesFromYamlFailedIfYamlFileDoesNotExist(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{})
+	defer srv.Close()
+	new(SCIMRolesService).LoadEntities(ctx, "newroles-does-not-exist.yaml", LoadOptions{})
+	AssertErrorContains(t, ctx, "could not read file of bulk roles")
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/vmware/priam/util"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// an attribute of a SCIM schema. Schema is the URN of the schema of the attribute if it is
+// not the schema of the resource type, as for attributes of extension schemas.
+type schemaAttr struct {
+	Name, Type, Schema    string
+	MultiValued, ReadOnly bool
+}
+
+// attributes of the SCIM User schema, by the URN of their schema and lower case name
+type userSchema map[string]map[string]schemaAttr
+
+// gets the attributes of the User schema and of its extension schemas
+func getUserSchema(ctx *HttpContext) (userSchema, error) {
+	type schema struct {
+		Schema     string
+		Attributes []schemaAttr
+	}
+	outp := &struct {
+		schema
+		Resources []schema
+	}{}
+	vals := url.Values{"filter": {`name eq "User"`}}
+	if err := ctx.Accept("").Request("GET", "scim/Schemas?"+vals.Encode(), nil, outp); err != nil {
+		return nil, err
+	}
+	attrs := make(userSchema)
+	for _, s := range append(outp.Resources, outp.schema) {
+		for _, a := range s.Attributes {
+			urn := StringOrDefault(a.Schema, StringOrDefault(s.Schema, coreSchemaURN))
+			if attrs[urn] == nil {
+				attrs[urn] = make(map[string]schemaAttr)
+			}
+			attrs[urn][strings.ToLower(a.Name)] = a
+		}
+	}
+	return attrs, nil
+}
+
+// returns the attribute of the schema with the given URN, or an error if it cannot be set
+func (s userSchema) settable(urn, name string) (schemaAttr, error) {
+	attr, ok := s[urn][strings.ToLower(name)]
+	if !ok {
+		return attr, fmt.Errorf("no attribute \"%s\" in schema %s", name, urn)
+	}
+	if attr.ReadOnly {
+		return attr, fmt.Errorf("attribute \"%s\" is read only", name)
+	}
+	return attr, nil
+}
+
+// returns the value of a single valued attribute with the type of the attribute in the schema
+func (s userSchema) value(urn, name, value string) (interface{}, error) {
+	attr, err := s.settable(urn, name)
+	if err != nil {
+		return nil, err
+	}
+	if attr.MultiValued || strings.EqualFold(attr.Type, "complex") {
+		return nil, fmt.Errorf("attribute \"%s\" has more than one value or sub-attributes", name)
+	}
+	var typed interface{} = value
+	switch strings.ToLower(attr.Type) {
+	case "boolean":
+		typed, err = strconv.ParseBool(value)
+	case "integer":
+		typed, err = strconv.ParseInt(value, 10, 64)
+	case "decimal":
+		typed, err = strconv.ParseFloat(value, 64)
+	case "datetime":
+		_, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("value \"%s\" of attribute \"%s\" is not of type %s", value, name, attr.Type)
+	}
+	return typed, nil
+}
+
+// returns true if setting the attributes of the user needs the schema to check them
+func needsSchema(u *BasicUser) bool {
+	return u.Active != nil || u.ExternalId != "" || len(u.Phones) > 0 || len(u.Attributes) > 0 ||
+		len(u.Extensions) > 0
+}
+
+/* userBody returns the account with the other attributes of the user. The attributes are
+   checked against the schema, and values of attributes of the core schema not modeled by
+   the account, and of extension schemas, are converted to the types of the schema. The
+   extension schemas are added to the schemas of the account.
+*/
+func userBody(acct *userAccount, u *BasicUser, schema userSchema) (interface{}, error) {
+	if !needsSchema(u) {
+		return acct, nil
+	}
+	for _, a := range []struct {
+		name string
+		set  bool
+	}{{"active", u.Active != nil}, {"externalId", u.ExternalId != ""}, {"phoneNumbers", len(u.Phones) > 0}} {
+		if _, err := schema.settable(coreSchemaURN, a.name); a.set && err != nil {
+			return nil, err
+		}
+	}
+	acct.Active, acct.ExternalId = u.Active, u.ExternalId
+	for _, phone := range u.Phones {
+		acct.PhoneNumbers = append(acct.PhoneNumbers, dispValue{Value: phone})
+	}
+	var body map[string]interface{}
+	content, err := json.Marshal(acct)
+	if err == nil {
+		err = json.Unmarshal(content, &body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range u.Attributes {
+		if body[name], err = schema.value(coreSchemaURN, name, value); err != nil {
+			return nil, err
+		}
+	}
+	schemas := append([]string{}, acct.Schemas...)
+	for _, urn := range sortedSchemas(u.Extensions) {
+		attrs := make(map[string]interface{})
+		for name, value := range u.Extensions[urn] {
+			if attrs[name], err = schema.value(urn, name, value); err != nil {
+				return nil, err
+			}
+		}
+		body[urn], schemas = attrs, append(schemas, urn)
+	}
+	body["Schemas"] = schemas
+	return body, nil
+}
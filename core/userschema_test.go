@@ -0,0 +1,134 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	userSchemaURL = "GET/scim/Schemas?filter=name+eq+%22User%22"
+	customURN     = "urn:scim:schemas:extension:acme:1.0"
+)
+
+// returns a handler of the User schema that counts the requests for it
+func userSchemaHandler(requests *int32) TstHandler {
+	return func(t *testing.T, req *TstReq) *TstReply {
+		atomic.AddInt32(requests, 1)
+		return &TstReply{ContentType: "application/json", Output: `{"schema": "urn:scim:schemas:core:1.0", "attributes": [
+			{"name": "userName", "type": "string"}, {"name": "id", "type": "string", "readOnly": true},
+			{"name": "active", "type": "boolean"}, {"name": "externalId", "type": "string"},
+			{"name": "phoneNumbers", "type": "complex", "multiValued": true}, {"name": "title", "type": "string"},
+			{"name": "department", "type": "string", "schema": "` + enterpriseURN + `"},
+			{"name": "employeeNumber", "type": "string", "schema": "` + enterpriseURN + `"},
+			{"name": "badge", "type": "integer", "schema": "` + customURN + `"},
+			{"name": "hired", "type": "dateTime", "schema": "` + customURN + `"}]}`}
+	}
+}
+
+func TestAddUserWithAllAttributes(t *testing.T) {
+	var schemaRequests int32
+	active := false
+	userH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Active":false`)
+		assert.Contains(t, req.Input, `"ExternalId":"hr-42"`)
+		assert.Contains(t, req.Input, `"PhoneNumbers":[{"Value":"555-1234"}]`)
+		assert.Contains(t, req.Input, `"title":"dancer"`)
+		assert.Contains(t, req.Input, `"`+customURN+`":{"badge":42,"hired":"2026-01-02T15:04:05Z"}`)
+		assert.Contains(t, req.Input, `"Schemas":["urn:scim:schemas:core:1.0","`+customURN+`"]`)
+		return &TstReply{Output: req.Input, ContentType: "application/json"}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": userH, userSchemaURL: userSchemaHandler(&schemaRequests)})
+	defer srv.Close()
+	u := &BasicUser{Name: "john", Active: &active, ExternalId: "hr-42", Phones: []string{"555-1234"}}
+	u.SetAttribute("title", "dancer")
+	u.SetAttribute(customURN+":badge", "42")
+	u.SetAttribute(customURN+":hired", "2026-01-02T15:04:05Z")
+	assert.Nil(t, new(SCIMUsersService).AddEntity(ctx, u))
+	AssertOnlyInfoContains(t, ctx, "User 'john' successfully added")
+}
+
+func TestAddUserWithAttributesNotInSchemaFails(t *testing.T) {
+	for attr, msg := range map[string]string{
+		"nickName":             `no attribute "nickName" in schema urn:scim:schemas:core:1.0`,
+		"id":                   `attribute "id" is read only`,
+		customURN + ":badge":   `value "many" of attribute "badge" is not of type integer`,
+		customURN + ":missing": `no attribute "missing" in schema ` + customURN,
+	} {
+		var schemaRequests int32
+		srv, ctx := NewTestContext(t, map[string]TstHandler{userSchemaURL: userSchemaHandler(&schemaRequests)})
+		u := &BasicUser{Name: "john"}
+		u.SetAttribute(attr, "many")
+		err := new(SCIMUsersService).AddEntity(ctx, u)
+		assert.Equal(t, ErrUsage, KindOf(err))
+		AssertOnlyErrorContains(t, ctx, "Error creating user 'john': "+msg)
+		srv.Close()
+	}
+}
+
+func TestUpdateUserActiveFlag(t *testing.T) {
+	var schemaRequests int32
+	active := false
+	patchH := func(t *testing.T, req *TstReq) *TstReply {
+		assert.Contains(t, req.Input, `"Active":false`)
+		return &TstReply{Status: 204}
+	}
+	srv, ctx := NewTestContext(t, map[string]TstHandler{DEFAULT_GET_USER_URL: scimDefaultUserHandler(),
+		DEFAULT_POST_USER_URL: patchH, userSchemaURL: userSchemaHandler(&schemaRequests)})
+	defer srv.Close()
+	assert.Nil(t, new(SCIMUsersService).UpdateEntity(ctx, DEFAULT_USERNAME, &BasicUser{Active: &active}))
+	AssertOnlyInfoContains(t, ctx, `User "john" updated`)
+}
+
+func TestLoadUsersGetsSchemaOnce(t *testing.T) {
+	var schemaRequests int32
+	fileName := writeUsersFile(t, ".csv", "name,active,phones,title\njoe,true,555-1;555-2,dancer\nsue,false,,\n")
+	defer os.Remove(fileName)
+	mappingFile := writeUsersFile(t, ".yaml", "name: name\nactive: active\nphones: phones\nattributes: {title: title}\n")
+	defer os.Remove(mappingFile)
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": GoodPathHandler(`{}`),
+		userSchemaURL: userSchemaHandler(&schemaRequests)})
+	defer srv.Close()
+
+	users, err := ReadUsersFile(fileName, "", mappingFile)
+	require.Nil(t, err)
+	yes, no := true, false
+	assert.Equal(t, []BasicUser{{Name: "joe", Active: &yes, Phones: []string{"555-1", "555-2"},
+		Attributes: map[string]string{"title": "dancer"}}, {Name: "sue", Active: &no}}, users)
+	assert.Nil(t, new(SCIMUsersService).LoadEntities(ctx, fileName, LoadOptions{Parallel: 2, MappingFile: mappingFile}))
+	assert.Contains(t, ctx.Log.InfoString(), "2 users created")
+	assert.Equal(t, int32(1), schemaRequests)
+}
+
+func TestReadUsersWithBadActiveValueFails(t *testing.T) {
+	fileName := writeUsersFile(t, ".csv", "name,active\njoe,true\nsue,maybe\n")
+	defer os.Remove(fileName)
+	_, err := ReadUsersFile(fileName, "", "")
+	assert.EqualError(t, err, `record 2: active must be true or false, not "maybe"`)
+}
+
+func TestAddUserWithoutOtherAttributesDoesNotGetSchema(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{"POST/scim/Users": GoodPathHandler(`{}`)})
+	defer srv.Close()
+	assert.Nil(t, new(SCIMUsersService).AddEntity(ctx, &BasicUser{Name: "john", Email: "john@what.com"}))
+	AssertOnlyInfoContains(t, ctx, "User 'john' successfully added")
+}
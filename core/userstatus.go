@@ -0,0 +1,120 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/vmware/priam/util"
+)
+
+// UserStatusChange is a change of the status of user accounts
+type UserStatusChange string
+
+const (
+	DisableUser    UserStatusChange = "disable"
+	EnableUser     UserStatusChange = "enable"
+	UnlockUser     UserStatusChange = "unlock"
+	ExpirePassword UserStatusChange = "expire"
+)
+
+// values of UserStatus in the workspace extension of a user
+const (
+	userStatusActive          = "1"
+	userStatusPasswordExpired = "3"
+)
+
+type userStatusPatch struct {
+	Schemas []string
+	Active  *bool                        `json:",omitempty"`
+	WksExt  *struct{ UserStatus string } `json:"urn:scim:schemas:extension:workspace:1.0,omitempty"`
+}
+
+// returns the patch that makes a change to the status of a user, and what is done for messages
+func statusPatch(change UserStatusChange) (*userStatusPatch, string) {
+	patch := &userStatusPatch{Schemas: []string{coreSchemaURN}}
+	setStatus := func(status string) {
+		patch.Schemas = append(patch.Schemas, wksExtSchemaURN)
+		patch.WksExt = &struct{ UserStatus string }{status}
+	}
+	active := change != DisableUser
+	switch change {
+	case DisableUser:
+		patch.Active = &active
+		return patch, "Disabled"
+	case EnableUser:
+		patch.Active = &active
+		setStatus(userStatusActive)
+		return patch, "Enabled"
+	case UnlockUser:
+		setStatus(userStatusActive)
+		return patch, "Unlocked"
+	case ExpirePassword:
+		setStatus(userStatusPasswordExpired)
+		return patch, "Expired password of"
+	}
+	return nil, ""
+}
+
+/* SetUserStatus disables, enables or unlocks the named user, or expires its password. If a
+   SCIM filter is given instead of a name, the change is made to all users that match the
+   filter, and the users that could not be changed do not stop the others from being changed.
+*/
+func SetUserStatus(ctx *HttpContext, change UserStatusChange, name, filter string) error {
+	patch, done := statusPatch(change)
+	if patch == nil {
+		ctx.Log.Err("Unknown change of user status \"%s\"\n", change)
+		return NewError(ErrUsage, "unknown change of user status \"%s\"", change)
+	}
+	if filter == "" {
+		id, err := scimNameToID(ctx, "Users", "userName", name)
+		if err != nil {
+			return err
+		}
+		return setStatusByID(ctx, patch, id, name, done)
+	}
+	var users []map[string]interface{}
+	err := scimEach(ctx, "Users", filter, 0, 0, scimPageSize, func(resources []interface{}) error {
+		for _, r := range resources {
+			if item, ok := r.(map[string]interface{}); ok {
+				users = append(users, item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.Log.Err("Error getting users matching filter '%s': %v\n", filter, err)
+		return err
+	}
+	changed := 0
+	for _, user := range users {
+		name := InterfaceToString(user["userName"])
+		if e := setStatusByID(ctx, patch, InterfaceToString(user["id"]), name, done); e != nil {
+			keepFirst(&err, e)
+		} else {
+			changed++
+		}
+	}
+	ctx.Log.Info("%s %d of %d users matching filter '%s'\n", done, changed, len(users), filter)
+	return err
+}
+
+func setStatusByID(ctx *HttpContext, patch *userStatusPatch, id, name, done string) error {
+	if err := scimPatch(ctx, "Users", id, patch); err != nil {
+		ctx.Log.Err("Error updating user \"%s\": %v\n", name, err)
+		return err
+	}
+	ctx.Log.Info("%s user \"%s\"\n", done, name)
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	. "github.com/vmware/priam/testaid"
+	. "github.com/vmware/priam/util"
+	"testing"
+)
+
+func TestSetUserStatusPatchesActiveAndUserStatus(t *testing.T) {
+	for change, body := range map[UserStatusChange]string{
+		DisableUser:    `{"Schemas":["urn:scim:schemas:core:1.0"],"Active":false}`,
+		EnableUser:     `{"Schemas":["urn:scim:schemas:core:1.0","urn:scim:schemas:extension:workspace:1.0"],"Active":true,"urn:scim:schemas:extension:workspace:1.0":{"UserStatus":"1"}}`,
+		UnlockUser:     `{"Schemas":["urn:scim:schemas:core:1.0","urn:scim:schemas:extension:workspace:1.0"],"urn:scim:schemas:extension:workspace:1.0":{"UserStatus":"1"}}`,
+		ExpirePassword: `{"Schemas":["urn:scim:schemas:core:1.0","urn:scim:schemas:extension:workspace:1.0"],"urn:scim:schemas:extension:workspace:1.0":{"UserStatus":"3"}}`,
+	} {
+		body := body
+		patchH := func(t *testing.T, req *TstReq) *TstReply {
+			assert.JSONEq(t, body, req.Input)
+			return &TstReply{Status: 204}
+		}
+		srv, ctx := NewTestContext(t, map[string]TstHandler{DEFAULT_GET_USER_URL: scimDefaultUserHandler(),
+			DEFAULT_POST_USER_URL: patchH})
+		assert.Nil(t, SetUserStatus(ctx, change, DEFAULT_USERNAME, ""))
+		assert.Contains(t, ctx.Log.InfoString(), `user "john"`)
+		srv.Close()
+	}
+}
+
+func TestSetUserStatusOfUsersMatchingFilter(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{
+		"GET/scim/Users?count=10000&filter=groups+eq+%22contractors%22": GoodPathHandler(`{"totalResults": 3, "Resources": [
+			{"userName": "joe", "id": "1"}, {"userName": "sue", "id": "2"}, {"userName": "zoe", "id": "3"}]}`),
+		"POST/scim/Users/1": GoodPathHandler(""),
+		"POST/scim/Users/2": ErrorHandler(403, "not allowed"),
+		"POST/scim/Users/3": GoodPathHandler("")})
+	defer srv.Close()
+	err := SetUserStatus(ctx, DisableUser, "", `groups eq "contractors"`)
+	assert.Equal(t, ErrAuth, KindOf(err))
+	AssertErrorContains(t, ctx, `Error updating user "sue": 403 Forbidden`)
+	assert.Contains(t, ctx.Log.InfoString(), "Disabled user \"joe\"\nDisabled user \"zoe\"\n"+
+		"Disabled 2 of 3 users matching filter 'groups eq \"contractors\"'\n")
+}
+
+func TestSetStatusOfUnknownUserFails(t *testing.T) {
+	srv, ctx := NewTestContext(t, map[string]TstHandler{DEFAULT_GET_USER_URL: GoodPathHandler(`{"Resources": []}`)})
+	defer srv.Close()
+	err := SetUserStatus(ctx, UnlockUser, DEFAULT_USERNAME, "")
+	assert.Equal(t, ErrNotFound, KindOf(err))
+	AssertOnlyErrorContains(t, ctx, `no Users found named "john"`)
+}
@@ -32,6 +32,7 @@ type TstReq struct {
 type TstReply struct {
 	Output, ContentType, StatusMsg string
 	Status                         int
+	Headers                        map[string]string
 }
 
 type TstHandler func(t *testing.T, req *TstReq) *TstReply
@@ -55,6 +56,9 @@ func StartTstServer(t *testing.T, paths map[string]TstHandler) *httptest.Server
 			reply := handler(t, &TstReq{r.Header.Get("Accept"),
 				r.Header.Get("Content-Type"), r.Header.Get("Authorization"),
 				string(rbody)})
+			for k, v := range reply.Headers {
+				w.Header().Set(k, v)
+			}
 			if reply.Status != 0 && reply.Status != 200 {
 				http.Error(w, reply.StatusMsg, reply.Status)
 			}
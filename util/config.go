@@ -43,6 +43,27 @@ type Config struct {
 	Targets       map[string]map[string]string
 	fileName      string
 	Log           *Logr `yaml:"-"`
+
+	/* SecretOptions are the names of options, such as tokens, that are kept in the secret
+	 * store selected by the SecretStoreOption of each target rather than in the config file.
+	 */
+	SecretOptions []string `yaml:"-"`
+
+	// Passphrase is called to get the passphrase of the encrypted secrets file
+	Passphrase func(confirm bool) (string, error) `yaml:"-"`
+
+	stores  map[string]SecretStore // secret stores in use, by kind
+	secrets map[string]string      // values of secret options read or changed, by target and option name
+	pending []secretChange         // changes to secret stores, made when the config is saved
+	parent  *Config                // config that is saved instead of this one, see ForTarget
+}
+
+// a change to a secret option in a secret store
+type secretChange struct {
+	store               SecretStore
+	err                 error
+	target, name, value string
+	delete              bool
 }
 
 func GetYamlFile(filename string, output interface{}) error {
@@ -90,6 +111,31 @@ func PutYamlFile(filename string, input interface{}) error {
 	}
 }
 
+/* putPrivateYamlFile writes the YAML of the input to a file that only the user can read. A
+   new file is created with that mode, and the mode of an existing file is changed before it
+   is truncated, so the content is never readable by others and an existing file is left as
+   it was if its mode cannot be changed.
+*/
+func putPrivateYamlFile(filename string, input interface{}) error {
+	content, err := yaml.Marshal(input)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if err = f.Chmod(0600); err == nil {
+		if err = f.Truncate(0); err == nil {
+			_, err = f.Write(content)
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
 func (cfg *Config) Init(log *Logr, fileName string) bool {
 	if err := GetYamlFile(fileName, cfg); err != nil && !os.IsNotExist(err) {
 		log.Err("could not read config file %s, error: %v\n", fileName, err)
@@ -109,14 +155,55 @@ func (cfg *Config) Init(log *Logr, fileName string) bool {
 }
 
 func (cfg *Config) Save() bool {
-	if err := PutYamlFile(cfg.fileName, cfg); err != nil {
+	if cfg.parent != nil {
+		cfg.parent.pending, cfg.pending = append(cfg.parent.pending, cfg.pending...), nil
+		return cfg.parent.Save()
+	}
+	changes := cfg.pending
+	cfg.pending = nil
+	for _, c := range changes {
+		err := c.err
+		if err == nil && c.delete {
+			err = c.store.Delete(c.target, c.name)
+		} else if err == nil {
+			err = c.store.Set(c.target, c.name, c.value)
+		}
+		if err != nil {
+			cfg.Log.Err("could not save %s of target %s in secret store, error: %v\n", c.name, c.target, err)
+			return false
+		}
+	}
+
+	// the config file may contain tokens, so only the user may read it
+	if err := putPrivateYamlFile(cfg.fileName, cfg); err != nil {
 		cfg.Log.Err("could not write config file %s, error: %v\n", cfg.fileName, err)
 		return false
 	}
 	return true
 }
 
+/* ForTarget returns a config whose current target is the named target, to make requests to
+   more than one target. It shares the targets of this config, so options it sets, such as
+   refreshed tokens, are saved by saving either config, and saving it does not change the
+   current target of this config. It also shares the secret stores, so the passphrase of the
+   secrets file is only asked once and secrets changed by each config are saved together.
+*/
+func (cfg *Config) ForTarget(name string) *Config {
+	if cfg.stores == nil {
+		cfg.stores = make(map[string]SecretStore)
+	}
+	if cfg.secrets == nil {
+		cfg.secrets = make(map[string]string)
+	}
+	targetCfg := *cfg
+	targetCfg.CurrentTarget, targetCfg.pending, targetCfg.parent = name, nil, cfg
+	return &targetCfg
+}
+
 func (cfg *Config) Clear() {
+	for name := range cfg.Targets {
+		cfg.deleteSecrets(name)
+	}
 	cfg.CurrentTarget = NoTarget
 	cfg.Targets = nil
 	if cfg.Save() {
@@ -137,6 +224,7 @@ func (cfg *Config) ClearTarget(name string) {
 	if cfg.CurrentTarget == name {
 		cfg.CurrentTarget = NoTarget
 	}
+	cfg.deleteSecrets(name)
 	delete(cfg.Targets, name)
 	if cfg.Save() {
 		cfg.Log.Info("deleted target %s.\n", name)
@@ -148,24 +236,145 @@ func (cfg *Config) hasTarget(name string) bool {
 	return ok
 }
 
+func (cfg *Config) isSecret(name string) bool {
+	for _, s := range cfg.SecretOptions {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the secret store of the target, or nil if its secrets are kept in the config file
+func (cfg *Config) secretStore(target string) (SecretStore, error) {
+	kind := cfg.Targets[target][SecretStoreOption]
+	if kind == "" || kind == ConfigSecretStore {
+		return nil, nil
+	}
+	if store := cfg.stores[kind]; store != nil {
+		return store, nil
+	}
+	store, err := newSecretStore(cfg, kind)
+	if err == nil {
+		if cfg.stores == nil {
+			cfg.stores = make(map[string]SecretStore)
+		}
+		cfg.stores[kind] = store
+	}
+	return store, err
+}
+
+func (cfg *Config) option(target, name string) (string, error) {
+	if !cfg.isSecret(name) {
+		return cfg.Targets[target][name], nil
+	}
+	store, err := cfg.secretStore(target)
+	if store == nil {
+		return cfg.Targets[target][name], err
+	}
+	key := target + "/" + name
+	if value, ok := cfg.secrets[key]; ok {
+		return value, nil
+	}
+	value, err := store.Get(target, name)
+	if err == nil {
+		if cfg.secrets == nil {
+			cfg.secrets = make(map[string]string)
+		}
+		cfg.secrets[key] = value
+	}
+	return value, err
+}
+
+// records a change of a secret option, returns false if the option is kept in the config file
+func (cfg *Config) changeSecret(target, name, value string, delete bool) bool {
+	if !cfg.isSecret(name) {
+		return false
+	}
+	store, err := cfg.secretStore(target)
+	if store == nil && err == nil {
+		return false
+	}
+	if cfg.secrets == nil {
+		cfg.secrets = make(map[string]string)
+	}
+	cfg.secrets[target+"/"+name] = value
+	cfg.pending = append(cfg.pending, secretChange{store: store, err: err, target: target, name: name,
+		value: value, delete: delete})
+	return true
+}
+
+func (cfg *Config) deleteSecrets(target string) {
+	for _, name := range cfg.SecretOptions {
+		cfg.changeSecret(target, name, "", true)
+	}
+}
+
+// Option returns the value of an option of the current target. Secret options are read
+// from the secret store of the target.
 func (cfg *Config) Option(name string) string {
-	return cfg.Targets[cfg.CurrentTarget][name]
+	value, err := cfg.option(cfg.CurrentTarget, name)
+	if err != nil {
+		cfg.Log.Err("could not get %s from secret store, error: %v\n", name, err)
+	}
+	return value
 }
 
+// WithOptions sets options of the current target. Secret options are written to the secret
+// store of the target when the config is saved.
 func (cfg *Config) WithOptions(options map[string]string) *Config {
 	for k, v := range options {
-		cfg.Targets[cfg.CurrentTarget][k] = v
+		if !cfg.changeSecret(cfg.CurrentTarget, k, v, false) {
+			cfg.Targets[cfg.CurrentTarget][k] = v
+		}
 	}
 	return cfg
 }
 
 func (cfg *Config) WithoutOptions(optionKeys ...string) *Config {
 	for _, k := range optionKeys {
+		cfg.changeSecret(cfg.CurrentTarget, k, "", true)
 		delete(cfg.Targets[cfg.CurrentTarget], k)
 	}
 	return cfg
 }
 
+// SetSecretStore moves the secret options of the current target to the secret store of the given kind.
+func (cfg *Config) SetSecretStore(kind string) bool {
+	if cfg.CurrentTarget == NoTarget {
+		cfg.Log.Err("no target set\n")
+		return false
+	}
+	if kind != ConfigSecretStore {
+		if _, err := newSecretStore(cfg, kind); err != nil {
+			cfg.Log.Err("%v\n", err)
+			return false
+		}
+	}
+	values := make(map[string]string)
+	for _, name := range cfg.SecretOptions {
+		value, err := cfg.option(cfg.CurrentTarget, name)
+		if err != nil {
+			cfg.Log.Err("could not get %s from secret store, error: %v\n", name, err)
+			return false
+		}
+		if value != "" {
+			values[name] = value
+		}
+	}
+	cfg.WithoutOptions(cfg.SecretOptions...)
+	if kind == ConfigSecretStore {
+		delete(cfg.Targets[cfg.CurrentTarget], SecretStoreOption)
+	} else {
+		cfg.Targets[cfg.CurrentTarget][SecretStoreOption] = kind
+	}
+	if !cfg.WithOptions(values).Save() {
+		return false
+	}
+	cfg.Log.Info("secrets of target %s are kept in the %s store\n", cfg.CurrentTarget, kind)
+	return true
+}
+
 func ensureFullURL(url string) string {
 	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
 		return url
@@ -221,18 +430,20 @@ func (cfg *Config) DeleteTarget(url, name string) {
 	}
 }
 
-func (cfg *Config) SetTarget(url, name string, checkURL func(*Config) bool) {
+// SetTarget sets and saves the current target. Returns true if the target was set.
+func (cfg *Config) SetTarget(url, name string, checkURL func(*Config) bool) bool {
 	if url == "" {
-		return
+		return false
 	}
 
 	if tgt := cfg.findTarget(url, name); tgt != NoTarget {
 		// found existing target
 		cfg.CurrentTarget = tgt
-		if cfg.Save() {
-			cfg.PrintTarget("new")
+		if !cfg.Save() {
+			return false
 		}
-		return
+		cfg.PrintTarget("new")
+		return true
 	}
 
 	// if no name given, make one up.
@@ -257,7 +468,9 @@ func (cfg *Config) SetTarget(url, name string, checkURL func(*Config) bool) {
 	if (checkURL == nil || checkURL(cfg)) && cfg.Save() {
 		cfg.Log.Info("Mode detected: %s\n", hostMode)
 		cfg.PrintTarget("new")
+		return true
 	}
+	return false
 }
 
 func (cfg *Config) ListTargets() {
@@ -210,3 +210,138 @@ func TestCanDetectTenantInPathMode(t *testing.T) {
 	assert.Contains(t, cfg.Log.InfoString(), "Mode detected: tenant-in-path")
 	assert.False(t, cfg.IsTenantInHost(), "host mode should be tenant in path")
 }
+
+func TestConfigForTargetSavesOptionsWithoutChangingCurrentTarget(t *testing.T) {
+	cfg := cfgTestSetup(t)
+	defer os.Remove(cfg.fileName)
+	stagingCfg := cfg.ForTarget("staging")
+	assert.Equal(t, "https://earth.example.com", stagingCfg.Option(HostOption))
+	assert.True(t, stagingCfg.WithOptions(map[string]string{"accesstoken": "wampeter"}).Save())
+
+	saved := &Config{}
+	require.True(t, saved.Init(NewBufferedLogr(), cfg.fileName))
+	assert.Equal(t, "familyCountDown", saved.CurrentTarget)
+	assert.Equal(t, "wampeter", saved.Targets["staging"]["accesstoken"])
+}
+
+func secretsCfgTestSetup(t *testing.T, store string) *Config {
+	cfg := cfgTestSetup(t)
+	cfg.SecretOptions, cfg.Passphrase = []string{"accesstoken", "idtoken"}, passphrase("ice-nine")
+	cfg.WithOptions(map[string]string{"accesstoken": "wampeter", "idtoken": "karass", "other": "granfalloon"})
+	require.True(t, cfg.Save())
+	if store != ConfigSecretStore {
+		require.True(t, cfg.SetSecretStore(store))
+	}
+	return cfg
+}
+
+func TestConfigFileIsOnlyReadableByUser(t *testing.T) {
+	cfg := secretsCfgTestSetup(t, ConfigSecretStore)
+	defer os.Remove(cfg.fileName)
+	info, err := os.Stat(cfg.fileName)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.Contains(t, GetTempFile(t, cfg.fileName), "accesstoken: wampeter")
+}
+
+func TestSecretOptionsAreMovedToSecretStore(t *testing.T) {
+	cfg := secretsCfgTestSetup(t, FileSecretStore)
+	defer os.Remove(cfg.fileName)
+	defer os.Remove(cfg.fileName + ".secrets")
+	assert.Contains(t, cfg.Log.InfoString(), "secrets of target familyCountDown are kept in the file store")
+	contents := GetTempFile(t, cfg.fileName)
+	assert.Contains(t, contents, "secretstore: file")
+	assert.Contains(t, contents, "other: granfalloon")
+	assert.NotContains(t, contents, "wampeter")
+	assert.NotContains(t, contents, "karass")
+
+	// read the secrets with a new config from the files
+	newCfg := &Config{}
+	require.True(t, newCfg.Init(NewBufferedLogr(), cfg.fileName))
+	newCfg.SecretOptions, newCfg.Passphrase = cfg.SecretOptions, passphrase("ice-nine")
+	assert.Equal(t, "wampeter", newCfg.Option("accesstoken"))
+	assert.Equal(t, "karass", newCfg.Option("idtoken"))
+	assert.Equal(t, "granfalloon", newCfg.Option("other"))
+}
+
+func TestConfigsForTargetsShareTheSecretsFile(t *testing.T) {
+	cfg := secretsCfgTestSetup(t, FileSecretStore)
+	defer os.Remove(cfg.fileName)
+	defer os.Remove(cfg.fileName + ".secrets")
+	require.True(t, cfg.ForTarget("staging").SetSecretStore(FileSecretStore))
+
+	newCfg, asked := &Config{}, 0
+	require.True(t, newCfg.Init(NewBufferedLogr(), cfg.fileName))
+	newCfg.SecretOptions = cfg.SecretOptions
+	newCfg.Passphrase = func(bool) (string, error) {
+		asked++
+		return "ice-nine", nil
+	}
+	cfgA, cfgB := newCfg.ForTarget("familyCountDown"), newCfg.ForTarget("staging")
+	assert.Equal(t, "wampeter", cfgA.Option("accesstoken"))
+	assert.True(t, cfgB.WithOptions(map[string]string{"accesstoken": "foma"}).Save())
+	assert.True(t, cfgA.WithOptions(map[string]string{"accesstoken": "bokonon"}).Save())
+	assert.Equal(t, 1, asked)
+
+	saved := &Config{}
+	require.True(t, saved.Init(NewBufferedLogr(), cfg.fileName))
+	saved.SecretOptions, saved.Passphrase = cfg.SecretOptions, passphrase("ice-nine")
+	assert.Equal(t, "bokonon", saved.Option("accesstoken"))
+	assert.Equal(t, "foma", saved.ForTarget("staging").Option("accesstoken"))
+}
+
+func TestSecretOptionsInStoreCanBeChangedAndRemoved(t *testing.T) {
+	commands, restore := stubSecretCommands(t)
+	defer restore()
+	cfg := secretsCfgTestSetup(t, PassSecretStore)
+	defer os.Remove(cfg.fileName)
+	assert.True(t, cfg.WithOptions(map[string]string{"accesstoken": "foma"}).Save())
+	assert.Equal(t, "foma", cfg.Option("accesstoken"))
+	assert.True(t, cfg.WithoutOptions("accesstoken").Save())
+	assert.Empty(t, cfg.Option("accesstoken"))
+	assert.Contains(t, *commands, "pass rm --force priam/familyCountDown/accesstoken")
+	assert.NotContains(t, GetTempFile(t, cfg.fileName), "foma")
+}
+
+func TestSecretOptionsCanBeMovedBackToConfigFile(t *testing.T) {
+	_, restore := stubSecretCommands(t)
+	defer restore()
+	cfg := secretsCfgTestSetup(t, SecretServiceStore)
+	defer os.Remove(cfg.fileName)
+	require.True(t, cfg.SetSecretStore(ConfigSecretStore))
+	contents := GetTempFile(t, cfg.fileName)
+	assert.Contains(t, contents, "accesstoken: wampeter")
+	assert.NotContains(t, contents, SecretStoreOption)
+}
+
+func TestDeletingTargetDeletesItsSecrets(t *testing.T) {
+	commands, restore := stubSecretCommands(t)
+	defer restore()
+	cfg := secretsCfgTestSetup(t, PassSecretStore)
+	defer os.Remove(cfg.fileName)
+	cfg.DeleteTarget("", "")
+	assert.Contains(t, *commands, "pass rm --force priam/familyCountDown/idtoken")
+}
+
+func TestSecretStoreErrors(t *testing.T) {
+	cfg := secretsCfgTestSetup(t, ConfigSecretStore)
+	defer os.Remove(cfg.fileName)
+	assert.False(t, cfg.SetSecretStore("vault"))
+	assert.Contains(t, cfg.Log.ErrString(), `unknown secret store "vault"`)
+
+	cfg.Targets[cfg.CurrentTarget][SecretStoreOption] = "vault"
+	cfg.Option("accesstoken")
+	assert.Contains(t, cfg.Log.ErrString(), "could not get accesstoken from secret store")
+	assert.False(t, cfg.WithOptions(map[string]string{"accesstoken": "foma"}).Save())
+	assert.Contains(t, cfg.Log.ErrString(), "could not save accesstoken of target familyCountDown in secret store")
+}
+
+func TestSavingExistingConfigFileMakesItOnlyReadableByUser(t *testing.T) {
+	cfg := cfgTestSetup(t)
+	defer os.Remove(cfg.fileName)
+	require.Nil(t, os.Chmod(cfg.fileName, 0644))
+	require.True(t, cfg.Save())
+	info, err := os.Stat(cfg.fileName)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
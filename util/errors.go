@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+/* ErrorKind classifies errors so that callers can react to them, for example by exiting
+   with a distinct status for each kind. The values are the exit statuses of priam.
+*/
+type ErrorKind int
+
+const (
+	ErrGeneral  ErrorKind = iota + 1 // any error that is not one of the kinds below
+	ErrUsage                         // invalid arguments, options or input files
+	ErrAuth                          // not logged in, or the credentials were rejected (401, 403)
+	ErrNotFound                      // the named resource does not exist (404)
+	ErrConflict                      // the resource already exists or was changed by someone else (409)
+	ErrNetwork                       // the server could not be reached
+)
+
+// Error is an error of a known kind
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns an error of the given kind with a message formatted like fmt.Errorf
+func NewError(kind ErrorKind, format string, args ...interface{}) error {
+	return &Error{kind, fmt.Errorf(format, args...)}
+}
+
+// HttpError is returned for replies from the server with an unexpected status
+type HttpError struct {
+	StatusCode int
+	Status     string // status line of the reply, like "404 Not Found"
+	Body       string // body of the reply, formatted for display
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("%s\n%s\n", e.Status, e.Body)
+}
+
+// Kind returns the kind of error for the status of the reply
+func (e *HttpError) Kind() ErrorKind {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	}
+	return ErrGeneral
+}
+
+// KindOf returns the kind of the first typed error in the chain of err, ErrGeneral if
+// there is none, or 0 if err is nil.
+func KindOf(err error) ErrorKind {
+	if err == nil {
+		return 0
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch te := e.(type) {
+		case *Error:
+			return te.Kind
+		case *HttpError:
+			return te.Kind()
+		}
+	}
+	return ErrGeneral
+}
@@ -0,0 +1,44 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKindOfNilIsZero(t *testing.T) {
+	assert.Equal(t, ErrorKind(0), KindOf(nil))
+}
+
+func TestKindOfUntypedErrorIsGeneral(t *testing.T) {
+	assert.Equal(t, ErrGeneral, KindOf(errors.New("oops")))
+}
+
+func TestKindOfWrappedError(t *testing.T) {
+	err := fmt.Errorf("while adding: %w", NewError(ErrConflict, "user %s exists", "elsa"))
+	assert.Equal(t, ErrConflict, KindOf(err))
+	assert.Equal(t, "while adding: user elsa exists", err.Error())
+}
+
+func TestKindOfHttpErrors(t *testing.T) {
+	for status, kind := range map[int]ErrorKind{401: ErrAuth, 403: ErrAuth, 404: ErrNotFound,
+		409: ErrConflict, 500: ErrGeneral} {
+		assert.Equal(t, kind, KindOf(&HttpError{StatusCode: status}), "kind of status %d", status)
+	}
+}
@@ -23,14 +23,30 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// DefaultTimeout is the time allowed for a request, including reading the reply
+const DefaultTimeout = 60 * time.Second
+
+// delays between retries: the first retry waits about retryBaseDelay, and each
+// following retry waits twice as long as the previous one, up to retryMaxDelay.
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// waits before a retry, replaced in tests
+var sleep = time.Sleep
+
 type HttpContext struct {
 	Log     *Logr
 	HostURL string
@@ -49,14 +65,55 @@ type HttpContext struct {
 	baseMediaType string
 	headers       map[string]string
 	client        http.Client
+
+	/* DryRun causes requests that could change data on the server to be
+	 * printed rather than sent. GET and HEAD requests, and requests made
+	 * with ReadRequest, are always sent.
+	 */
+	DryRun bool
+
+	/* OnUnauthorized is called when the server rejects a request with status
+	 * 401, typically because the access token has expired. If it returns true,
+	 * for example after updating the authorization header, the request is
+	 * sent once more.
+	 */
+	OnUnauthorized func(ctx *HttpContext) bool
+
+	/* Retries is the number of times a request is sent again after a failure
+	 * that is likely to be temporary. Requests are retried if the server replies
+	 * with status 429 or 503, which mean that the request was not processed. If
+	 * the request does not change data on the server or can safely be repeated,
+	 * like PUT and DELETE, it is also retried after a network error or a 502 or
+	 * 504 reply. Retries wait with a jittered exponential backoff, or as long as
+	 * the Retry-After header of the reply asks.
+	 */
+	Retries int
 }
 
 func NewHttpContext(log *Logr, hostURL, basePath, baseMediaType string) *HttpContext {
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: false}, // @todo Add a flag to trust self-signed cert
+		Proxy:           http.ProxyFromEnvironment, // see Proxy to change the settings
+		TLSClientConfig: &tls.Config{},             // see TLS to change the settings
 	}
-	return &HttpContext{Log: log, HostURL: hostURL, basePath: basePath,
-		baseMediaType: baseMediaType, headers: make(map[string]string), client: http.Client{Transport: tr}}
+	return &HttpContext{Log: log, HostURL: hostURL, basePath: basePath, baseMediaType: baseMediaType,
+		headers: make(map[string]string), client: http.Client{Transport: tr, Timeout: DefaultTimeout}}
+}
+
+// Timeout sets the time allowed for each request, including reading the reply. Zero means no timeout.
+func (ctx *HttpContext) Timeout(d time.Duration) *HttpContext {
+	ctx.client.Timeout = d
+	return ctx
+}
+
+// Clone returns a copy of the context with its own headers, so that the copy can be used at the
+// same time as the context. The copy shares the connections of the context.
+func (ctx *HttpContext) Clone() *HttpContext {
+	clone := *ctx
+	clone.headers = make(map[string]string, len(ctx.headers))
+	for k, v := range ctx.headers {
+		clone.headers[k] = v
+	}
+	return &clone
 }
 
 func (ctx *HttpContext) fullMediaType(shortType string) string {
@@ -140,31 +197,151 @@ func formatReply(ls LogStyle, contentType string, body []byte) string {
 	return ToStringWithStyle(ls, parsedBody)
 }
 
-func (ctx *HttpContext) Request(method, path string, input, output interface{}) error {
-	body, err := ToJson(input)
-	if err != nil {
-		return err
+// keys of JSON request bodies whose values are not printed in dry run mode, matched without
+// case and underscores so that access_token and accessToken are both redacted, but not other
+// keys that contain them such as accessTokenTTL
+var secretKeys = map[string]bool{"password": true, "pwd": true, "secret": true, "clientsecret": true,
+	"sharedsecret": true, "accesstoken": true, "refreshtoken": true, "idtoken": true}
+
+func redactSecrets(input interface{}) interface{} {
+	switch inp := input.(type) {
+	case []interface{}:
+		for i, v := range inp {
+			inp[i] = redactSecrets(v)
+		}
+	case map[string]interface{}:
+		for k, v := range inp {
+			if secretKeys[strings.ToLower(strings.Replace(k, "_", "", -1))] {
+				inp[k] = "<redacted>"
+			} else {
+				inp[k] = redactSecrets(v)
+			}
+		}
 	}
-	url := ctx.HostURL + path
-	if !strings.HasPrefix(path, "/") {
-		url = ctx.HostURL + ctx.basePath + path
+	return input
+}
+
+// prints a request that is not sent because of dry run mode
+func (ctx *HttpContext) printDryRun(method, url string, body []byte) {
+	ctx.Log.Info("Dry run, not sending: %s %s\n", method, url)
+	if len(body) == 0 {
+		return
+	}
+	var parsedBody interface{}
+	if err := json.Unmarshal(body, &parsedBody); err != nil {
+		ctx.Log.Info("request body of %d bytes, content type %s\n", len(body), ctx.Headers("Content-Type"))
+	} else {
+		ctx.Log.Info("%s", ToStringWithStyle(ctx.Log.Style, redactSecrets(parsedBody)))
 	}
+}
+
+// sends a request with the current headers and returns the response
+func (ctx *HttpContext) send(method, url string, body []byte, traceBody bool) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for k, v := range ctx.headers {
 		req.Header.Set(k, v)
 	}
 	ctx.Log.Trace("%s request to : %v\n", method, url)
 	ctx.traceHeaders("request headers", &req.Header)
-	if input != nil {
+	if traceBody {
 		ctx.Log.Trace("request body: %s\n", body)
 	}
-	resp, err := ctx.client.Do(req)
+	return ctx.client.Do(req)
+}
+
+// returns true if a request that failed with the given reply or error may be sent again
+func retryable(idempotent bool, resp *http.Response, err error) bool {
+	if err != nil {
+		return idempotent
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// returns the time to wait before the given retry, counting from 0. The Retry-After
+// header of the reply, in seconds or as a date, is used if there is one, but no
+// retry waits longer than retryMaxDelay.
+func retryDelay(retry int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if after := resp.Header.Get("Retry-After"); after != "" {
+			if secs, err := strconv.ParseInt(after, 10, 64); err == nil && secs >= 0 {
+				if secs > int64(retryMaxDelay/time.Second) {
+					return retryMaxDelay
+				}
+				return time.Duration(secs) * time.Second
+			}
+			if t, err := http.ParseTime(after); err == nil {
+				if d := time.Until(t); d <= 0 {
+					return 0
+				} else if d < retryMaxDelay {
+					return d
+				}
+				return retryMaxDelay
+			}
+		}
+	}
+	delay := retryMaxDelay
+	if retry < 16 && retryBaseDelay<<uint(retry) < retryMaxDelay {
+		delay = retryBaseDelay << uint(retry)
+	}
+	// wait between half and all of the delay so that clients do not retry in step
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Request sends a request to the server. In dry run mode, requests with methods
+// other than GET or HEAD are printed and not sent.
+func (ctx *HttpContext) Request(method, path string, input, output interface{}) error {
+	return ctx.request(method != "GET" && method != "HEAD", method, path, input, output)
+}
+
+// ReadRequest sends a request that does not change data on the server, even if it
+// uses a method such as POST for a search. It is sent even in dry run mode.
+func (ctx *HttpContext) ReadRequest(method, path string, input, output interface{}) error {
+	return ctx.request(false, method, path, input, output)
+}
+
+func (ctx *HttpContext) request(write bool, method, path string, input, output interface{}) error {
+	body, err := ToJson(input)
 	if err != nil {
 		return err
 	}
+	url := ctx.HostURL + path
+	if !strings.HasPrefix(path, "/") {
+		url = ctx.HostURL + ctx.basePath + path
+	}
+	if write && ctx.DryRun {
+		ctx.printDryRun(method, url, body)
+		return nil
+	}
+	resp, err := ctx.send(method, url, body, input != nil)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && ctx.OnUnauthorized != nil && ctx.OnUnauthorized(ctx) {
+		resp.Body.Close()
+		ctx.Log.Debug("retrying %s request to %v with new authorization\n", method, url)
+		resp, err = ctx.send(method, url, body, input != nil)
+	}
+	idempotent := !write || method == "PUT" || method == "DELETE"
+	for retry := 0; retry < ctx.Retries && retryable(idempotent, resp, err); retry++ {
+		delay := retryDelay(retry, resp)
+		if err != nil {
+			ctx.Log.Debug("retrying %s request to %v in %v after error: %v\n", method, url, delay, err)
+		} else {
+			resp.Body.Close()
+			ctx.Log.Debug("retrying %s request to %v in %v after reply: %v\n", method, url, delay, resp.Status)
+		}
+		sleep(delay)
+		resp, err = ctx.send(method, url, body, input != nil)
+	}
+	if err != nil {
+		return &Error{ErrNetwork, err}
+	}
 	defer resp.Body.Close()
 	ctx.Log.Trace("response status: %v\n", resp.Status)
 	ctx.traceHeaders("response headers", &resp.Header)
@@ -189,7 +366,7 @@ func (ctx *HttpContext) Request(method, path string, input, output interface{})
 	}
 	good := map[int]bool{200: true, 201: true, 204: true}
 	if !good[resp.StatusCode] {
-		err = fmt.Errorf("%s\n%s\n", resp.Status, formatReply(ctx.Log.Style, contentType, body))
+		err = &HttpError{resp.StatusCode, resp.Status, formatReply(ctx.Log.Style, contentType, body)}
 	}
 	return err
 }
@@ -237,11 +414,13 @@ func (ctx *HttpContext) BasicAuth(name, pwd string) *HttpContext {
 	return ctx.Authorization("Basic " + base64.StdEncoding.EncodeToString([]byte(name+":"+pwd)))
 }
 
-func (ctx *HttpContext) GetPrintJson(prefix, path, mediaType string, filter ...string) {
+func (ctx *HttpContext) GetPrintJson(prefix, path, mediaType string, filter ...string) error {
 	var outp interface{}
-	if err := ctx.Accept(mediaType).Request("GET", path, nil, &outp); err != nil {
+	err := ctx.Accept(mediaType).Request("GET", path, nil, &outp)
+	if err != nil {
 		ctx.Log.Err("%s\nError: %v\n", prefix, err)
 	} else {
 		ctx.Log.PP(prefix, outp, filter...)
 	}
+	return err
 }
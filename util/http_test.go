@@ -18,7 +18,9 @@ package util
 import (
 	"github.com/stretchr/testify/assert"
 	. "github.com/vmware/priam/testaid"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func TestHttpGet(t *testing.T) {
@@ -33,3 +35,183 @@ func TestHttpGet(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, expected, output)
 }
+
+func TestDryRunPrintsWriteRequestWithSecretsRedacted(t *testing.T) {
+	srv := StartTstServer(t, map[string]TstHandler{})
+	defer srv.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "/base/", "")
+	ctx.DryRun = true
+	err := ctx.Request("POST", "users", `{"userName": "john", "password": "travolta", "nested": [{"clientSecret": "s"}],
+		"refresh_token": "bokonon", "accessTokenTTL": 360}`, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, ctx.Log.ErrString())
+	assert.Contains(t, ctx.Log.InfoString(), "Dry run, not sending: POST "+srv.URL+"/base/users\n")
+	assert.Contains(t, ctx.Log.InfoString(), "userName: john")
+	assert.Contains(t, ctx.Log.InfoString(), "password: <redacted>")
+	assert.Contains(t, ctx.Log.InfoString(), "clientSecret: <redacted>")
+	assert.Contains(t, ctx.Log.InfoString(), "refresh_token: <redacted>")
+	assert.Contains(t, ctx.Log.InfoString(), "accessTokenTTL: 360")
+	assert.NotContains(t, ctx.Log.InfoString(), "travolta")
+}
+
+func TestDryRunSendsReadRequests(t *testing.T) {
+	srv := StartTstServer(t, map[string]TstHandler{
+		"GET/testpath":  GoodPathHandler("got"),
+		"POST/testpath": GoodPathHandler("searched")})
+	defer srv.Close()
+	ctx, output := NewHttpContext(NewBufferedLogr(), srv.URL, "", ""), ""
+	ctx.DryRun = true
+	assert.Nil(t, ctx.Request("GET", "/testpath", nil, &output))
+	assert.Equal(t, "got", output)
+	assert.Nil(t, ctx.ReadRequest("POST", "/testpath", "{}", &output))
+	assert.Equal(t, "searched", output)
+	assert.Empty(t, ctx.Log.InfoString())
+}
+
+func TestUnauthorizedRequestIsRetriedWithNewAuthorization(t *testing.T) {
+	h := func(t *testing.T, req *TstReq) *TstReply {
+		if req.Authorization != "Bearer new" {
+			return &TstReply{Status: 401, StatusMsg: "expired"}
+		}
+		return &TstReply{Output: "ok", ContentType: "text/plain"}
+	}
+	srv := StartTstServer(t, map[string]TstHandler{"GET/testpath": h})
+	defer srv.Close()
+	ctx, output, calls := NewHttpContext(NewBufferedLogr(), srv.URL, "", ""), "", 0
+	ctx.Authorization("Bearer old").OnUnauthorized = func(ctx *HttpContext) bool {
+		calls++
+		ctx.Authorization("Bearer new")
+		return true
+	}
+	assert.Nil(t, ctx.Request("GET", "/testpath", nil, &output))
+	assert.Equal(t, "ok", output)
+	assert.Equal(t, 1, calls)
+}
+
+func TestUnauthorizedRequestFailsIfNotRetried(t *testing.T) {
+	srv := StartTstServer(t, map[string]TstHandler{"GET/testpath": ErrorHandler(401, "expired")})
+	defer srv.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "", "")
+	ctx.OnUnauthorized = func(ctx *HttpContext) bool { return false }
+	err := ctx.Request("GET", "/testpath", nil, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+}
+
+func TestErrorReplyHasKindOfStatus(t *testing.T) {
+	srv := StartTstServer(t, map[string]TstHandler{"GET/testpath": ErrorHandler(404, "no such thing")})
+	defer srv.Close()
+	err := NewHttpContext(NewBufferedLogr(), srv.URL, "", "").Request("GET", "/testpath", nil, nil)
+	assert.Equal(t, ErrNotFound, KindOf(err))
+	assert.Contains(t, err.Error(), "no such thing")
+}
+
+func TestUnreachableServerIsNetworkError(t *testing.T) {
+	err := NewHttpContext(NewBufferedLogr(), "http://127.0.0.1:1", "", "").Request("GET", "/testpath", nil, nil)
+	assert.Equal(t, ErrNetwork, KindOf(err))
+}
+
+// replaces the wait between retries. Returns the delays that would have been waited
+// and a function to restore the wait.
+func stubSleep() (*[]time.Duration, func()) {
+	delays, orig := []time.Duration{}, sleep
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	return &delays, func() { sleep = orig }
+}
+
+// returns a handler that replies with the given status until it has been called failures times
+func failingHandler(calls *int, failures, status int, headers map[string]string) TstHandler {
+	return func(t *testing.T, req *TstReq) *TstReply {
+		if *calls++; *calls <= failures {
+			return &TstReply{Status: status, StatusMsg: "try later", Headers: headers}
+		}
+		return &TstReply{Output: "ok", ContentType: "text/plain"}
+	}
+}
+
+func TestRequestIsRetriedWithBackoff(t *testing.T) {
+	delays, restore := stubSleep()
+	defer restore()
+	calls, output := 0, ""
+	srv := StartTstServer(t, map[string]TstHandler{"GET/testpath": failingHandler(&calls, 3, 503, nil)})
+	defer srv.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "", "")
+	ctx.Retries = 3
+	assert.Nil(t, ctx.Request("GET", "/testpath", nil, &output))
+	assert.Equal(t, "ok", output)
+	assert.Equal(t, 4, calls)
+	if assert.Len(t, *delays, 3) {
+		for i, d := range *delays {
+			assert.True(t, d >= retryBaseDelay<<uint(i)/2 && d <= retryBaseDelay<<uint(i), "delay %v of retry %d", d, i)
+		}
+	}
+}
+
+func TestRequestFailsWhenRetriesAreUsedUp(t *testing.T) {
+	delays, restore := stubSleep()
+	defer restore()
+	calls := 0
+	srv := StartTstServer(t, map[string]TstHandler{"GET/testpath": failingHandler(&calls, 3, 502, nil)})
+	defer srv.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "", "")
+	ctx.Retries = 2
+	err := ctx.Request("GET", "/testpath", nil, nil)
+	assert.Contains(t, err.Error(), "502 Bad Gateway")
+	assert.Equal(t, 3, calls)
+	assert.Len(t, *delays, 2)
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	delays, restore := stubSleep()
+	defer restore()
+	calls := 0
+	srv := StartTstServer(t, map[string]TstHandler{
+		"POST/testpath": failingHandler(&calls, 1, 429, map[string]string{"Retry-After": "7"})})
+	defer srv.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "", "")
+	ctx.Retries = 1
+	assert.Nil(t, ctx.Request("POST", "/testpath", "data", nil))
+	assert.Equal(t, []time.Duration{7 * time.Second}, *delays)
+}
+
+func TestRetryAfterIsLimitedToMaxDelay(t *testing.T) {
+	delays, restore := stubSleep()
+	defer restore()
+	calls := 0
+	srv := StartTstServer(t, map[string]TstHandler{
+		"GET/testpath": failingHandler(&calls, 2, 503, map[string]string{"Retry-After": "99999999999999999"})})
+	defer srv.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "", "")
+	ctx.Retries = 2
+	assert.Nil(t, ctx.Request("GET", "/testpath", nil, nil))
+	assert.Equal(t, []time.Duration{retryMaxDelay, retryMaxDelay}, *delays)
+}
+
+func TestRetryAfterDateIsLimitedToMaxDelay(t *testing.T) {
+	later := &http.Response{Header: http.Header{"Retry-After": {time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)}}}
+	assert.Equal(t, retryMaxDelay, retryDelay(0, later))
+}
+
+func TestWriteRequestIsNotRetriedOnBadGateway(t *testing.T) {
+	delays, restore := stubSleep()
+	defer restore()
+	calls := 0
+	srv := StartTstServer(t, map[string]TstHandler{"POST/testpath": failingHandler(&calls, 1, 502, nil)})
+	defer srv.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "", "")
+	ctx.Retries = 3
+	assert.NotNil(t, ctx.Request("POST", "/testpath", "data", nil))
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, *delays)
+}
+
+func TestRequestTimesOut(t *testing.T) {
+	slow := func(t *testing.T, req *TstReq) *TstReply {
+		time.Sleep(200 * time.Millisecond)
+		return &TstReply{Output: "late"}
+	}
+	srv := StartTstServer(t, map[string]TstHandler{"GET/testpath": slow})
+	defer srv.Close()
+	err := NewHttpContext(NewBufferedLogr(), srv.URL, "", "").Timeout(50*time.Millisecond).Request("GET", "/testpath", nil, nil)
+	assert.Equal(t, ErrNetwork, KindOf(err))
+}
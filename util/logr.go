@@ -29,16 +29,26 @@ type LogStyle int
 const (
 	LJson LogStyle = iota
 	LYaml
+	LTable
+	LCsv
+	LJsonPath
+	LTemplate
 )
 
 type Logr struct {
 	DebugOn, TraceOn, VerboseOn bool
 	Style                       LogStyle
 	ErrW, OutW                  io.Writer
+
+	// Projection is the expression or template of the LJsonPath and LTemplate styles
+	Projection string
+
+	// NoTitles omits the title line of pretty printed output so that it can be parsed
+	NoTitles bool
 }
 
 func NewLogr() *Logr {
-	return &Logr{false, false, false, LYaml, os.Stderr, os.Stdout}
+	return &Logr{Style: LYaml, ErrW: os.Stderr, OutW: os.Stdout}
 }
 
 func (l *Logr) ClearBuffers() *Logr {
@@ -47,7 +57,7 @@ func (l *Logr) ClearBuffers() *Logr {
 }
 
 func NewBufferedLogr() *Logr {
-	return (&Logr{false, false, false, LYaml, nil, nil}).ClearBuffers()
+	return (&Logr{Style: LYaml}).ClearBuffers()
 }
 
 func (l *Logr) InfoString() string {
@@ -81,7 +91,7 @@ func (l *Logr) Trace(format string, args ...interface{}) {
 func ToStringWithStyle(ls LogStyle, input interface{}) string {
 	var err error
 	var outp []byte
-	if ls == LYaml {
+	if ls == LYaml || ls == LTable {
 		outp, err = yaml.Marshal(input)
 	} else {
 		outp, err = json.MarshalIndent(input, "", "  ")
@@ -128,12 +138,109 @@ func (l *Logr) Filter(info interface{}, filter []string) interface{} {
 	return info
 }
 
-// pp will pretty print in json or yaml format (based on logr.style) to logr.info.
+// formats info in the style of the logr. For tables and CSV the filter keys select the
+// columns. JSONPath expressions and templates are applied to the unfiltered info.
+func (l *Logr) format(info interface{}, filter []string) (string, error) {
+	switch l.Style {
+	case LJsonPath:
+		return formatJsonPath(l.Projection, info)
+	case LTemplate:
+		return formatTemplate(l.Projection, info)
+	}
+	if l.Style == LTable || l.Style == LCsv {
+		return formatColumns(l.Style, toGeneric(info), filter)
+	}
+	if len(filter) > 0 {
+		info = l.Filter(info, filter)
+	}
+	return ToStringWithStyle(l.Style, info), nil
+}
+
+func (l *Logr) title(title string) {
+	if !l.NoTitles {
+		l.Info("---- %s ----\n", title)
+	}
+}
+
+// pp will pretty print in the format set by logr.style to logr.info.
 // If filter is not empty and logr is not verbose, output will only include map
 // values with those keys.
 func (l *Logr) PP(title string, info interface{}, filter ...string) {
-	if !l.VerboseOn && len(filter) > 0 {
-		info = l.Filter(info, filter)
+	if l.VerboseOn {
+		filter = nil
+	}
+	outp, err := l.format(info, filter)
+	l.title(title)
+	l.Info("%s", outp)
+	if err != nil {
+		l.Err("Error formatting output: %v\n", err)
+	}
+}
+
+// ListPrinter pretty prints a list in parts, such as pages of results, so that
+// the whole list does not need to be held in memory. Output is the same as
+// PP would print for the whole list.
+type ListPrinter struct {
+	log    *Logr
+	filter []string
+	count  int
+	items  []interface{} // kept until the list is closed for styles other than JSON and YAML
+}
+
+// NewListPrinter prints the title and returns a printer for the items of the list.
+// If filter is not empty and logr is not verbose, items only include map values with those keys.
+func (l *Logr) NewListPrinter(title string, filter ...string) *ListPrinter {
+	l.title(title)
+	if l.VerboseOn {
+		filter = nil
+	}
+	return &ListPrinter{log: l, filter: filter}
+}
+
+// returns true if items can be printed as they are added rather than when the list is closed
+func (lp *ListPrinter) streaming() bool {
+	return lp.log.Style == LJson || lp.log.Style == LYaml
+}
+
+// Add prints the next items of the list
+func (lp *ListPrinter) Add(items []interface{}) {
+	if !lp.streaming() {
+		lp.items = append(lp.items, items...)
+		return
+	}
+	if len(lp.filter) > 0 {
+		filtered, _ := lp.log.Filter(items, lp.filter).([]interface{})
+		items = filtered
+	}
+	for _, item := range items {
+		if lp.log.Style == LYaml {
+			lp.log.Info("%s", ToStringWithStyle(LYaml, []interface{}{item}))
+		} else {
+			prefix := ",\n  "
+			if lp.count == 0 {
+				prefix = "[\n  "
+			}
+			outp, err := json.MarshalIndent(item, "  ", "  ")
+			if err != nil {
+				outp = []byte(fmt.Sprintf("%q", fmt.Sprintf("%v", item)))
+			}
+			lp.log.Info("%s%s", prefix, outp)
+		}
+		lp.count++
+	}
+}
+
+// Close prints the end of the list
+func (lp *ListPrinter) Close() {
+	if !lp.streaming() {
+		outp, err := lp.log.format(append([]interface{}{}, lp.items...), lp.filter)
+		lp.log.Info("%s", outp)
+		if err != nil {
+			lp.log.Err("Error formatting output: %v\n", err)
+		}
+	} else if lp.count == 0 {
+		lp.log.Info("[]\n")
+	} else if lp.log.Style != LYaml {
+		lp.log.Info("\n]\n")
 	}
-	l.Info("---- %s ----\n%s", title, ToStringWithStyle(l.Style, info))
 }
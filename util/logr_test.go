@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -200,3 +201,35 @@ func TestUnfilteredOutputValidJson(t *testing.T) {
 	log.PP("sirens", ppData)
 	assert.Equal(t, expected, log.InfoString())
 }
+
+func TestListPrinterYamlMatchesPP(t *testing.T) {
+	pages := [][]interface{}{{map[string]interface{}{"name": "a", "id": 1}}, {}, {map[string]interface{}{"name": "b"}}}
+	log, ppLog := NewBufferedLogr(), NewBufferedLogr()
+	printer := log.NewListPrinter("items", "name")
+	for _, page := range pages {
+		printer.Add(page)
+	}
+	printer.Close()
+	ppLog.PP("items", []interface{}{pages[0][0], pages[2][0]}, "name")
+	assert.Equal(t, ppLog.InfoString(), log.InfoString())
+}
+
+func TestListPrinterJsonIsValid(t *testing.T) {
+	log := NewBufferedLogr()
+	log.Style = LJson
+	printer := log.NewListPrinter("items")
+	printer.Add([]interface{}{map[string]interface{}{"name": "a"}})
+	printer.Add([]interface{}{map[string]interface{}{"name": "b"}, "c"})
+	printer.Close()
+	var parsed []interface{}
+	out := strings.TrimPrefix(log.InfoString(), "---- items ----\n")
+	assert.Nil(t, json.Unmarshal([]byte(out), &parsed))
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}, "c"}, parsed)
+}
+
+func TestListPrinterEmptyList(t *testing.T) {
+	log := NewBufferedLogr()
+	log.Style = LJson
+	log.NewListPrinter("items").Close()
+	assert.Equal(t, "---- items ----\n[]\n", log.InfoString())
+}
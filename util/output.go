@@ -0,0 +1,326 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+/* ParseOutputFormat parses the value of the output option, one of table, csv, json, yaml,
+   jsonpath=<expression> or template=<Go template>. Returns the log style and, for jsonpath
+   and template, the expression or template.
+*/
+func ParseOutputFormat(format string) (style LogStyle, projection string, err error) {
+	switch kv := strings.SplitN(format, "=", 2); {
+	case format == "table":
+		return LTable, "", nil
+	case format == "csv":
+		return LCsv, "", nil
+	case format == "json":
+		return LJson, "", nil
+	case format == "yaml":
+		return LYaml, "", nil
+	case len(kv) == 2 && kv[0] == "jsonpath":
+		_, err = parseJsonPath(kv[1])
+		return LJsonPath, kv[1], err
+	case len(kv) == 2 && kv[0] == "template":
+		_, err = newOutputTemplate(kv[1])
+		return LTemplate, kv[1], err
+	}
+	return style, "", fmt.Errorf("unknown output format \"%s\", must be one of table, csv, json, yaml, "+
+		"jsonpath=<expression> or template=<Go template>", format)
+}
+
+// converts structs and YAML maps to the generic JSON types that projections work on
+func toGeneric(input interface{}) interface{} {
+	input = ChangeKeysToString(input)
+	var output interface{}
+	if b, err := json.Marshal(input); err != nil || json.Unmarshal(b, &output) != nil {
+		return input
+	}
+	return output
+}
+
+// returns the rows of a table: the items of a list, the items of a list reply such as
+// {"items": [...], "_links": {...}}, the items of an object that only contains a list,
+// or else the single object
+func tableRows(info interface{}) []interface{} {
+	switch inf := info.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return inf
+	case map[string]interface{}:
+		if items, ok := inf["items"].([]interface{}); ok {
+			return items
+		}
+		if len(inf) == 1 {
+			for _, v := range inf {
+				if items, ok := v.([]interface{}); ok {
+					return items
+				}
+			}
+		}
+	}
+	return []interface{}{info}
+}
+
+// returns the column names in the order of the filter or, without a filter, sorted
+func tableColumns(rows []interface{}, filter []string) []string {
+	present := make(map[string]bool)
+	for _, row := range rows {
+		if m, ok := row.(map[string]interface{}); ok {
+			for k := range m {
+				present[k] = true
+			}
+		} else {
+			present["value"] = true
+		}
+	}
+	var columns []string
+	if len(filter) > 0 {
+		for _, k := range filter {
+			if present[k] {
+				columns, present[k] = append(columns, k), false
+			}
+		}
+	} else {
+		for k := range present {
+			columns = append(columns, k)
+		}
+		sort.Strings(columns)
+	}
+	return columns
+}
+
+/* cellString returns a value as table or CSV cell text. Lists are joined with commas,
+   objects with a single key are shown as that key's value and other objects as key=value
+   pairs, so that for example a list of emails is shown as the addresses.
+*/
+func cellString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		cells := make([]string, len(v))
+		for i, item := range v {
+			cells[i] = cellString(item)
+		}
+		return strings.Join(cells, ",")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		if len(keys) == 1 {
+			return cellString(v[keys[0]])
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			keys[i] = k + "=" + cellString(v[k])
+		}
+		return strings.Join(keys, " ")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// formats info as an aligned table or CSV with a header line
+func formatColumns(style LogStyle, info interface{}, filter []string) (string, error) {
+	rows := tableRows(info)
+	columns := tableColumns(rows, filter)
+	if len(columns) == 0 {
+		return "", nil
+	}
+	records := [][]string{columns}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			if m, ok := row.(map[string]interface{}); ok {
+				record[i] = cellString(m[c])
+			} else if c == "value" {
+				record[i] = cellString(row)
+			}
+		}
+		records = append(records, record)
+	}
+	buf := &bytes.Buffer{}
+	if style == LCsv {
+		w := csv.NewWriter(buf)
+		w.WriteAll(records)
+		return buf.String(), w.Error()
+	}
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	for _, record := range records {
+		for i, cell := range record {
+			record[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(cell)
+		}
+		fmt.Fprintln(w, strings.Join(record, "\t"))
+	}
+	err := w.Flush()
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \n")
+	}
+	return strings.Join(lines, "\n"), err
+}
+
+// a step of a JSONPath expression: a child name, an array index, or a wildcard if both are unset
+type jsonPathStep struct {
+	name  string
+	index *int
+}
+
+/* parseJsonPath parses JSONPath expressions like {.items[*].name} or $.items[0].name.
+   The braces and $ are optional. Supported steps are .name, ['name'], [index], [*] and .*
+*/
+func parseJsonPath(expr string) (steps []jsonPathStep, err error) {
+	path := strings.TrimSpace(expr)
+	if strings.HasPrefix(path, "{") && strings.HasSuffix(path, "}") {
+		path = strings.TrimSpace(path[1 : len(path)-1])
+	}
+	path = strings.TrimPrefix(path, "$")
+	for path != "" {
+		switch {
+		case strings.HasPrefix(path, ".."):
+			return nil, fmt.Errorf("invalid jsonpath \"%s\": recursive descent is not supported", expr)
+		case strings.HasPrefix(path, "."):
+			end := strings.IndexAny(path[1:], ".[")
+			if end < 0 {
+				end = len(path) - 1
+			}
+			name := path[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("invalid jsonpath \"%s\": missing name after '.'", expr)
+			}
+			if name != "*" {
+				steps = append(steps, jsonPathStep{name: name})
+			} else {
+				steps = append(steps, jsonPathStep{})
+			}
+			path = path[end+1:]
+		case strings.HasPrefix(path, "["):
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jsonpath \"%s\": missing ']'", expr)
+			}
+			sel := strings.TrimSpace(path[1:end])
+			if sel == "*" {
+				steps = append(steps, jsonPathStep{})
+			} else if len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0] {
+				steps = append(steps, jsonPathStep{name: sel[1 : len(sel)-1]})
+			} else if i, err := strconv.Atoi(sel); err == nil {
+				steps = append(steps, jsonPathStep{index: &i})
+			} else {
+				return nil, fmt.Errorf("invalid jsonpath \"%s\": unsupported selector [%s]", expr, sel)
+			}
+			path = path[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid jsonpath \"%s\": expected '.' or '[' at \"%s\"", expr, path)
+		}
+	}
+	return
+}
+
+// returns the values selected by the steps of a JSONPath expression
+func selectJsonPath(steps []jsonPathStep, values []interface{}) []interface{} {
+	for _, step := range steps {
+		var selected []interface{}
+		for _, value := range values {
+			switch v := value.(type) {
+			case []interface{}:
+				if step.index != nil {
+					if i := *step.index; i >= 0 && i < len(v) {
+						selected = append(selected, v[i])
+					} else if i < 0 && -i <= len(v) {
+						selected = append(selected, v[len(v)+i])
+					}
+				} else if step.name == "" {
+					selected = append(selected, v...)
+				}
+			case map[string]interface{}:
+				if step.name != "" {
+					if child, ok := v[step.name]; ok {
+						selected = append(selected, child)
+					}
+				} else if step.index == nil {
+					keys := make([]string, 0, len(v))
+					for k := range v {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						selected = append(selected, v[k])
+					}
+				}
+			}
+		}
+		values = selected
+	}
+	return values
+}
+
+// formats the values selected by a JSONPath expression, one per line. Strings are
+// printed as they are, other values as compact JSON.
+func formatJsonPath(expr string, info interface{}) (string, error) {
+	steps, err := parseJsonPath(expr)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	for _, v := range selectJsonPath(steps, []interface{}{toGeneric(info)}) {
+		if s, ok := v.(string); ok {
+			buf.WriteString(s)
+		} else if b, err := json.Marshal(v); err != nil {
+			return "", err
+		} else {
+			buf.Write(b)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// parses an output template. The json function formats a value as compact JSON.
+func newOutputTemplate(text string) (*template.Template, error) {
+	funcs := template.FuncMap{"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}}
+	return template.New("output").Funcs(funcs).Parse(text)
+}
+
+// formats info with a Go template
+func formatTemplate(text string, info interface{}) (string, error) {
+	tmpl, err := newOutputTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, toGeneric(info))
+	return buf.String(), err
+}
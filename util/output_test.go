@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const crew string = `{"items": [
+  {"userName": "ahab", "id": 1, "emails": [{"value": "ahab@pequod.com"}], "active": true},
+  {"userName": "ishmael", "id": 2, "emails": [{"value": "ish@pequod.com"}, {"value": "ish@sea.com"}]}
+]}`
+
+func crewLogr(t *testing.T, format string) (*Logr, interface{}) {
+	var info interface{}
+	assert.Nil(t, json.Unmarshal([]byte(crew), &info))
+	log := NewBufferedLogr()
+	var err error
+	log.Style, log.Projection, err = ParseOutputFormat(format)
+	assert.Nil(t, err)
+	log.NoTitles = log.Style != LTable
+	return log, info
+}
+
+func TestTableOutputUsesFilterAsColumns(t *testing.T) {
+	log, info := crewLogr(t, "table")
+	log.PP("crew", info, "userName", "emails", "active")
+	assert.Equal(t, "---- crew ----\n"+
+		"userName  emails                      active\n"+
+		"ahab      ahab@pequod.com             true\n"+
+		"ishmael   ish@pequod.com,ish@sea.com\n", log.InfoString())
+}
+
+func TestTableOutputWithoutFilterHasSortedColumns(t *testing.T) {
+	log, info := crewLogr(t, "table")
+	log.VerboseOn = true
+	log.PP("crew", info, "userName")
+	assert.Equal(t, "---- crew ----\n"+
+		"active  emails                      id  userName\n"+
+		"true    ahab@pequod.com             1   ahab\n"+
+		"        ish@pequod.com,ish@sea.com  2   ishmael\n", log.InfoString())
+}
+
+func TestCsvOutputHasNoTitle(t *testing.T) {
+	log, info := crewLogr(t, "csv")
+	log.PP("crew", info, "userName", "emails")
+	assert.Equal(t, "userName,emails\nahab,ahab@pequod.com\nishmael,\"ish@pequod.com,ish@sea.com\"\n", log.InfoString())
+}
+
+func TestCsvOutputOfListReplyWithLinks(t *testing.T) {
+	var info interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"items": [{"clientId": "bob"}, {"clientId": "fred"}],
+		"_links": {"self": {"href": "/SAAS/jersey/manager/api/oauth2clients"}}}`), &info))
+	log := NewBufferedLogr()
+	log.Style, log.NoTitles = LCsv, true
+	log.PP("clients", info)
+	assert.Equal(t, "clientId\nbob\nfred\n", log.InfoString())
+}
+
+func TestCsvOutputOfSingleObject(t *testing.T) {
+	log := NewBufferedLogr()
+	log.Style, log.NoTitles = LCsv, true
+	log.PP("app", map[interface{}]interface{}{"name": "makesnow", "type": "Saml20"})
+	assert.Equal(t, "name,type\nmakesnow,Saml20\n", log.InfoString())
+}
+
+func TestJsonPathOutput(t *testing.T) {
+	for expr, expected := range map[string]string{
+		"{.items[*].userName}":        "ahab\nishmael\n",
+		"$.items[-1].emails[0]":       "{\"value\":\"ish@pequod.com\"}\n",
+		".items[0]['id']":             "1\n",
+		"{.items[*].emails[*].value}": "ahab@pequod.com\nish@pequod.com\nish@sea.com\n",
+		".items[*].nothing":           "",
+	} {
+		log, info := crewLogr(t, "jsonpath="+expr)
+		log.PP("crew", info, "id")
+		assert.Equal(t, expected, log.InfoString(), "output of jsonpath "+expr)
+		assert.Empty(t, log.ErrString())
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	log, info := crewLogr(t, `template={{range .items}}{{.userName}} {{json .emails}}{{"\n"}}{{end}}`)
+	log.PP("crew", info)
+	assert.Equal(t, "ahab [{\"value\":\"ahab@pequod.com\"}]\n"+
+		"ishmael [{\"value\":\"ish@pequod.com\"},{\"value\":\"ish@sea.com\"}]\n", log.InfoString())
+}
+
+func TestTemplateExecutionErrorIsLogged(t *testing.T) {
+	log, _ := crewLogr(t, "template={{index .items 5}}")
+	log.PP("crew", map[string]interface{}{"items": []interface{}{}})
+	assert.Contains(t, log.ErrString(), "Error formatting output")
+}
+
+func TestParseOutputFormatErrors(t *testing.T) {
+	for format, expected := range map[string]string{
+		"xml":                 `unknown output format "xml"`,
+		"jsonpath":            `unknown output format "jsonpath"`,
+		"jsonpath=$..name":    "recursive descent is not supported",
+		"jsonpath=.items[x]":  "unsupported selector [x]",
+		"jsonpath=.items[0":   "missing ']'",
+		"jsonpath=items":      "expected '.' or '['",
+		"template={{.name":    "unclosed action",
+		"template={{nofunc}}": `function "nofunc" not defined`,
+	} {
+		_, _, err := ParseOutputFormat(format)
+		if assert.NotNil(t, err, "format "+format) {
+			assert.Contains(t, err.Error(), expected)
+		}
+	}
+}
+
+func TestListPrinterTable(t *testing.T) {
+	log := NewBufferedLogr()
+	log.Style = LTable
+	printer := log.NewListPrinter("items", "name", "id")
+	printer.Add([]interface{}{map[string]interface{}{"name": "a", "id": 1}})
+	printer.Add([]interface{}{map[string]interface{}{"name": "bee", "id": 22, "other": "x"}})
+	printer.Close()
+	assert.Equal(t, "---- items ----\nname  id\na     1\nbee   22\n", log.InfoString())
+}
+
+func TestListPrinterEmptyCsv(t *testing.T) {
+	log := NewBufferedLogr()
+	log.Style, log.NoTitles = LCsv, true
+	log.NewListPrinter("items", "name").Close()
+	assert.Empty(t, log.InfoString())
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/* Target options for the proxy to reach the target through. */
+const (
+	ProxyOption         = "proxy"         // URL of the proxy, http://host:port for HTTP CONNECT or socks5://host:port
+	ProxyUserOption     = "proxyuser"     // user name to authenticate to the proxy with
+	ProxyPasswordOption = "proxypassword" // password of the proxy user
+)
+
+/* ProxyOptions select the proxy for requests. If no URL is given, the proxy is selected by
+   the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+*/
+type ProxyOptions struct {
+	URL            string // http, https or socks5 URL of the proxy, host:port is taken as an http URL
+	User, Password string // credentials for basic authentication to an HTTP proxy, or for SOCKS5
+}
+
+// ProxyOptions returns the proxy settings of the current target
+func (cfg *Config) ProxyOptions() ProxyOptions {
+	return ProxyOptions{URL: cfg.Option(ProxyOption), User: cfg.Option(ProxyUserOption),
+		Password: cfg.Option(ProxyPasswordOption)}
+}
+
+// ProxyFunc returns the function that selects the proxy for a request, or an error if the URL of the proxy is not valid.
+func (opts ProxyOptions) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if opts.URL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL := opts.URL
+	if !strings.Contains(proxyURL, "://") {
+		proxyURL = "http://" + proxyURL
+	}
+	u, err := url.Parse(proxyURL)
+	if err == nil && u.Host == "" {
+		err = fmt.Errorf("no host given")
+	} else if err == nil && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+		err = fmt.Errorf("scheme must be http, https or socks5")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL \"%s\": %v", opts.URL, err)
+	}
+	if opts.User != "" {
+		u.User = url.UserPassword(opts.User, opts.Password)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// Proxy sets the proxy for requests of this context
+func (ctx *HttpContext) Proxy(opts ProxyOptions) error {
+	proxy, err := opts.ProxyFunc()
+	if err != nil {
+		return err
+	}
+	ctx.client.Transport.(*http.Transport).Proxy = proxy
+	return nil
+}
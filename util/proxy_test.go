@@ -0,0 +1,72 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// starts a forward proxy that replies to requests for http://idm.example.com itself, and
+// records the Proxy-Authorization header of the requests.
+func startTstProxy(t *testing.T, proxyAuth *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "idm.example.com", r.URL.Host)
+		*proxyAuth = r.Header.Get("Proxy-Authorization")
+		io.WriteString(w, "ok via proxy")
+	}))
+}
+
+func TestRequestIsSentThroughProxy(t *testing.T) {
+	proxyAuth, output := "", ""
+	proxy := startTstProxy(t, &proxyAuth)
+	defer proxy.Close()
+	ctx := NewHttpContext(NewBufferedLogr(), "http://idm.example.com", "", "")
+	require.Nil(t, ctx.Proxy(ProxyOptions{URL: proxy.URL, User: "joe", Password: "s3cret"}))
+	assert.Nil(t, ctx.Request("GET", "/health", nil, &output))
+	assert.Equal(t, "ok via proxy", output)
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("joe:s3cret")), proxyAuth)
+}
+
+func TestProxyURLWithoutSchemeIsHttp(t *testing.T) {
+	proxy, err := ProxyOptions{URL: "proxy.example.com:3128"}.ProxyFunc()
+	require.Nil(t, err)
+	u, err := proxy(httptest.NewRequest("GET", "https://idm.example.com/", nil))
+	require.Nil(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", u.String())
+}
+
+func TestSocksProxyHasCredentials(t *testing.T) {
+	proxy, err := ProxyOptions{URL: "socks5://proxy.example.com:1080", User: "joe", Password: "pw"}.ProxyFunc()
+	require.Nil(t, err)
+	u, err := proxy(httptest.NewRequest("GET", "https://idm.example.com/", nil))
+	require.Nil(t, err)
+	assert.Equal(t, "socks5://joe:pw@proxy.example.com:1080", u.String())
+}
+
+func TestInvalidProxyURLsAreErrors(t *testing.T) {
+	for _, proxyURL := range []string{"ftp://proxy.example.com", "http://", "http://proxy.example.com:port"} {
+		_, err := ProxyOptions{URL: proxyURL}.ProxyFunc()
+		if assert.Error(t, err, proxyURL) {
+			assert.Contains(t, err.Error(), "invalid proxy URL")
+		}
+	}
+}
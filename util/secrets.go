@@ -0,0 +1,265 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+/* SecretStoreOption is the target option that selects where the secret options of the
+   target, such as tokens, are kept.
+*/
+const SecretStoreOption = "secretstore"
+
+const (
+	ConfigSecretStore  = "config"         // in the config file itself
+	FileSecretStore    = "file"           // in a file encrypted with a passphrase
+	PassSecretStore    = "pass"           // in the standard unix password manager, pass
+	SecretServiceStore = "secret-service" // in the desktop keyring via secret-tool
+)
+
+var SecretStores = []string{ConfigSecretStore, FileSecretStore, PassSecretStore, SecretServiceStore}
+
+/* SecretStore keeps secret options of targets outside of the config file. Get returns an
+   empty string and no error if the option is not set.
+*/
+type SecretStore interface {
+	Get(target, key string) (string, error)
+	Set(target, key, value string) error
+	Delete(target, key string) error
+}
+
+func newSecretStore(cfg *Config, kind string) (SecretStore, error) {
+	switch kind {
+	case FileSecretStore:
+		return &fileSecretStore{fileName: cfg.fileName + ".secrets", passphrase: cfg.Passphrase}, nil
+	case PassSecretStore:
+		return passStore{}, nil
+	case SecretServiceStore:
+		return secretServiceStore{}, nil
+	}
+	return nil, fmt.Errorf("unknown secret store \"%s\", must be one of %s", kind, strings.Join(SecretStores, ", "))
+}
+
+// -- encrypted file
+
+// parameters for deriving the file key from the passphrase, as recommended by the scrypt package
+const scryptN, scryptR, scryptP, fileKeyLen = 1 << 15, 8, 1, 32
+
+type fileSecretStore struct {
+	fileName   string
+	passphrase func(confirm bool) (string, error)
+	salt, key  []byte
+	secrets    map[string]map[string]string
+}
+
+// contents of the secrets file, the data is the JSON encoded secrets encrypted with AES-GCM
+type encryptedSecrets struct {
+	Salt, Nonce, Data []byte
+}
+
+// gets the passphrase and derives the key, confirm is set when a new file is created
+func (s *fileSecretStore) deriveKey(confirm bool) (err error) {
+	if s.passphrase == nil {
+		return errors.New("no passphrase available")
+	}
+	pass, err := s.passphrase(confirm)
+	if err == nil {
+		s.key, err = scrypt.Key([]byte(pass), s.salt, scryptN, scryptR, scryptP, fileKeyLen)
+	}
+	return
+}
+
+func (s *fileSecretStore) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *fileSecretStore) load() error {
+	if s.secrets != nil {
+		return nil
+	}
+	contents, err := ioutil.ReadFile(s.fileName)
+	if os.IsNotExist(err) {
+		s.salt, s.secrets = make([]byte, 16), make(map[string]map[string]string)
+		if _, err = rand.Read(s.salt); err != nil {
+			return err
+		}
+		return s.deriveKey(true)
+	}
+	var enc encryptedSecrets
+	if err == nil {
+		err = json.Unmarshal(contents, &enc)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read secrets file %s: %v", s.fileName, err)
+	}
+	s.salt = enc.Salt
+	if err = s.deriveKey(false); err != nil {
+		return err
+	}
+	aead, err := s.cipher()
+	if err != nil {
+		return err
+	}
+	data, err := aead.Open(nil, enc.Nonce, enc.Data, nil)
+	if err != nil {
+		return fmt.Errorf("could not decrypt secrets file %s, wrong passphrase?", s.fileName)
+	}
+	return json.Unmarshal(data, &s.secrets)
+}
+
+func (s *fileSecretStore) save() error {
+	aead, err := s.cipher()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	enc := encryptedSecrets{Salt: s.salt, Nonce: make([]byte, aead.NonceSize())}
+	if _, err = rand.Read(enc.Nonce); err != nil {
+		return err
+	}
+	enc.Data = aead.Seal(nil, enc.Nonce, data, nil)
+	if contents, err := json.Marshal(&enc); err != nil {
+		return err
+	} else {
+		return ioutil.WriteFile(s.fileName, contents, 0600)
+	}
+}
+
+func (s *fileSecretStore) Get(target, key string) (string, error) {
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	return s.secrets[target][key], nil
+}
+
+func (s *fileSecretStore) Set(target, key, value string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.secrets[target] == nil {
+		s.secrets[target] = make(map[string]string)
+	}
+	s.secrets[target][key] = value
+	return s.save()
+}
+
+func (s *fileSecretStore) Delete(target, key string) error {
+	if _, err := os.Stat(s.fileName); os.IsNotExist(err) {
+		return nil
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.secrets[target][key]; !ok {
+		return nil
+	}
+	delete(s.secrets[target], key)
+	if len(s.secrets[target]) == 0 {
+		delete(s.secrets, target)
+	}
+	return s.save()
+}
+
+// -- external password managers
+
+// runs a password manager command and returns its output, called via variable so that tests can provide stub
+var runSecretCommand = func(input, name string, args ...string) (stdout, stderr string, err error) {
+	var outb, errb bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = strings.NewReader(input), &outb, &errb
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf("%s failed: %v %s", name, err, strings.TrimSpace(errb.String()))
+	}
+	return outb.String(), errb.String(), err
+}
+
+// keeps secrets in pass, https://www.passwordstore.org, as priam/<target>/<key>
+type passStore struct{}
+
+const passNotFound = "is not in the password store"
+
+func passName(target, key string) string {
+	return "priam/" + target + "/" + key
+}
+
+func (passStore) Get(target, key string) (string, error) {
+	out, errOut, err := runSecretCommand("", "pass", "show", passName(target, key))
+	if err != nil && strings.Contains(errOut, passNotFound) {
+		return "", nil
+	}
+	return strings.TrimSuffix(out, "\n"), err
+}
+
+func (passStore) Set(target, key, value string) error {
+	_, _, err := runSecretCommand(value+"\n", "pass", "insert", "--multiline", "--force", passName(target, key))
+	return err
+}
+
+func (passStore) Delete(target, key string) error {
+	_, errOut, err := runSecretCommand("", "pass", "rm", "--force", passName(target, key))
+	if err != nil && strings.Contains(errOut, passNotFound) {
+		return nil
+	}
+	return err
+}
+
+// keeps secrets in the keyring of the freedesktop.org secret service, like gnome-keyring or KWallet
+type secretServiceStore struct{}
+
+func secretAttributes(target, key string) []string {
+	return []string{"service", "priam", "target", target, "key", key}
+}
+
+func (secretServiceStore) Get(target, key string) (string, error) {
+	out, errOut, err := runSecretCommand("", "secret-tool", append([]string{"lookup"}, secretAttributes(target, key)...)...)
+	if err != nil && strings.TrimSpace(errOut) == "" {
+		// secret-tool fails without a message if there is no matching secret
+		return "", nil
+	}
+	return out, err
+}
+
+func (secretServiceStore) Set(target, key, value string) error {
+	args := append([]string{"store", "--label", fmt.Sprintf("priam %s of target %s", key, target)},
+		secretAttributes(target, key)...)
+	_, _, err := runSecretCommand(value, "secret-tool", args...)
+	return err
+}
+
+func (secretServiceStore) Delete(target, key string) error {
+	_, _, err := runSecretCommand("", "secret-tool", append([]string{"clear"}, secretAttributes(target, key)...)...)
+	return err
+}
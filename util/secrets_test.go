@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	"os"
+	"strings"
+	"testing"
+)
+
+func secretsFileName(t *testing.T) string {
+	f := WriteTempFile(t, "")
+	CleanupTempFile(f)
+	return f.Name() + ".secrets"
+}
+
+func passphrase(pass string) func(bool) (string, error) {
+	return func(bool) (string, error) { return pass, nil }
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	fileName := secretsFileName(t)
+	defer os.Remove(fileName)
+	store := &fileSecretStore{fileName: fileName, passphrase: passphrase("ice-nine")}
+	require.Nil(t, store.Set("1", "accesstoken", "wampeter"))
+	require.Nil(t, store.Set("2", "accesstoken", "foma"))
+	assert.NotContains(t, GetTempFile(t, fileName), "wampeter")
+	info, err := os.Stat(fileName)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	store = &fileSecretStore{fileName: fileName, passphrase: passphrase("ice-nine")}
+	value, err := store.Get("1", "accesstoken")
+	assert.Nil(t, err)
+	assert.Equal(t, "wampeter", value)
+	require.Nil(t, store.Delete("1", "accesstoken"))
+	value, err = store.Get("1", "accesstoken")
+	assert.Nil(t, err)
+	assert.Empty(t, value)
+	value, _ = store.Get("2", "accesstoken")
+	assert.Equal(t, "foma", value)
+}
+
+func TestEncryptedFileStoreWithWrongPassphrase(t *testing.T) {
+	fileName := secretsFileName(t)
+	defer os.Remove(fileName)
+	require.Nil(t, (&fileSecretStore{fileName: fileName, passphrase: passphrase("ice-nine")}).Set("1", "idtoken", "karass"))
+	_, err := (&fileSecretStore{fileName: fileName, passphrase: passphrase("ice-ten")}).Get("1", "idtoken")
+	assert.EqualError(t, err, "could not decrypt secrets file "+fileName+", wrong passphrase?")
+}
+
+func TestEncryptedFileStoreWithoutPassphrase(t *testing.T) {
+	fileName := secretsFileName(t)
+	_, err := (&fileSecretStore{fileName: fileName}).Get("1", "idtoken")
+	assert.EqualError(t, err, "no passphrase available")
+	assert.Nil(t, (&fileSecretStore{fileName: fileName}).Delete("1", "idtoken"), "nothing to delete if there is no file")
+}
+
+// stubs password manager commands with an in memory store that replies like pass or secret-tool
+func stubSecretCommands(t *testing.T) (commands *[]string, restore func()) {
+	orig, secrets, cmds := runSecretCommand, make(map[string]string), []string{}
+	runSecretCommand = func(input, name string, args ...string) (string, string, error) {
+		cmds = append(cmds, name+" "+strings.Join(args, " "))
+		key, action := args[len(args)-1], args[0]
+		if name == "secret-tool" {
+			key = strings.Join(args[len(args)-4:], "/")
+		}
+		switch action {
+		case "show", "lookup":
+			if v, ok := secrets[key]; ok {
+				return v, "", nil
+			} else if name == "pass" {
+				return "", "Error: " + key + " is not in the password store.\n", errors.New("exit status 1")
+			}
+			return "", "", errors.New("exit status 1")
+		case "insert", "store":
+			secrets[key] = input
+		case "rm", "clear":
+			delete(secrets, key)
+		}
+		return "", "", nil
+	}
+	return &cmds, func() { runSecretCommand = orig }
+}
+
+func TestPassStore(t *testing.T) {
+	commands, restore := stubSecretCommands(t)
+	defer restore()
+	store := passStore{}
+	value, err := store.Get("staging", "accesstoken")
+	assert.Nil(t, err)
+	assert.Empty(t, value)
+	assert.Nil(t, store.Set("staging", "accesstoken", "wampeter"))
+	value, err = store.Get("staging", "accesstoken")
+	assert.Nil(t, err)
+	assert.Equal(t, "wampeter", value)
+	assert.Nil(t, store.Delete("staging", "accesstoken"))
+	assert.Equal(t, []string{"pass show priam/staging/accesstoken", "pass insert --multiline --force priam/staging/accesstoken",
+		"pass show priam/staging/accesstoken", "pass rm --force priam/staging/accesstoken"}, *commands)
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	commands, restore := stubSecretCommands(t)
+	defer restore()
+	store := secretServiceStore{}
+	value, err := store.Get("staging", "idtoken")
+	assert.Nil(t, err)
+	assert.Empty(t, value)
+	assert.Nil(t, store.Set("staging", "idtoken", "karass"))
+	value, err = store.Get("staging", "idtoken")
+	assert.Nil(t, err)
+	assert.Equal(t, "karass", value)
+	assert.Equal(t, "secret-tool store --label priam idtoken of target staging service priam target staging key idtoken", (*commands)[1])
+}
+
+func TestSecretStoreCommandFailure(t *testing.T) {
+	orig := runSecretCommand
+	defer func() { runSecretCommand = orig }()
+	runSecretCommand = func(input, name string, args ...string) (string, string, error) {
+		return "", "gpg: decryption failed: No secret key\n", errors.New("pass failed: exit status 2")
+	}
+	_, err := passStore{}.Get("staging", "accesstoken")
+	assert.EqualError(t, err, "pass failed: exit status 2")
+	_, err = secretServiceStore{}.Get("staging", "accesstoken")
+	assert.EqualError(t, err, "pass failed: exit status 2")
+}
+
+func TestUnknownSecretStore(t *testing.T) {
+	_, err := newSecretStore(&Config{}, "vault")
+	assert.EqualError(t, err, `unknown secret store "vault", must be one of config, file, pass, secret-service`)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+/* Target options for connections to the target over TLS. */
+const (
+	CABundleOption    = "cabundle"    // file of PEM encoded certificates of the CAs to trust
+	FingerprintOption = "fingerprint" // SHA-256 fingerprint of the certificate of the target
+	ClientCertOption  = "clientcert"  // file of the PEM encoded client certificate for mutual TLS
+	ClientKeyOption   = "clientkey"   // file of the PEM encoded private key of the client certificate
+	InsecureOption    = "insecure"    // "true" to skip verification of the certificate of the target
+)
+
+/* TLSOptions are the settings for connections to a server over TLS. By default the
+   certificate of the server is verified with the CAs of the system.
+*/
+type TLSOptions struct {
+	CABundle string // file of PEM encoded certificates of the CAs to trust instead of the system CAs
+
+	/* Fingerprint is the SHA-256 fingerprint of the server certificate, in hex with or
+	 * without colons. A server certificate with this fingerprint is trusted without
+	 * verifying its chain, which allows self-signed certificates, and any other
+	 * certificate is rejected.
+	 */
+	Fingerprint string
+
+	ClientCert, ClientKey string // PEM encoded files of the certificate and key for mutual TLS
+	Insecure              bool   // skip verification of the server certificate
+}
+
+// TLSOptions returns the TLS settings of the current target
+func (cfg *Config) TLSOptions() TLSOptions {
+	return TLSOptions{CABundle: cfg.Option(CABundleOption), Fingerprint: cfg.Option(FingerprintOption),
+		ClientCert: cfg.Option(ClientCertOption), ClientKey: cfg.Option(ClientKeyOption),
+		Insecure: cfg.Option(InsecureOption) == "true"}
+}
+
+// returns the fingerprint in lower case hex without colons, or an error if it is not a SHA-256 fingerprint
+func normalizeFingerprint(fingerprint string) (string, error) {
+	fp := strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+	if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 certificate fingerprint \"%s\"", fingerprint)
+	}
+	return fp, nil
+}
+
+// CertFingerprint returns the SHA-256 fingerprint of a DER encoded certificate in lower case hex
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// TLSConfig returns the configuration for connections with these options, or an error if the
+// files can not be read or the fingerprint is not valid.
+func (opts TLSOptions) TLSConfig() (*tls.Config, error) {
+	tc := &tls.Config{InsecureSkipVerify: opts.Insecure}
+	if opts.CABundle != "" {
+		pem, err := ioutil.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CABundle)
+		}
+	}
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, StringOrDefault(opts.ClientKey, opts.ClientCert))
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if opts.Fingerprint != "" {
+		fp, err := normalizeFingerprint(opts.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// the pinned certificate replaces the verification of the chain
+		tc.InsecureSkipVerify = true
+		tc.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) > 0 && CertFingerprint(rawCerts[0]) == fp {
+				return nil
+			}
+			return fmt.Errorf("certificate of server does not match fingerprint %s", opts.Fingerprint)
+		}
+	}
+	return tc, nil
+}
+
+// TLS sets the TLS options for requests of this context
+func (ctx *HttpContext) TLS(opts TLSOptions) error {
+	tc, err := opts.TLSConfig()
+	if err != nil {
+		return err
+	}
+	ctx.client.Transport.(*http.Transport).TLSClientConfig = tc
+	return nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright (c) 2026 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	. "github.com/vmware/priam/testaid"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// starts a TLS server with a certificate that is not trusted by default, which replies "ok"
+func startTLSServer(clientAuth tls.ClientAuthType) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	srv.TLS = &tls.Config{ClientAuth: clientAuth}
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // rejected handshakes are expected
+	srv.StartTLS()
+	return srv
+}
+
+// sends a request to the server with the given TLS options and returns the error
+func tlsRequest(t *testing.T, srv *httptest.Server, opts TLSOptions) error {
+	ctx := NewHttpContext(NewBufferedLogr(), srv.URL, "", "")
+	require.Nil(t, ctx.TLS(opts))
+	output := ""
+	err := ctx.Request("GET", "/", nil, &output)
+	if err == nil {
+		assert.Equal(t, "ok", output)
+	}
+	return err
+}
+
+func pemFile(t *testing.T, blockType string, der []byte) string {
+	f := WriteTempFile(t, string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})))
+	f.Close()
+	return f.Name()
+}
+
+// returns files of a self-signed client certificate and its key
+func clientCertFiles(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "priam"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	return pemFile(t, "CERTIFICATE", der), pemFile(t, "EC PRIVATE KEY", keyDer)
+}
+
+func TestUnknownCertificateIsRejected(t *testing.T) {
+	srv := startTLSServer(tls.NoClientCert)
+	defer srv.Close()
+	err := tlsRequest(t, srv, TLSOptions{})
+	assert.Equal(t, ErrNetwork, KindOf(err))
+	assert.Contains(t, err.Error(), "certificate")
+}
+
+func TestInsecureSkipsVerification(t *testing.T) {
+	srv := startTLSServer(tls.NoClientCert)
+	defer srv.Close()
+	assert.Nil(t, tlsRequest(t, srv, TLSOptions{Insecure: true}))
+}
+
+func TestCABundleIsTrusted(t *testing.T) {
+	srv := startTLSServer(tls.NoClientCert)
+	defer srv.Close()
+	bundle := pemFile(t, "CERTIFICATE", srv.Certificate().Raw)
+	defer os.Remove(bundle)
+	assert.Nil(t, tlsRequest(t, srv, TLSOptions{CABundle: bundle}))
+}
+
+func TestPinnedFingerprintIsTrusted(t *testing.T) {
+	srv := startTLSServer(tls.NoClientCert)
+	defer srv.Close()
+	fp := strings.ToUpper(CertFingerprint(srv.Certificate().Raw))
+	assert.Nil(t, tlsRequest(t, srv, TLSOptions{Fingerprint: fp[:2] + ":" + fp[2:]}))
+}
+
+func TestOtherFingerprintIsRejected(t *testing.T) {
+	srv := startTLSServer(tls.NoClientCert)
+	defer srv.Close()
+	err := tlsRequest(t, srv, TLSOptions{Fingerprint: strings.Repeat("ab", 32)})
+	assert.Contains(t, err.Error(), "does not match fingerprint")
+}
+
+func TestClientCertificateIsSent(t *testing.T) {
+	srv := startTLSServer(tls.RequireAnyClientCert)
+	defer srv.Close()
+	assert.NotNil(t, tlsRequest(t, srv, TLSOptions{Insecure: true}))
+	certFile, keyFile := clientCertFiles(t)
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+	assert.Nil(t, tlsRequest(t, srv, TLSOptions{Insecure: true, ClientCert: certFile, ClientKey: keyFile}))
+}
+
+func TestInvalidTLSOptionsAreErrors(t *testing.T) {
+	noCerts := pemFile(t, "NOTHING", nil)
+	defer os.Remove(noCerts)
+	for opts, expected := range map[TLSOptions]string{
+		{Fingerprint: "12:34"}:              "invalid SHA-256 certificate fingerprint",
+		{CABundle: "/no/such/bundle.pem"}:   "could not read CA bundle",
+		{ClientCert: "/no/such/client.pem"}: "could not load client certificate",
+		{CABundle: noCerts}:                 "no certificates found in CA bundle",
+	} {
+		_, err := opts.TLSConfig()
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), expected)
+		}
+	}
+}